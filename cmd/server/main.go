@@ -1,91 +1,245 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"linksprint/internal/app"
+	"linksprint/internal/clientip"
 	"linksprint/internal/config"
 	"linksprint/internal/database"
-	"linksprint/internal/handlers"
-	"linksprint/internal/middleware"
+	"linksprint/internal/logging"
+	"linksprint/internal/metrics"
 	"linksprint/internal/redis"
-	"linksprint/internal/routes"
+	"linksprint/internal/tracing"
 
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/joho/godotenv"
 )
 
+// logger is the logger of the server
+var logger = logging.For("server")
+
 func main() {
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using system environment variables")
+		logger.Info("no .env file found, using system environment variables")
+	}
+
+	// linksprint migrate ... manages the schema, linksprint
+	// reconcile-clicks rebuilds click counters and linksprint set-plan
+	// changes a workspace's plan, instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reconcile-clicks" {
+		os.Exit(runReconcileClicks(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "set-plan" {
+		os.Exit(runSetPlan(os.Args[2:]))
 	}
 
 	// Initialize configuration
-	cfg := config.Load()
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal("failed to load configuration", err)
+	}
+	if err := setupLogging(cfg.Logging); err != nil {
+		fatal("failed to set up logging", err)
+	}
+	live := config.NewLive(cfg)
+	go reloadOnSIGHUP(live)
 
-	// Initialize Redis client
-	redisClient, err := redis.NewClient(cfg.RedisURL)
+	// Initialize tracing before the clients it instruments
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		File:        cfg.Tracing.File,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		Environment: cfg.Environment,
+	})
 	if err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		fatal("failed to set up tracing", err)
+	}
+
+	// Initialize Redis client, or run Redis in-process
+	redisOptions := redis.Options{
+		PoolSize:    cfg.Redis.PoolSize,
+		URLTTL:      cfg.Redis.URLCacheTTL,
+		URLStaleTTL: cfg.Redis.URLStaleTTL,
+	}
+	var redisClient *redis.Client
+	if cfg.Redis.URL == config.InProcessRedis {
+		redisClient, err = redis.NewInProcess(redisOptions)
+	} else {
+		redisClient, err = redis.NewClientWithOptions(cfg.Redis.URL, redisOptions)
+	}
+	if err != nil {
+		fatal("failed to connect to Redis", err)
 	}
 	defer redisClient.Close()
 
 	// Initialize database
-	db, err := database.NewConnection(cfg.DatabaseURL)
+	db, err := database.NewConnection(cfg.Database.URL)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("failed to connect to database", err)
 	}
 	defer db.Close()
 
-	// Create Fiber app
-	app := fiber.New(fiber.Config{
-		AppName:      "LinkSprint",
-		ServerHeader: "LinkSprint",
-		ErrorHandler: handlers.ErrorHandler,
-	})
+	// Refuse to serve with a schema older than the code. A SQLite database
+	// belongs to this process alone, so it is migrated here instead.
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		fatal("failed to load migrations", err)
+	}
+	if db.Dialect == database.SQLite {
+		if _, err := migrator.Up(context.Background()); err != nil {
+			fatal("failed to migrate the SQLite database", err)
+		}
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		fatal("run `linksprint migrate up` before starting the server", err)
+	}
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
 
-	// Middleware
-	app.Use(recover.New())
-	app.Use(logger.New(logger.Config{
-		Format: "[${time}] ${status} - ${latency} ${method} ${path}\n",
-	}))
-	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET, POST, PUT, DELETE, OPTIONS",
-	}))
-
-	// Health check endpoint
-	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"status":  "healthy",
-			"service": "LinkSprint",
-			"version": "1.0.0",
-		})
+	// Resolve client IPs behind the trusted reverse proxies
+	clientIPs, err := clientip.New(cfg.Proxy.TrustedProxies, cfg.Proxy.ClientIPHeader)
+	if err != nil {
+		fatal("invalid client IP configuration", err)
+	}
+
+	// Build the HTTP application
+	server, err := app.New(app.Deps{
+		Config:    live,
+		DB:        db,
+		Redis:     redisClient,
+		ClientIPs: clientIPs,
 	})
+	if err != nil {
+		fatal("failed to build the application", err)
+	}
+	defer server.Close()
 
-	// Initialize handlers
-	urlHandler := handlers.NewURLHandler(db, redisClient)
-	analyticsHandler := handlers.NewAnalyticsHandler(db, redisClient)
+	// Export pool and queue stats alongside the request metrics
+	metrics.RegisterDB(db.DB, string(db.Dialect))
+	metrics.RegisterRedis(redisClient.Client)
+	metrics.RegisterClickQueue(server.Clicks)
 
-	// Setup routes
-	routes.SetupRoutes(app, urlHandler, analyticsHandler)
+	// Roll usage counters and clicks up and flush click counters to the
+	// database periodically
+	rollupCtx, stopRollup := context.WithCancel(context.Background())
+	defer stopRollup()
+	server.Usage.StartRollup(rollupCtx, cfg.Clicks.UsageRollupInterval)
+	server.Analytics.StartClickCounterFlush(rollupCtx, cfg.Clicks.CounterFlushInterval)
+	server.Analytics.StartClickRollup(rollupCtx, cfg.Clicks.RollupInterval)
+
+	// An in-process Redis starts empty, so link visitors are loaded back
+	// from the recorded clicks
+	if cfg.Redis.URL == config.InProcessRedis {
+		go func() {
+			if _, err := server.Analytics.RebuildVisitors(rollupCtx); err != nil {
+				logger.Warn("failed to rebuild link visitors", slog.Any("error", err))
+			}
+		}()
+	}
 
 	// Start server
-	port := cfg.Port
-	if port == "" {
-		port = "8080"
+	port := cfg.Server.Port
+
+	logger.Info("LinkSprint server starting", slog.String("port", port), slog.String("env", cfg.Environment))
+
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		fatal("failed to listen on port "+port, err)
+	}
+	if cfg.Proxy.ProxyProtocol {
+		ln = clientIPs.ProxyProtocolListener(ln)
+	}
+
+	// Serve until SIGINT or SIGTERM
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Listener(ln)
+	}()
+
+	select {
+	case err := <-serverErr:
+		logger.Error("server stopped", slog.Any("error", err))
+	case <-signalCtx.Done():
+		stopSignals()
+		logger.Info("shutting down, draining connections")
+
+		// Fail readiness first so load balancers stop routing here, then
+		// stop accepting connections and wait for in-flight requests
+		server.Health.SetDraining()
+		time.Sleep(cfg.Server.DrainDelay)
+		if err := server.ShutdownWithTimeout(cfg.Server.ShutdownTimeout); err != nil {
+			logger.Warn("server did not drain cleanly", slog.Any("error", err))
+		}
 	}
 
-	log.Printf("🚀 LinkSprint server starting on port %s", port)
-	log.Printf("📊 Health check: http://localhost:%s/health", port)
-	log.Printf("🔗 API docs: http://localhost:%s/api/v1", port)
+	// Flush background work before closing the database and Redis
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Clicks.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("click queue not fully flushed", slog.Any("error", err))
+	}
+	stopRollup()
+	if err := server.Analytics.FlushClickCounters(shutdownCtx); err != nil {
+		logger.Warn("final click counter flush failed", slog.Any("error", err))
+	}
+	if err := server.Usage.Rollup(shutdownCtx); err != nil {
+		logger.Warn("final usage rollup failed", slog.Any("error", err))
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Warn("failed to flush traces", slog.Any("error", err))
+	}
+	logger.Info("LinkSprint stopped")
+}
 
-	if err := app.Listen(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+// reloadOnSIGHUP reloads the configuration on SIGHUP, applying the new rate
+// limits, blocklist and logging. An invalid configuration keeps the current
+// one.
+func reloadOnSIGHUP(live *config.Live) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		next, err := config.Load(os.Args[1:])
+		if err != nil {
+			logger.Warn("configuration not reloaded", slog.Any("error", err))
+			continue
+		}
+		ignored := live.Reload(next)
+		if err := setupLogging(next.Logging); err != nil {
+			logger.Warn("logging not reloaded", slog.Any("error", err))
+		}
+		logger.Info("configuration reloaded: rate limits, blocklist and logging updated")
+		if len(ignored) > 0 {
+			logger.Warn("some changes need a restart to apply", slog.String("sections", strings.Join(ignored, ", ")))
+		}
 	}
-} 
\ No newline at end of file
+}
+
+// setupLogging applies the logging configuration
+func setupLogging(cfg config.LoggingConfig) error {
+	return logging.Setup(logging.Options{
+		Format: cfg.Format,
+		Level:  cfg.Level,
+		Levels: cfg.Levels,
+	})
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	logger.Error(msg, slog.Any("error", err))
+	os.Exit(1)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"linksprint/internal/config"
+	"linksprint/internal/database"
+	"linksprint/internal/services"
+)
+
+const setPlanUsage = `usage: linksprint set-plan <workspace id> <plan> [flags]
+
+Moves a workspace to a plan (free, team or enterprise); the change is
+recorded in the workspace's audit log. Flags are those of the server, such
+as --config and --database-url.
+`
+
+// runSetPlan moves a workspace to another plan and returns the process exit
+// code
+func runSetPlan(args []string) int {
+	if len(args) < 2 {
+		fmt.Fprint(os.Stderr, setPlanUsage)
+		return 2
+	}
+	workspaceID, plan, args := args[0], args[1], args[2:]
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load configuration: %v\n", err)
+		return 1
+	}
+	if err := setupLogging(cfg.Logging); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to set up logging: %v\n", err)
+		return 1
+	}
+
+	db, err := database.NewConnection(cfg.Database.URL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := migrator.Check(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "run `linksprint migrate up` first: %v\n", err)
+		return 1
+	}
+
+	workspace, err := services.NewWorkspaceService(db).SetPlan(ctx, nil, workspaceID, plan)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Printf("workspace %s (%s) is on the %s plan\n", workspace.ID, workspace.Name, workspace.Plan)
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"linksprint/internal/config"
+	"linksprint/internal/database"
+	"linksprint/internal/redis"
+	"linksprint/internal/services"
+)
+
+// runReconcileClicks rebuilds the click counter and the daily visitors of
+// every link from the recorded clicks and returns the process exit code.
+// Flags are those of the server.
+func runReconcileClicks(args []string) int {
+	cfg, err := config.Load(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load configuration: %v\n", err)
+		return 1
+	}
+	if err := setupLogging(cfg.Logging); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to set up logging: %v\n", err)
+		return 1
+	}
+
+	db, err := database.NewConnection(cfg.Database.URL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	// Pending counts of an in-process Redis die with its server, which
+	// flushes all but those of the last minute on shutdown
+	var redisClient *redis.Client
+	if cfg.Redis.URL == config.InProcessRedis {
+		redisClient, err = redis.NewInProcess(redis.Options{})
+	} else {
+		redisClient, err = redis.NewClient(cfg.Redis.URL)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to Redis: %v\n", err)
+		return 1
+	}
+	defer redisClient.Close()
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := migrator.Check(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "run `linksprint migrate up` first: %v\n", err)
+		return 1
+	}
+
+	analytics := services.NewAnalyticsService(services.NewStores(db, redisClient), nil, cfg.VisitorKey())
+	links, err := analytics.ReconcileClickCounters(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Printf("rebuilt the click counters of %d links\n", links)
+	days, err := analytics.RebuildVisitors(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Printf("rebuilt %d days of link visitors\n", days)
+	return 0
+}
@@ -0,0 +1,187 @@
+// Package app assembles the LinkSprint HTTP application from its
+// dependencies. The server runs it on a listener; tests drive it in process
+// with fiber's App.Test.
+package app
+
+import (
+	"context"
+
+	"linksprint/internal/clientip"
+	"linksprint/internal/config"
+	"linksprint/internal/database"
+	"linksprint/internal/handlers"
+	"linksprint/internal/middleware"
+	"linksprint/internal/redis"
+	"linksprint/internal/routes"
+	"linksprint/internal/services"
+	"linksprint/internal/store"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Deps are what the application runs on
+type Deps struct {
+	Config *config.Live
+	// DB keeps accounts, workspaces, API keys, usage and the audit log
+	DB *database.DB
+	// Redis backs rate limits, usage counters and token revocation
+	Redis *redis.Client
+	// Stores keep links, clicks and the link cache; the zero value keeps
+	// them in DB and Redis, with the hottest links also cached in process
+	// and unknown short codes filtered out
+	Stores services.Stores
+	// ClientIPs resolves client addresses; nil builds a resolver from the
+	// proxy configuration
+	ClientIPs *clientip.Resolver
+}
+
+// App is the HTTP application together with the background work the caller
+// runs and shuts down
+type App struct {
+	*fiber.App
+	// Clicks records redirect clicks in the background
+	Clicks *services.ClickPipeline
+	// Usage rolls usage counters up to the database
+	Usage *services.UsageService
+	// Analytics flushes click counters to the database
+	Analytics *services.AnalyticsService
+	// Health serves the probes and is told when the server drains
+	Health *handlers.HealthHandler
+
+	cache  *store.TieredCache
+	filter *store.BloomFilter
+}
+
+// New builds the application with its middleware, services and routes
+func New(deps Deps) (*App, error) {
+	live := deps.Config
+	cfg := live.Config()
+	db, redisClient := deps.DB, deps.Redis
+
+	// Resolve client IPs behind the trusted reverse proxies
+	clientIPs := deps.ClientIPs
+	if clientIPs == nil {
+		var err error
+		clientIPs, err = clientip.New(cfg.Proxy.TrustedProxies, cfg.Proxy.ClientIPHeader)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Keep the hottest links in process too, in front of Redis, and rule
+	// out unknown short codes with a filter built from the links in the
+	// background
+	var (
+		tiered *store.TieredCache
+		filter *store.BloomFilter
+	)
+	stores := deps.Stores
+	if stores == (services.Stores{}) {
+		stores = services.NewStores(db, redisClient)
+		if cfg.Redis.LocalCacheSize > 0 {
+			tiered = store.NewTieredCache(redisClient, cfg.Redis.LocalCacheSize, cfg.Redis.LocalCacheTTL)
+			stores.Cache = tiered
+		}
+		if cfg.Redis.BloomFilterCapacity > 0 {
+			filter = store.NewBloomFilter(stores.URLs, redisClient, cfg.Redis.BloomFilterCapacity)
+			stores.Filter = filter
+		}
+	}
+
+	// Create Fiber app
+	app := fiber.New(fiber.Config{
+		AppName:      "LinkSprint",
+		ServerHeader: "LinkSprint",
+		ErrorHandler: handlers.ErrorHandler,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	})
+
+	// Middleware
+	app.Use(recover.New())
+	app.Use(middleware.Tracing())
+	app.Use(middleware.Metrics())
+	app.Use(middleware.RequestID())
+	app.Use(middleware.ResolveClientIP(clientIPs))
+	app.Use(middleware.Blocklist(live.Blocklist))
+	app.Use(middleware.RequestContext())
+	app.Use(middleware.SecurityHeaders())
+	app.Use(middleware.AccessLog(func() map[string]float64 {
+		return map[string]float64{routes.RedirectRoute: live.Logging().RedirectSampleRate}
+	}))
+	app.Use(cors.New(cors.Config{
+		AllowOrigins:  "*",
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, X-Workspace-ID",
+		AllowMethods:  "GET, POST, PUT, PATCH, DELETE, OPTIONS",
+		ExposeHeaders: "X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After",
+	}))
+
+	// Initialize services shared by handlers and middleware
+	authService := services.NewAuthService(db, redisClient, cfg)
+	apiKeyService := services.NewAPIKeyService(db)
+	workspaceService := services.NewWorkspaceService(db)
+	auditService := services.NewAuditService(db)
+	usageService := services.NewUsageService(db, redisClient)
+	urlService := services.NewURLService(stores, usageService, live)
+	analyticsService := services.NewAnalyticsService(stores, usageService, cfg.VisitorKey())
+
+	// Record redirect clicks in the background; the queue is drained on
+	// shutdown
+	clickPipeline := services.NewClickPipeline(analyticsService, cfg.Clicks.Workers, cfg.Clicks.Buffer)
+
+	// Health probes: the database is required, while without Redis the
+	// service keeps running degraded
+	healthHandler := handlers.NewHealthHandler(cfg.Server.HealthCheckTimeout,
+		handlers.HealthCheck{Name: "database", Critical: true, Check: db.PingContext},
+		handlers.HealthCheck{Name: "redis", Check: func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		}},
+	)
+
+	// Setup routes
+	routes.SetupRoutes(app, routes.Handlers{
+		URL:              handlers.NewURLHandler(urlService, live, clickPipeline),
+		Analytics:        handlers.NewAnalyticsHandler(analyticsService),
+		Auth:             handlers.NewAuthHandler(authService),
+		APIKeys:          handlers.NewAPIKeyHandler(apiKeyService),
+		Workspaces:       handlers.NewWorkspaceHandler(workspaceService),
+		Audit:            handlers.NewAuditHandler(auditService),
+		Usage:            handlers.NewUsageHandler(usageService),
+		Health:           healthHandler,
+		Metrics:          adaptor.HTTPHandler(promhttp.Handler()),
+		RequireAuth:      middleware.RequireAuth(authService, apiKeyService),
+		ResolveWorkspace: middleware.ResolveWorkspace(workspaceService),
+		RateLimit: func(policy string) fiber.Handler {
+			return middleware.RateLimit(redisClient, policy, live.RateLimit)
+		},
+		ChargeNotFound: func(policy string) fiber.Handler {
+			return middleware.ChargeNotFound(redisClient, policy, live.RateLimit, live.NotFoundCost)
+		},
+	})
+
+	return &App{
+		App:       app,
+		Clicks:    clickPipeline,
+		Usage:     usageService,
+		Analytics: analyticsService,
+		Health:    healthHandler,
+		cache:     tiered,
+		filter:    filter,
+	}, nil
+}
+
+// Close stops the background work that needs no draining, such as listening
+// for cache invalidations and building the link filter
+func (a *App) Close() {
+	if a.cache != nil {
+		a.cache.Close()
+	}
+	if a.filter != nil {
+		a.filter.Close()
+	}
+}
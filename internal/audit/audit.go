@@ -0,0 +1,136 @@
+// Package audit records administrative actions in the append-only
+// audit_events table. Events are written in the same transaction as the
+// change they describe, so a change is never committed without its event.
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"linksprint/internal/models"
+)
+
+// Request carries the metadata of the HTTP request an action was made in
+type Request struct {
+	IPAddress string
+	RequestID string
+}
+
+type requestKey struct{}
+
+// WithRequest returns a copy of ctx carrying the request metadata
+func WithRequest(ctx context.Context, req Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, req)
+}
+
+// RequestFrom returns the request metadata stored in ctx, if any
+func RequestFrom(ctx context.Context) Request {
+	req, _ := ctx.Value(requestKey{}).(Request)
+	return req
+}
+
+// Event describes one administrative action. Before and After are snapshots
+// of the target; only the fields that differ between them are stored.
+// Before is nil for creations and After is nil for deletions.
+type Event struct {
+	WorkspaceID string
+	Action      string
+	TargetType  string
+	TargetID    string
+	Before      interface{}
+	After       interface{}
+}
+
+// Record appends an event performed by principal within tx
+func Record(ctx context.Context, tx *sql.Tx, principal *models.Principal, event Event) error {
+	before, after, err := Diff(event.Before, event.After)
+	if err != nil {
+		return fmt.Errorf("failed to diff audit snapshots: %w", err)
+	}
+
+	var actorUserID, actorAPIKeyID string
+	workspaceID := event.WorkspaceID
+	if principal != nil {
+		actorUserID = principal.UserID
+		actorAPIKeyID = principal.APIKeyID
+		if workspaceID == "" {
+			workspaceID = principal.WorkspaceID
+		}
+	}
+	req := RequestFrom(ctx)
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO audit_events (workspace_id, actor_user_id, actor_api_key_id, action, target_type, target_id,
+			before_state, after_state, ip_address, request_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, nullString(workspaceID), nullString(actorUserID), nullString(actorAPIKeyID), event.Action, event.TargetType, event.TargetID,
+		before, after, nullString(req.IPAddress), nullString(req.RequestID), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+// Diff returns the JSON of the fields that differ between two snapshots; a
+// nil snapshot yields NULL and leaves the other one whole
+func Diff(before, after interface{}) (sql.NullString, sql.NullString, error) {
+	var none sql.NullString
+	beforeFields, err := fields(before)
+	if err != nil {
+		return none, none, err
+	}
+	afterFields, err := fields(after)
+	if err != nil {
+		return none, none, err
+	}
+
+	if beforeFields != nil && afterFields != nil {
+		for key, value := range beforeFields {
+			if other, ok := afterFields[key]; ok && reflect.DeepEqual(value, other) {
+				delete(beforeFields, key)
+				delete(afterFields, key)
+			}
+		}
+	}
+
+	beforeJSON, err := marshal(beforeFields)
+	if err != nil {
+		return none, none, err
+	}
+	afterJSON, err := marshal(afterFields)
+	if err != nil {
+		return none, none, err
+	}
+	return beforeJSON, afterJSON, nil
+}
+
+func fields(snapshot interface{}) (map[string]interface{}, error) {
+	if value := reflect.ValueOf(snapshot); !value.IsValid() || value.Kind() == reflect.Ptr && value.IsNil() {
+		return nil, nil
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func marshal(fields map[string]interface{}) (sql.NullString, error) {
+	if fields == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(fields)
+	return sql.NullString{String: string(data), Valid: err == nil}, err
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
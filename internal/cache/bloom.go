@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// Bloom is a Bloom filter: a set that answers "maybe" for every member and
+// "no" for most non-members. Its bits use the layout of Redis bitmaps, the
+// first bit being the high bit of the first byte, so they can be merged
+// with SETBIT and BITOP. It is safe for concurrent use.
+type Bloom struct {
+	mu     sync.RWMutex
+	bits   []byte
+	size   uint64
+	hashes int
+}
+
+// NewBloom creates a filter sized for capacity members with the given false
+// positive rate
+func NewBloom(capacity int, falsePositiveRate float64) *Bloom {
+	n := math.Max(float64(capacity), 1)
+	size := uint64(math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := int(math.Max(1, math.Round(float64(size)/n*math.Ln2)))
+	return &Bloom{
+		bits:   make([]byte, (size+7)/8),
+		size:   size,
+		hashes: hashes,
+	}
+}
+
+// Size returns the number of bits of the filter
+func (b *Bloom) Size() uint64 {
+	return b.size
+}
+
+// Hashes returns the number of bits set per member
+func (b *Bloom) Hashes() int {
+	return b.hashes
+}
+
+// Positions returns the bits set for key, using double hashing over FNV-1a
+func (b *Bloom) Positions(key string) []uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&math.MaxUint32, sum>>32|1
+
+	positions := make([]uint64, b.hashes)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % b.size
+	}
+	return positions
+}
+
+// Add adds key to the filter
+func (b *Bloom) Add(key string) {
+	b.Set(b.Positions(key))
+}
+
+// Set sets the given bits
+func (b *Bloom) Set(positions []uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, p := range positions {
+		b.bits[p/8] |= 0x80 >> (p % 8)
+	}
+}
+
+// Test reports whether key may be in the filter
+func (b *Bloom) Test(key string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, p := range b.Positions(key) {
+		if b.bits[p/8]&(0x80>>(p%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge adds the members of other, a filter of the same size
+func (b *Bloom) Merge(other *Bloom) {
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := range b.bits {
+		b.bits[i] |= other.bits[i]
+	}
+}
+
+// Bytes returns a copy of the bits
+func (b *Bloom) Bytes() []byte {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return append([]byte(nil), b.bits...)
+}
@@ -0,0 +1,185 @@
+// Package clientip resolves the address of the client behind trusted
+// reverse proxies.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// proxyHeaderTimeout bounds how long a connection may take to send its
+// PROXY protocol header
+const proxyHeaderTimeout = 10 * time.Second
+
+// Headers a client IP can be read from
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderXRealIP       = "X-Real-IP"
+	HeaderForwarded     = "Forwarded"
+)
+
+// Resolver picks the client IP of a request. Forwarding headers are only
+// believed when the request comes from a trusted proxy, and in chains the
+// client is the nearest address that is not a trusted proxy, so clients
+// cannot spoof their address by sending the header themselves.
+type Resolver struct {
+	trusted []*net.IPNet
+	header  string
+}
+
+// New creates a resolver trusting the given proxies, written as CIDRs or
+// single addresses, and reading the given header. An empty header disables
+// header parsing.
+func New(trustedProxies []string, header string) (*Resolver, error) {
+	trusted, err := ParseNetworks(trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+
+	switch strings.ToLower(header) {
+	case "", "none":
+		header = ""
+	case strings.ToLower(HeaderXForwardedFor):
+		header = HeaderXForwardedFor
+	case strings.ToLower(HeaderXRealIP):
+		header = HeaderXRealIP
+	case strings.ToLower(HeaderForwarded):
+		header = HeaderForwarded
+	default:
+		return nil, fmt.Errorf("unsupported client IP header %q", header)
+	}
+
+	return &Resolver{trusted: trusted, header: header}, nil
+}
+
+// ParseNetworks parses CIDRs and single addresses, which become /32 or /128
+// networks
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Header returns the header the resolver reads, or "" if it reads none
+func (r *Resolver) Header() string {
+	return r.header
+}
+
+// Trusted reports whether ip belongs to a trusted proxy
+func (r *Resolver) Trusted(ip net.IP) bool {
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the client IP of a request received from remote, reading
+// headers through get
+func (r *Resolver) Resolve(remote net.IP, get func(header string) string) string {
+	if r.header == "" || !r.Trusted(remote) {
+		return remote.String()
+	}
+
+	value := get(r.header)
+	if value == "" {
+		return remote.String()
+	}
+
+	var chain []string
+	switch r.header {
+	case HeaderXRealIP:
+		chain = []string{value}
+	case HeaderXForwardedFor:
+		chain = strings.Split(value, ",")
+	case HeaderForwarded:
+		chain = forwardedFor(value)
+	}
+
+	// Walk the chain from the nearest hop back towards the client, stopping
+	// at the first address that is not a trusted proxy
+	client := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseAddress(chain[i])
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !r.Trusted(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// ProxyProtocolListener wraps ln to accept the PROXY protocol from trusted
+// proxies, so connections carry the client's address. Headers sent by other
+// peers are ignored.
+func (r *Resolver) ProxyProtocolListener(ln net.Listener) net.Listener {
+	return &proxyproto.Listener{
+		Listener: ln,
+		Policy: func(upstream net.Addr) (proxyproto.Policy, error) {
+			if addr, ok := upstream.(*net.TCPAddr); ok && r.Trusted(addr.IP) {
+				return proxyproto.USE, nil
+			}
+			return proxyproto.IGNORE, nil
+		},
+		ReadHeaderTimeout: proxyHeaderTimeout,
+	}
+}
+
+// forwardedFor returns the for= addresses of an RFC 7239 Forwarded header,
+// nearest hop last
+func forwardedFor(value string) []string {
+	var addresses []string
+	for _, element := range strings.Split(value, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				addresses = append(addresses, val)
+			}
+		}
+	}
+	return addresses
+}
+
+// parseAddress parses an address as found in forwarding headers, which may
+// be quoted, bracketed and carry a port. Obfuscated identifiers and
+// "unknown" yield nil.
+func parseAddress(value string) net.IP {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if ip := net.ParseIP(value); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.Trim(value, "[]"))
+}
@@ -1,35 +1,578 @@
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"linksprint/internal/clientip"
+	"linksprint/internal/logging"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
-// Config holds all configuration for the application
+// defaultJWTSecret is the development signing secret, which is refused in
+// production
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
+// InProcessRedis is the Redis URL selecting a Redis server run inside the
+// process, the default with SQLite storage; see redis.NewInProcess
+const InProcessRedis = "memory"
+
+// Config holds all configuration for the application. It is layered:
+// defaults, then the config file, then environment variables, then flags.
 type Config struct {
-	Port        string
-	Environment string
-	DatabaseURL string
-	RedisURL    string
-	JWTSecret   string
+	Environment string `yaml:"env" toml:"env"`
+
+	Server   ServerConfig   `yaml:"server" toml:"server"`
+	Database DatabaseConfig `yaml:"database" toml:"database"`
+	Redis    RedisConfig    `yaml:"redis" toml:"redis"`
+	Auth     AuthConfig     `yaml:"auth" toml:"auth"`
+	Proxy    ProxyConfig    `yaml:"proxy" toml:"proxy"`
+	Clicks   ClicksConfig   `yaml:"clicks" toml:"clicks"`
+	Tracing  TracingConfig  `yaml:"tracing" toml:"tracing"`
+	Features Features       `yaml:"features" toml:"features"`
+
+	// RateLimits holds the rate limit policies by name; see RateLimitPolicies.
+	// They are reloaded on SIGHUP.
+	RateLimits map[string]RateLimit `yaml:"rate_limits" toml:"rate_limits"`
+	// NotFoundCost is how many requests a redirect answered with 404 counts
+	// as against the redirect rate limit, slowing down clients scanning for
+	// short codes. It is reloaded on SIGHUP.
+	NotFoundCost int `yaml:"rate_limit_not_found_cost" toml:"rate_limit_not_found_cost"`
+	// Blocklist is reloaded on SIGHUP
+	Blocklist Blocklist `yaml:"blocklist" toml:"blocklist"`
+	// Logging is reloaded on SIGHUP
+	Logging LoggingConfig `yaml:"logging" toml:"logging"`
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Port string `yaml:"port" toml:"port"`
+	// BaseURL is the public origin short links are served from
+	BaseURL      string        `yaml:"base_url" toml:"base_url"`
+	ReadTimeout  time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	// DrainDelay is how long the server keeps serving after a shutdown
+	// signal while /readyz fails, so load balancers can take it out
+	DrainDelay time.Duration `yaml:"drain_delay" toml:"drain_delay"`
+	// ShutdownTimeout bounds how long in-flight requests and queued clicks
+	// are waited for on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// HealthCheckTimeout bounds each dependency check of /readyz
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout" toml:"health_check_timeout"`
+}
+
+// DatabaseConfig configures the database connection pool
+type DatabaseConfig struct {
+	// URL is a CockroachDB or PostgreSQL connection URL, or sqlite:<file>
+	URL             string        `yaml:"url" toml:"url"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+}
+
+// IsSQLite reports whether the database is a SQLite file
+func (d DatabaseConfig) IsSQLite() bool {
+	return strings.HasPrefix(d.URL, "sqlite:")
+}
+
+// RedisConfig configures the Redis connection pool and cache
+type RedisConfig struct {
+	// URL is a Redis connection URL, or InProcessRedis
+	URL      string `yaml:"url" toml:"url"`
+	PoolSize int    `yaml:"pool_size" toml:"pool_size"`
+	// URLCacheTTL is how long resolved links stay cached
+	URLCacheTTL time.Duration `yaml:"url_cache_ttl" toml:"url_cache_ttl"`
+	// URLStaleTTL is how long links stay cached past URLCacheTTL, served
+	// while they are looked up again in the background, and for as long as
+	// the database is down; 0 turns stale-while-revalidate off
+	URLStaleTTL time.Duration `yaml:"url_stale_ttl" toml:"url_stale_ttl"`
+	// LocalCacheSize is how many links each instance also caches in
+	// process, in front of Redis; 0 turns the local cache off
+	LocalCacheSize int `yaml:"local_cache_size" toml:"local_cache_size"`
+	// LocalCacheTTL is how long links stay cached in process at most
+	LocalCacheTTL time.Duration `yaml:"local_cache_ttl" toml:"local_cache_ttl"`
+	// NotFoundCacheTTL is how long short codes resolving to no link stay
+	// cached; 0 turns negative caching off
+	NotFoundCacheTTL time.Duration `yaml:"not_found_cache_ttl" toml:"not_found_cache_ttl"`
+	// BloomFilterCapacity sizes the Bloom filter of existing links that
+	// rules out unknown short codes, for a 1% false positive rate; 0 turns
+	// the filter off
+	BloomFilterCapacity int `yaml:"bloom_filter_capacity" toml:"bloom_filter_capacity"`
+}
+
+// AuthConfig configures token signing
+type AuthConfig struct {
+	JWTSecret       string        `yaml:"jwt_secret" toml:"jwt_secret"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl"`
+	// RevocationFailOpen accepts access tokens when Redis cannot tell
+	// whether they were revoked by a logout; by default they are refused
+	// with 503 Service Unavailable until Redis is back
+	RevocationFailOpen bool `yaml:"revocation_fail_open" toml:"revocation_fail_open"`
+}
+
+// ProxyConfig configures how client IPs are resolved behind reverse proxies
+type ProxyConfig struct {
+	// TrustedProxies lists the CIDRs or addresses of the reverse proxies
+	// whose forwarding headers and PROXY protocol headers are believed
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+	// ClientIPHeader is the header trusted proxies pass the client IP in:
+	// X-Forwarded-For, X-Real-IP, Forwarded, or none
+	ClientIPHeader string `yaml:"client_ip_header" toml:"client_ip_header"`
+	// ProxyProtocol makes the server accept the PROXY protocol from trusted
+	// proxies
+	ProxyProtocol bool `yaml:"proxy_protocol" toml:"proxy_protocol"`
+}
+
+// ClicksConfig configures click recording and usage metering
+type ClicksConfig struct {
+	// Workers and Buffer size the background pipeline recording redirect
+	// clicks; clicks are dropped when the buffer is full
+	Workers int `yaml:"workers" toml:"workers"`
+	Buffer  int `yaml:"buffer" toml:"buffer"`
+	// UsageRollupInterval is how often usage counters are copied from Redis
+	// to the database
+	UsageRollupInterval time.Duration `yaml:"usage_rollup_interval" toml:"usage_rollup_interval"`
+	// CounterFlushInterval is how often click counts are moved from Redis
+	// to the database
+	CounterFlushInterval time.Duration `yaml:"counter_flush_interval" toml:"counter_flush_interval"`
+	// RollupInterval is how often complete hours of clicks are rolled up
+	// into the hourly and daily click rollups
+	RollupInterval time.Duration `yaml:"rollup_interval" toml:"rollup_interval"`
+	// VisitorCookie sets a first-party cookie on redirects identifying the
+	// visitor, so unique visitors are counted across IP addresses
+	VisitorCookie bool `yaml:"visitor_cookie" toml:"visitor_cookie"`
+	// VisitorSalt keys the hash identifying visitors without a cookie by
+	// IP address and user agent; empty uses the JWT secret
+	VisitorSalt string `yaml:"visitor_salt" toml:"visitor_salt"`
+}
+
+// TracingConfig configures OpenTelemetry tracing
+type TracingConfig struct {
+	// Exporter is none, otlp, stdout or file
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	// Endpoint is the OTLP/HTTP collector URL, such as
+	// http://localhost:4318; empty uses the OTEL_EXPORTER_OTLP_* variables
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+	// File receives spans, one JSON object per line, with the file exporter
+	File string `yaml:"file" toml:"file"`
+	// SampleRatio is the share of new traces recorded, from 0 to 1. Requests
+	// whose caller sampled the trace are always recorded.
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// LoggingConfig configures structured logging
+type LoggingConfig struct {
+	// Format is json or text
+	Format string `yaml:"format" toml:"format"`
+	// Level is the minimum level logged: debug, info, warn or error
+	Level string `yaml:"level" toml:"level"`
+	// Levels overrides Level by package, such as services: debug
+	Levels map[string]string `yaml:"levels" toml:"levels"`
+	// RedirectSampleRate is the share of successful redirects written to the
+	// access log, from 0 to 1; failed requests are always logged
+	RedirectSampleRate float64 `yaml:"redirect_sample_rate" toml:"redirect_sample_rate"`
+}
+
+// Features toggles optional behaviour
+type Features struct {
+	// PerDomainShortCodes makes custom short codes unique per workspace
+	// domain instead of globally
+	PerDomainShortCodes bool `yaml:"per_domain_short_codes" toml:"per_domain_short_codes"`
+	// Registration allows anyone to sign up
+	Registration bool `yaml:"registration" toml:"registration"`
+	// ClickTracking records redirect clicks for analytics
+	ClickTracking bool `yaml:"click_tracking" toml:"click_tracking"`
+}
+
+// RateLimit allows Limit requests per Period; a zero Limit disables it
+type RateLimit struct {
+	Limit  int
+	Period time.Duration
 }
 
-// Load loads configuration from environment variables
-func Load() *Config {
+// RateLimitPolicies lists the rate limit policies with their defaults. Each
+// can be overridden with RATE_LIMIT_<NAME>, e.g. RATE_LIMIT_CREATE=30/1m.
+var RateLimitPolicies = map[string]RateLimit{
+	"api_ip":    {Limit: 1200, Period: time.Minute}, // any API request, per IP, before authentication
+	"api":       {Limit: 600, Period: time.Minute},  // authenticated API requests, per API key or user
+	"auth":      {Limit: 20, Period: time.Minute},   // login and registration, per IP
+	"redirect":  {Limit: 300, Period: time.Minute},  // redirects, per IP
+	"create":    {Limit: 60, Period: time.Minute},   // link creation, per API key or user
+	"analytics": {Limit: 120, Period: time.Minute},  // analytics reads, per API key or user
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	rateLimits := make(map[string]RateLimit, len(RateLimitPolicies))
+	for name, policy := range RateLimitPolicies {
+		rateLimits[name] = policy
+	}
+
 	return &Config{
-		Port:        getEnv("PORT", "8080"),
-		Environment: getEnv("ENV", "development"),
-		DatabaseURL: getEnv("COCKROACHDB_URL", "postgresql://root@localhost:26257/linksprint?sslmode=disable"),
-		RedisURL:    getEnv("REDIS_URL", "localhost:6379"),
-		JWTSecret:   getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+		Environment: "development",
+		Server: ServerConfig{
+			Port:         "8080",
+			BaseURL:      "http://localhost:8080",
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+			IdleTimeout:  2 * time.Minute,
+
+			DrainDelay:         5 * time.Second,
+			ShutdownTimeout:    30 * time.Second,
+			HealthCheckTimeout: 2 * time.Second,
+		},
+		Database: DatabaseConfig{
+			URL:             "postgresql://root@localhost:26257/linksprint?sslmode=disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Redis: RedisConfig{
+			URL:         "localhost:6379",
+			PoolSize:    0,
+			URLCacheTTL: 24 * time.Hour,
+			URLStaleTTL: time.Hour,
+
+			LocalCacheSize: 10000,
+			LocalCacheTTL:  time.Minute,
+
+			NotFoundCacheTTL:    30 * time.Second,
+			BloomFilterCapacity: 1000000,
+		},
+		Auth: AuthConfig{
+			JWTSecret:       defaultJWTSecret,
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Proxy: ProxyConfig{
+			ClientIPHeader: clientip.HeaderXForwardedFor,
+		},
+		Clicks: ClicksConfig{
+			Workers:              4,
+			Buffer:               10000,
+			UsageRollupInterval:  time.Hour,
+			CounterFlushInterval: 10 * time.Second,
+			RollupInterval:       time.Minute,
+			VisitorCookie:        true,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			File:        "traces.jsonl",
+			SampleRatio: 1,
+		},
+		Logging: LoggingConfig{
+			Format:             logging.FormatJSON,
+			Level:              "info",
+			RedirectSampleRate: 1,
+		},
+		Features: Features{
+			Registration:  true,
+			ClickTracking: true,
+		},
+		RateLimits:   rateLimits,
+		NotFoundCost: 10,
+	}
+}
+
+// Load builds the configuration from the defaults, the config file named by
+// --config or CONFIG_FILE, environment variables and the command line flags
+// in args, and validates it
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet("linksprint", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	port := flags.String("port", "", "port to listen on")
+	env := flags.String("env", "", "environment: development, staging or production")
+	baseURL := flags.String("base-url", "", "public origin of short links")
+	databaseURL := flags.String("database-url", "", "database connection URL")
+	storage := flags.String("storage", "", "database connection URL or sqlite:<file>, like --database-url")
+	redisURL := flags.String("redis-url", "", "Redis connection URL")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Without a Redis URL the default depends on the storage, below
+	cfg.Redis.URL = ""
+
+	if *configFile != "" {
+		if err := loadFile(cfg, *configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := loadEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Server.Port = *port
+		case "env":
+			cfg.Environment = *env
+		case "base-url":
+			cfg.Server.BaseURL = *baseURL
+		case "database-url":
+			cfg.Database.URL = *databaseURL
+		case "storage":
+			cfg.Database.URL = *storage
+		case "redis-url":
+			cfg.Redis.URL = *redisURL
+		}
+	})
+
+	// SQLite storage runs standalone, with Redis in-process
+	if cfg.Redis.URL == "" {
+		cfg.Redis.URL = Default().Redis.URL
+		if cfg.Database.IsSQLite() {
+			cfg.Redis.URL = InProcessRedis
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile overlays a YAML or TOML config file, picked by extension
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	// A file listing some rate limit policies keeps the others' defaults
+	if cfg.RateLimits == nil {
+		cfg.RateLimits = map[string]RateLimit{}
+	}
+	for name, policy := range RateLimitPolicies {
+		if _, ok := cfg.RateLimits[name]; !ok {
+			cfg.RateLimits[name] = policy
+		}
+	}
+	return nil
+}
+
+// loadEnv overlays the environment variables that are set, failing on values
+// that cannot be parsed
+func loadEnv(cfg *Config) error {
+	env := envLoader{}
+
+	env.string(&cfg.Environment, "ENV")
+	env.string(&cfg.Server.Port, "PORT")
+	env.string(&cfg.Server.BaseURL, "BASE_URL")
+	env.duration(&cfg.Server.ReadTimeout, "READ_TIMEOUT")
+	env.duration(&cfg.Server.WriteTimeout, "WRITE_TIMEOUT")
+	env.duration(&cfg.Server.IdleTimeout, "IDLE_TIMEOUT")
+	env.duration(&cfg.Server.DrainDelay, "SHUTDOWN_DRAIN_DELAY")
+	env.duration(&cfg.Server.ShutdownTimeout, "SHUTDOWN_TIMEOUT")
+	env.duration(&cfg.Server.HealthCheckTimeout, "HEALTH_CHECK_TIMEOUT")
+
+	env.string(&cfg.Database.URL, "COCKROACHDB_URL")
+	env.string(&cfg.Database.URL, "STORAGE")
+	env.int(&cfg.Database.MaxOpenConns, "DB_MAX_OPEN_CONNS")
+	env.int(&cfg.Database.MaxIdleConns, "DB_MAX_IDLE_CONNS")
+	env.duration(&cfg.Database.ConnMaxLifetime, "DB_CONN_MAX_LIFETIME")
+
+	env.string(&cfg.Redis.URL, "REDIS_URL")
+	env.int(&cfg.Redis.PoolSize, "REDIS_POOL_SIZE")
+	env.duration(&cfg.Redis.URLCacheTTL, "URL_CACHE_TTL")
+	env.duration(&cfg.Redis.URLStaleTTL, "URL_STALE_TTL")
+	env.int(&cfg.Redis.LocalCacheSize, "LOCAL_CACHE_SIZE")
+	env.duration(&cfg.Redis.LocalCacheTTL, "LOCAL_CACHE_TTL")
+	env.duration(&cfg.Redis.NotFoundCacheTTL, "NOT_FOUND_CACHE_TTL")
+	env.int(&cfg.Redis.BloomFilterCapacity, "BLOOM_FILTER_CAPACITY")
+
+	env.string(&cfg.Auth.JWTSecret, "JWT_SECRET")
+	env.duration(&cfg.Auth.AccessTokenTTL, "ACCESS_TOKEN_TTL")
+	env.duration(&cfg.Auth.RefreshTokenTTL, "REFRESH_TOKEN_TTL")
+	env.bool(&cfg.Auth.RevocationFailOpen, "REVOCATION_FAIL_OPEN")
+
+	env.list(&cfg.Proxy.TrustedProxies, "TRUSTED_PROXIES")
+	env.string(&cfg.Proxy.ClientIPHeader, "CLIENT_IP_HEADER")
+	env.bool(&cfg.Proxy.ProxyProtocol, "PROXY_PROTOCOL")
+
+	env.int(&cfg.Clicks.Workers, "CLICK_WORKERS")
+	env.int(&cfg.Clicks.Buffer, "CLICK_BUFFER")
+	env.duration(&cfg.Clicks.UsageRollupInterval, "USAGE_ROLLUP_INTERVAL")
+	env.duration(&cfg.Clicks.CounterFlushInterval, "CLICK_COUNTER_FLUSH_INTERVAL")
+	env.duration(&cfg.Clicks.RollupInterval, "CLICK_ROLLUP_INTERVAL")
+	env.bool(&cfg.Clicks.VisitorCookie, "VISITOR_COOKIE")
+	env.string(&cfg.Clicks.VisitorSalt, "VISITOR_SALT")
+
+	env.string(&cfg.Tracing.Exporter, "TRACING_EXPORTER")
+	env.string(&cfg.Tracing.Endpoint, "TRACING_ENDPOINT")
+	env.string(&cfg.Tracing.File, "TRACING_FILE")
+	env.float(&cfg.Tracing.SampleRatio, "TRACING_SAMPLE_RATIO")
+
+	env.string(&cfg.Logging.Format, "LOG_FORMAT")
+	env.string(&cfg.Logging.Level, "LOG_LEVEL")
+	env.keyValues(&cfg.Logging.Levels, "LOG_LEVELS")
+	env.float(&cfg.Logging.RedirectSampleRate, "LOG_REDIRECT_SAMPLE_RATE")
+
+	env.bool(&cfg.Features.PerDomainShortCodes, "PER_DOMAIN_SHORT_CODES")
+	env.bool(&cfg.Features.Registration, "FEATURE_REGISTRATION")
+	env.bool(&cfg.Features.ClickTracking, "FEATURE_CLICK_TRACKING")
+
+	env.int(&cfg.NotFoundCost, "RATE_LIMIT_NOT_FOUND_COST")
+	for name := range RateLimitPolicies {
+		key := "RATE_LIMIT_" + strings.ToUpper(name)
+		if value := os.Getenv(key); value != "" {
+			limit, err := ParseRateLimit(value)
+			if err != nil {
+				env.errs = append(env.errs, fmt.Errorf("%s: %w", key, err))
+				continue
+			}
+			cfg.RateLimits[name] = limit
+		}
+	}
+
+	env.list(&cfg.Blocklist.IPs, "BLOCKED_IPS")
+	env.list(&cfg.Blocklist.Domains, "BLOCKED_DOMAINS")
+
+	return errors.Join(env.errs...)
+}
+
+// envLoader reads typed environment variables, collecting parse errors
+type envLoader struct {
+	errs []error
+}
+
+func (e *envLoader) string(dst *string, key string) {
+	if value := os.Getenv(key); value != "" {
+		*dst = value
+	}
+}
+
+func (e *envLoader) list(dst *[]string, key string) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	*dst = values
+}
+
+func (e *envLoader) keyValues(dst *map[string]string, key string) {
+	var items []string
+	e.list(&items, key)
+	if items == nil {
+		return
+	}
+	values := make(map[string]string, len(items))
+	for _, item := range items {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok {
+			e.errs = append(e.errs, fmt.Errorf("%s: %q must look like name=value", key, item))
+			return
+		}
+		values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	*dst = values
+}
+
+func (e *envLoader) int(dst *int, key string) {
+	if value := os.Getenv(key); value != "" {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %q is not a whole number", key, value))
+			return
+		}
+		*dst = i
+	}
+}
+
+func (e *envLoader) float(dst *float64, key string) {
+	if value := os.Getenv(key); value != "" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %q is not a number", key, value))
+			return
+		}
+		*dst = f
+	}
+}
+
+func (e *envLoader) bool(dst *bool, key string) {
+	if value := os.Getenv(key); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %q is not true or false", key, value))
+			return
+		}
+		*dst = b
 	}
 }
 
-// getEnv gets an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
+func (e *envLoader) duration(dst *time.Duration, key string) {
 	if value := os.Getenv(key); value != "" {
-		return value
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %q is not a duration such as 15m", key, value))
+			return
+		}
+		*dst = d
+	}
+}
+
+// ParseRateLimit parses a rate limit written as "<limit>/<period>", such as
+// "60/1m"; "0" disables the limit
+func ParseRateLimit(value string) (RateLimit, error) {
+	if value == "0" {
+		return RateLimit{}, nil
+	}
+	limitPart, periodPart, ok := strings.Cut(value, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("rate limit %q must look like 60/1m", value)
+	}
+	limit, err := strconv.Atoi(limitPart)
+	if err != nil || limit < 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q has an invalid limit", value)
+	}
+	period, err := time.ParseDuration(periodPart)
+	if err != nil || period <= 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q has an invalid period", value)
 	}
-	return defaultValue
+	return RateLimit{Limit: limit, Period: period}, nil
+}
+
+// UnmarshalText lets config files write rate limits as "60/1m"
+func (r *RateLimit) UnmarshalText(text []byte) error {
+	limit, err := ParseRateLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*r = limit
+	return nil
 }
 
 // IsDevelopment returns true if the environment is development
@@ -40,4 +583,12 @@ func (c *Config) IsDevelopment() bool {
 // IsProduction returns true if the environment is production
 func (c *Config) IsProduction() bool {
 	return c.Environment == "production"
-} 
\ No newline at end of file
+}
+
+// VisitorKey returns the key of the hash identifying visitors
+func (c *Config) VisitorKey() []byte {
+	if c.Clicks.VisitorSalt != "" {
+		return []byte(c.Clicks.VisitorSalt)
+	}
+	return []byte(c.Auth.JWTSecret)
+}
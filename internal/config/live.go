@@ -0,0 +1,75 @@
+package config
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// Live holds the running configuration. Rate limits, the not found cost,
+// blocklists and logging can be swapped while the server runs; other settings only change on
+// restart.
+type Live struct {
+	current atomic.Pointer[Config]
+}
+
+// NewLive creates a live configuration starting from cfg
+func NewLive(cfg *Config) *Live {
+	l := &Live{}
+	l.current.Store(cfg)
+	return l
+}
+
+// Config returns the current configuration, which must not be modified
+func (l *Live) Config() *Config {
+	return l.current.Load()
+}
+
+// RateLimit returns the current rate limit policy with the given name
+func (l *Live) RateLimit(name string) RateLimit {
+	return l.Config().RateLimits[name]
+}
+
+// NotFoundCost returns how many requests a redirect answered with 404
+// currently counts as
+func (l *Live) NotFoundCost() int {
+	return l.Config().NotFoundCost
+}
+
+// Blocklist returns the current blocklist
+func (l *Live) Blocklist() *Blocklist {
+	return &l.Config().Blocklist
+}
+
+// Logging returns the current logging configuration
+func (l *Live) Logging() LoggingConfig {
+	return l.Config().Logging
+}
+
+// Reload applies the rate limits, not found cost, blocklist and logging of a freshly loaded
+// configuration. It returns the sections whose changes were ignored because
+// they need a restart.
+func (l *Live) Reload(next *Config) []string {
+	current := l.Config()
+
+	updated := *current
+	updated.RateLimits = next.RateLimits
+	updated.NotFoundCost = next.NotFoundCost
+	updated.Blocklist = next.Blocklist
+	updated.Logging = next.Logging
+	l.current.Store(&updated)
+
+	// Compare what was left out, section by section
+	var ignored []string
+	nextValue, currentValue := reflect.ValueOf(*next), reflect.ValueOf(*current)
+	for i := 0; i < nextValue.NumField(); i++ {
+		field := nextValue.Type().Field(i)
+		switch field.Name {
+		case "RateLimits", "NotFoundCost", "Blocklist", "Logging":
+			continue
+		}
+		if !reflect.DeepEqual(nextValue.Field(i).Interface(), currentValue.Field(i).Interface()) {
+			ignored = append(ignored, field.Tag.Get("yaml"))
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"linksprint/internal/clientip"
+	"linksprint/internal/logging"
+)
+
+// minJWTSecretLength is the shortest signing secret accepted in production
+const minJWTSecretLength = 32
+
+// Blocklist rejects client IPs and link destinations
+type Blocklist struct {
+	// IPs lists client CIDRs or addresses whose requests are refused
+	IPs []string `yaml:"ips" toml:"ips"`
+	// Domains lists destination domains, with their subdomains, that cannot
+	// be shortened
+	Domains []string `yaml:"domains" toml:"domains"`
+
+	networks []*net.IPNet
+}
+
+// BlocksIP reports whether requests from ip are refused
+func (b *Blocklist) BlocksIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range b.networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// BlocksDomain reports whether links to host are refused
+func (b *Blocklist) BlocksDomain(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range b.Domains {
+		domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the configuration, reporting every problem at once. In
+// production it also refuses unsafe settings such as the default JWT secret.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	switch c.Environment {
+	case "development", "staging", "production":
+	default:
+		check(false, "env must be development, staging or production, not %q", c.Environment)
+	}
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port < 65536, "server port %q is not a valid port", c.Server.Port)
+	baseURL, err := url.Parse(c.Server.BaseURL)
+	check(err == nil && baseURL.Scheme != "" && baseURL.Host != "", "base URL %q must be an absolute URL", c.Server.BaseURL)
+	check(c.Server.ReadTimeout > 0, "server read timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server write timeout must be positive")
+	check(c.Server.IdleTimeout > 0, "server idle timeout must be positive")
+	check(c.Server.DrainDelay >= 0, "shutdown drain delay cannot be negative")
+	check(c.Server.ShutdownTimeout > 0, "shutdown timeout must be positive")
+	check(c.Server.HealthCheckTimeout > 0, "health check timeout must be positive")
+
+	check(c.Database.URL != "", "database URL is required")
+	check(c.Database.URL != "sqlite:", "SQLite storage needs a file, such as sqlite:./data.db")
+	check(c.Database.MaxOpenConns >= 0, "database max open connections cannot be negative")
+	check(c.Database.MaxIdleConns >= 0, "database max idle connections cannot be negative")
+	check(c.Database.ConnMaxLifetime >= 0, "database connection max lifetime cannot be negative")
+
+	check(c.Redis.URL != "", "Redis URL is required")
+	check(c.Redis.PoolSize >= 0, "Redis pool size cannot be negative")
+	check(c.Redis.URLCacheTTL > 0, "URL cache TTL must be positive")
+	check(c.Redis.URLStaleTTL >= 0, "URL stale TTL cannot be negative")
+	check(c.Redis.LocalCacheSize >= 0, "local cache size cannot be negative")
+	check(c.Redis.LocalCacheSize == 0 || c.Redis.LocalCacheTTL > 0, "local cache TTL must be positive")
+	check(c.Redis.NotFoundCacheTTL >= 0, "not found cache TTL cannot be negative")
+	check(c.Redis.BloomFilterCapacity >= 0, "Bloom filter capacity cannot be negative")
+
+	check(c.Auth.AccessTokenTTL > 0, "access token TTL must be positive")
+	check(c.Auth.RefreshTokenTTL > c.Auth.AccessTokenTTL, "refresh token TTL must be longer than the access token TTL")
+
+	if _, err := clientip.New(c.Proxy.TrustedProxies, c.Proxy.ClientIPHeader); err != nil {
+		errs = append(errs, err)
+	}
+
+	check(c.Clicks.Workers > 0, "click workers must be at least 1")
+	check(c.Clicks.Buffer >= 0, "click buffer cannot be negative")
+	check(c.Clicks.UsageRollupInterval > 0, "usage rollup interval must be positive")
+	check(c.Clicks.CounterFlushInterval > 0, "click counter flush interval must be positive")
+	check(c.Clicks.RollupInterval > 0, "click rollup interval must be positive")
+
+	switch c.Tracing.Exporter {
+	case "none", "otlp", "stdout":
+	case "file":
+		check(c.Tracing.File != "", "tracing file is required with the file exporter")
+	default:
+		check(false, "tracing exporter must be none, otlp, stdout or file, not %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing sample ratio must be between 0 and 1")
+
+	switch c.Logging.Format {
+	case logging.FormatJSON, logging.FormatText:
+	default:
+		check(false, "log format must be json or text, not %q", c.Logging.Format)
+	}
+	if _, err := logging.ParseLevel(c.Logging.Level); err != nil {
+		errs = append(errs, err)
+	}
+	for pkg, level := range c.Logging.Levels {
+		if _, err := logging.ParseLevel(level); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", pkg, err))
+		}
+	}
+	check(c.Logging.RedirectSampleRate >= 0 && c.Logging.RedirectSampleRate <= 1, "redirect log sample rate must be between 0 and 1")
+
+	check(c.NotFoundCost >= 1, "rate limit not found cost must be at least 1")
+	for name := range c.RateLimits {
+		_, known := RateLimitPolicies[name]
+		check(known, "unknown rate limit policy %q", name)
+	}
+
+	networks, err := clientip.ParseNetworks(c.Blocklist.IPs)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("blocklist: %w", err))
+	}
+	c.Blocklist.networks = networks
+
+	if c.IsProduction() {
+		check(c.Auth.JWTSecret != defaultJWTSecret && len(c.Auth.JWTSecret) >= minJWTSecretLength,
+			"JWT_SECRET must be set to a random value of at least %d characters in production", minJWTSecretLength)
+		check(baseURL != nil && baseURL.Scheme == "https", "BASE_URL must use https in production")
+		check(!strings.Contains(c.Database.URL, "sslmode=disable"), "the database URL must not disable TLS (sslmode=disable) in production")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
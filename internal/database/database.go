@@ -1,102 +1,132 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"time"
 
-	_ "github.com/lib/pq"
+	"linksprint/internal/logging"
+
+	"github.com/XSAM/otelsql"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
+// logger is the logger of the database package
+var logger = logging.For("database")
+
 // DB holds the database connection
 type DB struct {
 	*sql.DB
+	// Dialect is the SQL dialect of the server, detected on connect
+	Dialect Dialect
 }
 
-// NewConnection creates a new database connection
+// NewConnection creates a new database connection to CockroachDB or
+// PostgreSQL, detecting which, or opens the SQLite database of a sqlite:
+// URL. Every query is traced with its statement. The schema is managed by
+// migrations; see Migrator.
 func NewConnection(databaseURL string) (*DB, error) {
-	db, err := sql.Open("postgres", databaseURL)
+	db := &DB{}
+	driverName, dsn := "postgres", databaseURL
+	if IsSQLite(databaseURL) {
+		var err error
+		if dsn, err = sqliteDSN(databaseURL); err != nil {
+			return nil, err
+		}
+		driverName, db.Dialect = "sqlite", SQLite
+	}
+
+	sqlDB, err := otelsql.Open(driverName, dsn,
+		otelsql.WithAttributesGetter(func(context.Context, otelsql.Method, string, []driver.NamedValue) []attribute.KeyValue {
+			if db.Dialect == "" {
+				return nil
+			}
+			return []attribute.KeyValue{db.Dialect.system()}
+		}),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	db.DB = sqlDB
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	// Initialize tables
-	if err := initTables(db); err != nil {
-		return nil, fmt.Errorf("failed to initialize tables: %w", err)
+	if db.Dialect == "" {
+		dialect, err := detectDialect(context.Background(), sqlDB)
+		if err != nil {
+			return nil, err
+		}
+		db.Dialect = dialect
 	}
 
-	log.Println("✅ Database connected successfully")
-	return &DB{db}, nil
+	logger.Info("database connected", slog.String("dialect", string(db.Dialect)))
+	return db, nil
 }
 
-// initTables creates the necessary tables if they don't exist
-func initTables(db *sql.DB) error {
-	// Create URLs table
-	urlsTable := `
-	CREATE TABLE IF NOT EXISTS urls (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		short_code VARCHAR(10) UNIQUE NOT NULL,
-		original_url TEXT NOT NULL,
-		title VARCHAR(255),
-		description TEXT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		created_by VARCHAR(100),
-		is_active BOOLEAN DEFAULT true,
-		expires_at TIMESTAMP,
-		INDEX idx_short_code (short_code),
-		INDEX idx_created_at (created_at)
-	);`
+// Close closes the database connection
+func (db *DB) Close() error {
+	return db.DB.Close()
+}
 
-	// Create analytics table
-	analyticsTable := `
-	CREATE TABLE IF NOT EXISTS analytics (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		url_id UUID NOT NULL,
-		short_code VARCHAR(10) NOT NULL,
-		ip_address INET,
-		user_agent TEXT,
-		referer TEXT,
-		country VARCHAR(100),
-		city VARCHAR(100),
-		clicked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		INDEX idx_url_id (url_id),
-		INDEX idx_short_code (short_code),
-		INDEX idx_clicked_at (clicked_at),
-		FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
-	);`
+// IsUniqueViolation reports whether err is a unique constraint violation
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return false
+}
 
-	// Create users table (for future authentication)
-	usersTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		email VARCHAR(255) UNIQUE NOT NULL,
-		password_hash VARCHAR(255) NOT NULL,
-		name VARCHAR(255),
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		is_active BOOLEAN DEFAULT true,
-		INDEX idx_email (email)
-	);`
+// NullTime is sql.NullTime that also scans the text SQLite returns for
+// timestamps it does not know the type of, such as MAX(clicked_at) or
+// DATE(clicked_at)
+type NullTime struct {
+	Time  time.Time
+	Valid bool
+}
 
-	// Execute table creation
-	tables := []string{urlsTable, analyticsTable, usersTable}
-	for _, table := range tables {
-		if _, err := db.Exec(table); err != nil {
-			return fmt.Errorf("failed to create table: %w", err)
+// Scan implements sql.Scanner
+func (t *NullTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*t = NullTime{}
+		return nil
+	case time.Time:
+		*t = NullTime{Time: v, Valid: true}
+		return nil
+	case []byte:
+		return t.Scan(string(v))
+	case string:
+		for _, layout := range []string{SQLiteTimeFormat, "2006-01-02 15:04:05", "2006-01-02"} {
+			if parsed, err := time.Parse(layout, v); err == nil {
+				*t = NullTime{Time: parsed.UTC(), Valid: true}
+				return nil
+			}
 		}
+		return fmt.Errorf("cannot parse %q as a timestamp", v)
 	}
-
-	log.Println("✅ Database tables initialized successfully")
-	return nil
+	return fmt.Errorf("cannot scan %T into NullTime", value)
 }
 
-// Close closes the database connection
-func (db *DB) Close() error {
-	return db.DB.Close()
-} 
\ No newline at end of file
+// Ptr returns the time, or nil if it is NULL
+func (t NullTime) Ptr() *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,172 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// Dialect is the SQL flavour of the connected database. Queries are written
+// in the subset CockroachDB and PostgreSQL share, which SQLite runs with the
+// few PostgreSQL functions registered in sqlite.go; the dialect covers the
+// rest, mostly DDL.
+type Dialect string
+
+// Supported dialects
+const (
+	CockroachDB Dialect = "cockroachdb"
+	PostgreSQL  Dialect = "postgresql"
+	SQLite      Dialect = "sqlite"
+)
+
+// Dialects lists the supported dialects
+var Dialects = []Dialect{CockroachDB, PostgreSQL, SQLite}
+
+// detectDialect asks the server which database it is
+func detectDialect(ctx context.Context, db *sql.DB) (Dialect, error) {
+	var version string
+	if err := db.QueryRowContext(ctx, `SELECT version()`).Scan(&version); err != nil {
+		return "", fmt.Errorf("failed to detect database: %w", err)
+	}
+	switch {
+	case strings.Contains(version, "CockroachDB"):
+		return CockroachDB, nil
+	case strings.HasPrefix(version, "PostgreSQL"):
+		return PostgreSQL, nil
+	}
+	return "", fmt.Errorf("unsupported database %q", version)
+}
+
+// system is the OpenTelemetry db.system of the dialect
+func (d Dialect) system() attribute.KeyValue {
+	switch d {
+	case PostgreSQL:
+		return semconv.DBSystemPostgreSQL
+	case SQLite:
+		return semconv.DBSystemSqlite
+	}
+	return semconv.DBSystemCockroachdb
+}
+
+// TransactionalDDL reports whether schema changes can share a transaction
+// with other statements. CockroachDB applies them asynchronously, after
+// the transaction commits.
+func (d Dialect) TransactionalDDL() bool {
+	return d != CockroachDB
+}
+
+// IndexName returns the name of index name of table. CockroachDB scopes
+// index names to their table while PostgreSQL and SQLite scope them to the
+// schema, so there they are prefixed with the table.
+func (d Dialect) IndexName(table, name string) string {
+	if d != CockroachDB {
+		return table + "_" + name
+	}
+	return name
+}
+
+// DefaultUUID returns the column default generating a random UUID
+func (d Dialect) DefaultUUID() string {
+	if d == SQLite {
+		return "(gen_random_uuid())"
+	}
+	return "gen_random_uuid()"
+}
+
+// DefaultNow returns the column default of the current timestamp. SQLite's
+// CURRENT_TIMESTAMP has no fraction or zone, so it would not sort with the
+// timestamps written by the application.
+func (d Dialect) DefaultNow() string {
+	if d == SQLite {
+		return "(now())"
+	}
+	return "CURRENT_TIMESTAMP"
+}
+
+// AddColumn returns the statement adding a column, such as "plan
+// VARCHAR(32)", to table unless it exists. SQLite has no IF NOT EXISTS
+// there, but its databases never predate the migrations adding columns.
+func (d Dialect) AddColumn(table, column string) string {
+	if d == SQLite {
+		return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, column)
+	}
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s", table, column)
+}
+
+// ForUpdate returns the clause locking the rows a SELECT reads until the
+// transaction ends. SQLite has none; its transactions hold the database
+// write lock from the start.
+func (d Dialect) ForUpdate() string {
+	if d == SQLite {
+		return ""
+	}
+	return "FOR UPDATE"
+}
+
+// CreateIndex returns the statement creating index name on table over
+// columns, such as "created_at DESC, id DESC", unless it exists
+func (d Dialect) CreateIndex(table, name, columns string) string {
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", d.IndexName(table, name), table, columns)
+}
+
+// CreateUniqueIndex is CreateIndex for a unique index
+func (d Dialect) CreateUniqueIndex(table, name, columns string) string {
+	return fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)", d.IndexName(table, name), table, columns)
+}
+
+// DropIndex returns the statement dropping index name of table, if it exists
+func (d Dialect) DropIndex(table, name string) string {
+	if d != CockroachDB {
+		return fmt.Sprintf("DROP INDEX IF EXISTS %s", d.IndexName(table, name))
+	}
+	return fmt.Sprintf("DROP INDEX IF EXISTS %s@%s", table, name)
+}
+
+// DropUniqueConstraint returns the statement dropping a UNIQUE column
+// constraint of table, such as urls_short_code_key, if it exists. SQLite
+// cannot drop constraints, so migrations skip these there.
+func (d Dialect) DropUniqueConstraint(table, name string) string {
+	if d == PostgreSQL {
+		return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s", table, name)
+	}
+	// CockroachDB backs the constraint with an index of the same name
+	return fmt.Sprintf("DROP INDEX IF EXISTS %s@%s CASCADE", table, name)
+}
+
+// Render renders a migration written as a text/template for the dialect.
+// Templates can test {{if .CockroachDB}}, {{if .PostgreSQL}} or
+// {{if .SQLite}}, write column defaults with uuid and now, and call
+// addColumn, createIndex, createUniqueIndex, dropIndex and
+// dropUniqueConstraint. Rendered for CockroachDB, the first migrations are
+// the schema they were written as before the other dialects existed.
+func (d Dialect) Render(sql string) (string, error) {
+	tmpl, err := template.New("migration").Funcs(template.FuncMap{
+		"uuid":                 d.DefaultUUID,
+		"now":                  d.DefaultNow,
+		"addColumn":            d.AddColumn,
+		"createIndex":          d.CreateIndex,
+		"createUniqueIndex":    d.CreateUniqueIndex,
+		"dropIndex":            d.DropIndex,
+		"dropUniqueConstraint": d.DropUniqueConstraint,
+	}).Option("missingkey=error").Parse(sql)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	data := map[string]bool{
+		"CockroachDB": d == CockroachDB,
+		"PostgreSQL":  d == PostgreSQL,
+		"SQLite":      d == SQLite,
+	}
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
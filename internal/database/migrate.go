@@ -0,0 +1,486 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// ErrSchemaBehind is returned by Migrator.Check when migrations are pending
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// ErrMigrationChanged is returned when an applied migration no longer
+// matches the checksum recorded when it was applied
+var ErrMigrationChanged = errors.New("applied migration was changed")
+
+// errLockLost cancels a migration whose lease was taken over by another
+// replica
+var errLockLost = errors.New("lost the migration lock to another replica")
+
+const (
+	// lockLease is how long the migration lock is held before another
+	// replica may take it over, in case its holder died mid-migration. The
+	// holder renews it every lockRenew while migrating.
+	lockLease = 2 * time.Minute
+	// lockRenew is how often the holder renews the migration lock
+	lockRenew = lockLease / 4
+	// lockPoll is how often a replica retries a held migration lock
+	lockPoll = 2 * time.Second
+)
+
+// migrationName matches migration files, such as 0001_initial_schema.up.sql
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change with the SQL applying and
+// reverting it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum returns the SHA-256 of the migration's up SQL, which is recorded
+// when it is applied
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// MigrationStatus is a migration with the time it was applied, if it was
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// appliedMigration is a row of schema_migrations. Checksum is empty for
+// versions applied before checksums were recorded.
+type appliedMigration struct {
+	appliedAt time.Time
+	checksum  string
+}
+
+// Migrations returns the embedded migrations in version order
+func Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s must be named <version>_<name>.(up|down).sql", entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		sql, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(sql)
+		} else {
+			migration.Down = string(sql)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// SplitStatements splits a migration into its statements, which end with a
+// semicolon at the end of a line. Comment lines are dropped.
+func SplitStatements(sql string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+	)
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// Migrator applies and reverts migrations. Applied versions are recorded in
+// schema_migrations, and a lease in schema_migrations_lock makes sure only
+// one replica migrates at a time.
+type Migrator struct {
+	db         *DB
+	migrations []Migration
+	holder     string
+}
+
+// NewMigrator creates a migrator for the embedded migrations
+func NewMigrator(db *DB) (*Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate lock holder: %w", err)
+	}
+	return &Migrator{db: db, migrations: migrations, holder: hex.EncodeToString(id)}, nil
+}
+
+// Up applies every pending migration in order and returns those applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(ctx context.Context) error {
+		done, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(ctx, done); err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			err := m.run(ctx, migration.Up, `
+				INSERT INTO schema_migrations (version, name, applied_at, checksum) VALUES ($1, $2, $3, $4)
+			`, migration.Version, migration.Name, time.Now().UTC(), migration.Checksum())
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			logger.InfoContext(ctx, "migration applied", slog.Int64("version", migration.Version), slog.String("name", migration.Name))
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the latest steps applied migrations and returns those reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(ctx, func(ctx context.Context) error {
+		done, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			err := m.run(ctx, migration.Down, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			logger.InfoContext(ctx, "migration reverted", slog.Int64("version", migration.Version), slog.String("name", migration.Name))
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status returns every known migration with when it was applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureTables(ctx); err != nil {
+		return nil, err
+	}
+	done, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = MigrationStatus{Migration: migration}
+		if applied, ok := done[migration.Version]; ok {
+			appliedAt := applied.appliedAt
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// Check returns ErrMigrationChanged if an applied migration was edited since,
+// and ErrSchemaBehind, with the number of pending migrations, unless every
+// migration has been applied
+func (m *Migrator) Check(ctx context.Context) error {
+	if err := m.ensureTables(ctx); err != nil {
+		return err
+	}
+	done, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	if err := m.verify(ctx, done); err != nil {
+		return err
+	}
+	pending := 0
+	for _, migration := range m.migrations {
+		if _, ok := done[migration.Version]; !ok {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w: %d of %d migrations pending", ErrSchemaBehind, pending, len(m.migrations))
+	}
+	return nil
+}
+
+// run renders a migration for the database's dialect and executes it
+// statement by statement, then records it with the record statement. On
+// PostgreSQL this happens in one transaction. CockroachDB applies schema
+// changes asynchronously, so there statements run on their own and
+// migrations are written to be safe to re-run instead.
+func (m *Migrator) run(ctx context.Context, migration, record string, args ...interface{}) error {
+	sql, err := m.db.Dialect.Render(migration)
+	if err != nil {
+		return fmt.Errorf("failed to render migration: %w", err)
+	}
+	statements := SplitStatements(sql)
+
+	if !m.db.Dialect.TransactionalDDL() {
+		for _, statement := range statements {
+			if _, err := m.db.ExecContext(ctx, statement); err != nil {
+				return err
+			}
+		}
+		_, err := m.db.ExecContext(ctx, record, args...)
+		return err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]appliedMigration, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied_at, checksum FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var (
+			version   int64
+			migration appliedMigration
+			checksum  sql.NullString
+		)
+		if err := rows.Scan(&version, &migration.appliedAt, &checksum); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		migration.checksum = checksum.String
+		applied[version] = migration
+	}
+	return applied, rows.Err()
+}
+
+// verify returns ErrMigrationChanged if an applied migration differs from
+// the one recorded. Versions applied before checksums were recorded are
+// trusted as they are, and their checksums recorded now.
+func (m *Migrator) verify(ctx context.Context, done map[int64]appliedMigration) error {
+	for _, migration := range m.migrations {
+		applied, ok := done[migration.Version]
+		if !ok {
+			continue
+		}
+		checksum := migration.Checksum()
+		if applied.checksum == "" {
+			_, err := m.db.ExecContext(ctx, `
+				UPDATE schema_migrations SET checksum = $1 WHERE version = $2 AND checksum IS NULL
+			`, checksum, migration.Version)
+			if err != nil {
+				return fmt.Errorf("failed to record migration checksum: %w", err)
+			}
+			continue
+		}
+		if applied.checksum != checksum {
+			return fmt.Errorf("%w: %d_%s was edited after it was applied; add a new migration instead",
+				ErrMigrationChanged, migration.Version, migration.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) ensureTables(ctx context.Context) error {
+	for _, statement := range []string{
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL,
+			checksum VARCHAR(64)
+		)`,
+		`CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+			id INT PRIMARY KEY,
+			holder VARCHAR(32) NOT NULL,
+			expires_at TIMESTAMP NOT NULL
+		)`,
+	} {
+		if _, err := m.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to create migration tables: %w", err)
+		}
+	}
+
+	// schema_migrations created before checksums were recorded lacks the
+	// column. SQLite cannot add a column only if it is missing, so look.
+	if _, err := m.db.ExecContext(ctx, `SELECT checksum FROM schema_migrations WHERE 1 = 0`); err != nil {
+		if _, err := m.db.ExecContext(ctx, `ALTER TABLE schema_migrations ADD COLUMN checksum VARCHAR(64)`); err != nil {
+			return fmt.Errorf("failed to add migration checksums: %w", err)
+		}
+	}
+	return nil
+}
+
+// locked runs fn holding the migration lock, waiting for other replicas to
+// release it. The lease is renewed while fn runs; if it is lost, the context
+// passed to fn is cancelled.
+func (m *Migrator) locked(ctx context.Context, fn func(context.Context) error) error {
+	if err := m.ensureTables(ctx); err != nil {
+		return err
+	}
+
+	for {
+		acquired, err := m.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			break
+		}
+		logger.InfoContext(ctx, "waiting for another replica to finish migrating")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for the migration lock: %w", ctx.Err())
+		case <-time.After(lockPoll):
+		}
+	}
+	defer func() {
+		// Release even if ctx was cancelled mid-migration
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := m.db.ExecContext(releaseCtx, `DELETE FROM schema_migrations_lock WHERE id = 1 AND holder = $1`, m.holder); err != nil {
+			logger.Warn("failed to release the migration lock", slog.Any("error", err))
+		}
+	}()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		m.renew(ctx, cancel)
+	}()
+	err := fn(ctx)
+	lost := errors.Is(context.Cause(ctx), errLockLost)
+	cancel(nil)
+	<-renewed
+	if err != nil && lost {
+		return fmt.Errorf("%w: %w", errLockLost, err)
+	}
+	return err
+}
+
+// renew extends the migration lock's lease every lockRenew until ctx is
+// done, cancelling it if the lease was lost
+func (m *Migrator) renew(ctx context.Context, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(lockRenew)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		result, err := m.db.ExecContext(ctx, `
+			UPDATE schema_migrations_lock SET expires_at = $1 WHERE id = 1 AND holder = $2
+		`, time.Now().UTC().Add(lockLease), m.holder)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Warn("failed to renew the migration lock", slog.Any("error", err))
+			}
+			continue
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			cancel(errLockLost)
+			return
+		}
+	}
+}
+
+// acquire takes the migration lock unless another holder's lease is still
+// valid
+func (m *Migrator) acquire(ctx context.Context) (bool, error) {
+	now := time.Now().UTC()
+	result, err := m.db.ExecContext(ctx, `
+		INSERT INTO schema_migrations_lock (id, holder, expires_at) VALUES (1, $1, $2)
+		ON CONFLICT (id) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE schema_migrations_lock.expires_at < $3
+	`, m.holder, now.Add(lockLease), now)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire the migration lock: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire the migration lock: %w", err)
+	}
+	return affected == 1, nil
+}
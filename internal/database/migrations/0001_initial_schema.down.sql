@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS usage_daily;
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS workspace_invitations;
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS analytics;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS urls;
@@ -0,0 +1,164 @@
+-- Initial schema. Statements are idempotent so databases created before
+-- migrations existed are adopted as they are.
+
+CREATE TABLE IF NOT EXISTS urls (
+	id UUID PRIMARY KEY DEFAULT {{uuid}},
+	short_code VARCHAR(10) NOT NULL,
+	original_url TEXT NOT NULL,
+	title VARCHAR(255),
+	description TEXT,
+	created_at TIMESTAMP DEFAULT {{now}},
+	updated_at TIMESTAMP DEFAULT {{now}},
+	created_by VARCHAR(100),
+	is_active BOOLEAN DEFAULT true,
+	expires_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS analytics (
+	id UUID PRIMARY KEY DEFAULT {{uuid}},
+	url_id UUID NOT NULL,
+	short_code VARCHAR(10) NOT NULL,
+	ip_address INET,
+	user_agent TEXT,
+	referer TEXT,
+	country VARCHAR(100),
+	city VARCHAR(100),
+	clicked_at TIMESTAMP DEFAULT {{now}},
+	FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	id UUID PRIMARY KEY DEFAULT {{uuid}},
+	email VARCHAR(255) UNIQUE NOT NULL,
+	password_hash VARCHAR(255) NOT NULL,
+	name VARCHAR(255),
+	created_at TIMESTAMP DEFAULT {{now}},
+	updated_at TIMESTAMP DEFAULT {{now}},
+	is_active BOOLEAN DEFAULT true
+);
+
+-- Only hashes of the refresh tokens are stored
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id UUID PRIMARY KEY DEFAULT {{uuid}},
+	user_id UUID NOT NULL,
+	token_hash VARCHAR(64) UNIQUE NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT {{now}},
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- API keys are looked up by their visible prefix and verified against the
+-- stored hash
+CREATE TABLE IF NOT EXISTS api_keys (
+	id UUID PRIMARY KEY DEFAULT {{uuid}},
+	user_id UUID NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	prefix VARCHAR(16) UNIQUE NOT NULL,
+	key_hash VARCHAR(64) NOT NULL,
+	scopes TEXT NOT NULL,
+	allowed_ips TEXT,
+	expires_at TIMESTAMP,
+	last_used_at TIMESTAMP,
+	last_used_ip VARCHAR(45),
+	revoked_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT {{now}},
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Links, API keys and members belong to a workspace
+CREATE TABLE IF NOT EXISTS workspaces (
+	id UUID PRIMARY KEY DEFAULT {{uuid}},
+	name VARCHAR(100) NOT NULL,
+	slug VARCHAR(64) UNIQUE NOT NULL,
+	domain VARCHAR(255) UNIQUE,
+	created_by UUID,
+	created_at TIMESTAMP DEFAULT {{now}},
+	updated_at TIMESTAMP DEFAULT {{now}}
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+	workspace_id UUID NOT NULL,
+	user_id UUID NOT NULL,
+	role VARCHAR(16) NOT NULL,
+	created_at TIMESTAMP DEFAULT {{now}},
+	PRIMARY KEY (workspace_id, user_id),
+	FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+	id UUID PRIMARY KEY DEFAULT {{uuid}},
+	workspace_id UUID NOT NULL,
+	email VARCHAR(255) NOT NULL,
+	role VARCHAR(16) NOT NULL,
+	token_hash VARCHAR(64) UNIQUE NOT NULL,
+	invited_by UUID NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	accepted_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT {{now}},
+	FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+);
+
+-- Audit events are append-only and have no foreign keys, so events outlive
+-- the users, keys and workspaces they mention
+CREATE TABLE IF NOT EXISTS audit_events (
+	id UUID PRIMARY KEY DEFAULT {{uuid}},
+	workspace_id UUID,
+	actor_user_id UUID,
+	actor_api_key_id UUID,
+	action VARCHAR(64) NOT NULL,
+	target_type VARCHAR(32) NOT NULL,
+	target_id VARCHAR(255) NOT NULL,
+	before_state JSONB,
+	after_state JSONB,
+	ip_address VARCHAR(45),
+	request_id VARCHAR(64),
+	created_at TIMESTAMP NOT NULL DEFAULT {{now}}
+);
+
+-- Indexes of the tables above, on CockroachDB; 0006 creates them on the
+-- other dialects
+{{if .CockroachDB}}
+{{createIndex "urls" "idx_short_code" "short_code"}};
+{{createIndex "urls" "idx_created_at" "created_at"}};
+{{createIndex "analytics" "idx_url_id" "url_id"}};
+{{createIndex "analytics" "idx_short_code" "short_code"}};
+{{createIndex "analytics" "idx_clicked_at" "clicked_at"}};
+{{createIndex "users" "idx_email" "email"}};
+{{createIndex "refresh_tokens" "idx_refresh_tokens_user_id" "user_id"}};
+{{createIndex "api_keys" "idx_api_keys_user_id" "user_id"}};
+{{createIndex "workspace_members" "idx_workspace_members_user_id" "user_id"}};
+{{createIndex "workspace_invitations" "idx_workspace_invitations_workspace_id" "workspace_id"}};
+{{createIndex "audit_events" "idx_audit_events_workspace_created_at_id" "workspace_id, created_at DESC, id DESC"}};
+{{end}}
+
+-- Usage counters are metered in Redis and rolled up here
+CREATE TABLE IF NOT EXISTS usage_daily (
+	scope_type VARCHAR(16) NOT NULL,
+	scope_id UUID NOT NULL,
+	metric VARCHAR(32) NOT NULL,
+	day DATE NOT NULL,
+	count INT8 NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP DEFAULT {{now}},
+	PRIMARY KEY (scope_type, scope_id, metric, day)
+);
+
+-- Columns added after the tables were first created
+{{addColumn "urls" "workspace_id UUID"}};
+{{addColumn "urls" "domain VARCHAR(255) NOT NULL DEFAULT ''"}};
+{{addColumn "api_keys" "workspace_id UUID"}};
+{{addColumn "workspaces" "plan VARCHAR(32) NOT NULL DEFAULT 'free'"}};
+{{addColumn "api_keys" "plan VARCHAR(32)"}};
+
+-- Short codes are unique per domain rather than globally
+{{if .CockroachDB}}{{dropUniqueConstraint "urls" "urls_short_code_key"}};{{end}}
+
+-- Secondary indexes; the (timestamp, id) ones match keyset pagination order
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_domain_short_code ON urls (domain, short_code);
+CREATE INDEX IF NOT EXISTS idx_urls_workspace_created_at_id ON urls (workspace_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_analytics_url_id_clicked_at_id ON analytics (url_id, clicked_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_api_keys_workspace_id ON api_keys (workspace_id);
+CREATE INDEX IF NOT EXISTS idx_urls_active_created_at_id ON urls (is_active, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_analytics_short_code_clicked_at_id ON analytics (short_code, clicked_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_urls_created_by_created_at_id ON urls (created_by, created_at DESC, id DESC);
@@ -0,0 +1,2 @@
+-- HTTP status code short links redirect with: 301, 302, 307 or 308
+{{addColumn "urls" "redirect_type SMALLINT NOT NULL DEFAULT 301"}};
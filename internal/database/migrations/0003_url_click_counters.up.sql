@@ -0,0 +1,15 @@
+-- Click totals per link, flushed from the Redis counters and rebuilt from
+-- the analytics table by `linksprint reconcile-clicks`
+CREATE TABLE IF NOT EXISTS url_click_counters (
+	url_id UUID PRIMARY KEY,
+	total_clicks INT8 NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP DEFAULT {{now}},
+	FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
+);
+
+-- Start from the clicks recorded so far, keeping counters a partly applied
+-- run already inserted. SQLite needs the WHERE to parse ON CONFLICT after a
+-- SELECT.
+INSERT INTO url_click_counters (url_id, total_clicks)
+SELECT url_id, COUNT(*) FROM analytics WHERE true GROUP BY url_id
+ON CONFLICT (url_id) DO NOTHING;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS click_rollup_state;
+DROP TABLE IF EXISTS click_rollups_daily;
+DROP TABLE IF EXISTS click_rollups_hourly;
+ALTER TABLE analytics DROP COLUMN browser;
+ALTER TABLE analytics DROP COLUMN device;
+ALTER TABLE analytics DROP COLUMN referer_domain;
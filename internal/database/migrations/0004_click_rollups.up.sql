@@ -0,0 +1,35 @@
+-- Clicks classified when they are recorded, for the rollups
+{{addColumn "analytics" "referer_domain VARCHAR(255)"}};
+{{addColumn "analytics" "device VARCHAR(16)"}};
+{{addColumn "analytics" "browser VARCHAR(32)"}};
+
+-- Clicks per link and hour, and per link and UTC day, in total (dimension
+-- total, value '') and by country, city, referer domain, device and browser
+CREATE TABLE IF NOT EXISTS click_rollups_hourly (
+	url_id UUID NOT NULL,
+	bucket TIMESTAMP NOT NULL,
+	dimension VARCHAR(16) NOT NULL,
+	value VARCHAR(255) NOT NULL,
+	clicks INT8 NOT NULL,
+	PRIMARY KEY (url_id, dimension, bucket, value),
+	FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
+);
+{{createIndex "click_rollups_hourly" "idx_click_rollups_hourly_bucket" "bucket"}};
+
+CREATE TABLE IF NOT EXISTS click_rollups_daily (
+	url_id UUID NOT NULL,
+	bucket TIMESTAMP NOT NULL,
+	dimension VARCHAR(16) NOT NULL,
+	value VARCHAR(255) NOT NULL,
+	clicks INT8 NOT NULL,
+	PRIMARY KEY (url_id, dimension, bucket, value),
+	FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
+);
+{{createIndex "click_rollups_daily" "idx_click_rollups_daily_bucket" "bucket"}};
+
+-- Clicks before rolled_until are in the rollups; later ones are read from
+-- the analytics table
+CREATE TABLE IF NOT EXISTS click_rollup_state (
+	name VARCHAR(32) PRIMARY KEY,
+	rolled_until TIMESTAMP NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE analytics DROP COLUMN visitor_id;
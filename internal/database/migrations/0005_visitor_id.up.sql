@@ -0,0 +1,3 @@
+-- Visitor the click is counted for in unique visitors: their cookie ID, or a
+-- keyed hash of their IP address and user agent
+{{addColumn "analytics" "visitor_id VARCHAR(64)"}};
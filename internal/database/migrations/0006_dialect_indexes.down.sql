@@ -0,0 +1,14 @@
+{{if not .CockroachDB}}
+{{dropIndex "audit_events" "idx_audit_events_workspace_created_at_id"}};
+{{dropIndex "workspace_invitations" "idx_workspace_invitations_workspace_id"}};
+{{dropIndex "workspace_members" "idx_workspace_members_user_id"}};
+{{dropIndex "api_keys" "idx_api_keys_user_id"}};
+{{dropIndex "refresh_tokens" "idx_refresh_tokens_user_id"}};
+{{dropIndex "users" "idx_email"}};
+{{dropIndex "analytics" "idx_clicked_at"}};
+{{dropIndex "analytics" "idx_short_code"}};
+{{dropIndex "analytics" "idx_url_id"}};
+{{dropIndex "urls" "idx_created_at"}};
+{{dropIndex "urls" "idx_short_code"}};
+{{end}}
+{{if .PostgreSQL}}ALTER TABLE urls ADD CONSTRAINT urls_short_code_key UNIQUE (short_code);{{end}}
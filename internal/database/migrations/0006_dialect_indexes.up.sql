@@ -0,0 +1,18 @@
+-- The indexes 0001 creates on CockroachDB only, for the other dialects. On
+-- PostgreSQL the global short code constraint is dropped as 0001 drops it
+-- on CockroachDB; SQLite tables never have one. Short codes are unique per
+-- domain on every dialect, by idx_urls_domain_short_code.
+{{if not .CockroachDB}}
+{{createIndex "urls" "idx_short_code" "short_code"}};
+{{createIndex "urls" "idx_created_at" "created_at"}};
+{{createIndex "analytics" "idx_url_id" "url_id"}};
+{{createIndex "analytics" "idx_short_code" "short_code"}};
+{{createIndex "analytics" "idx_clicked_at" "clicked_at"}};
+{{createIndex "users" "idx_email" "email"}};
+{{createIndex "refresh_tokens" "idx_refresh_tokens_user_id" "user_id"}};
+{{createIndex "api_keys" "idx_api_keys_user_id" "user_id"}};
+{{createIndex "workspace_members" "idx_workspace_members_user_id" "user_id"}};
+{{createIndex "workspace_invitations" "idx_workspace_invitations_workspace_id" "workspace_id"}};
+{{createIndex "audit_events" "idx_audit_events_workspace_created_at_id" "workspace_id, created_at DESC, id DESC"}};
+{{end}}
+{{if .PostgreSQL}}{{dropUniqueConstraint "urls" "urls_short_code_key"}};{{end}}
@@ -0,0 +1,6 @@
+DELETE FROM click_rollups_daily;
+DELETE FROM click_rollups_hourly;
+DELETE FROM click_rollup_state;
+{{dropIndex "analytics" "idx_analytics_url_id_recorded_at"}};
+{{dropIndex "analytics" "idx_analytics_recorded_at"}};
+ALTER TABLE analytics DROP COLUMN recorded_at;
@@ -0,0 +1,13 @@
+-- When a click was stored, by the database's clock. Clicks are rolled up by
+-- when they were stored rather than when they happened, so clicks stored
+-- late still reach the rollups; clicks stored so far count as stored when
+-- they happened.
+{{addColumn "analytics" "recorded_at TIMESTAMP"}};
+UPDATE analytics SET recorded_at = clicked_at WHERE recorded_at IS NULL;
+{{createIndex "analytics" "idx_analytics_recorded_at" "recorded_at"}};
+{{createIndex "analytics" "idx_analytics_url_id_recorded_at" "url_id, recorded_at"}};
+
+-- Roll the clicks up again from the start, by when they were stored
+DELETE FROM click_rollups_daily;
+DELETE FROM click_rollups_hourly;
+DELETE FROM click_rollup_state;
@@ -0,0 +1,7 @@
+-- Flushes of the Redis click counters added to url_click_counters, so a
+-- flush cut short and applied again is added once
+CREATE TABLE IF NOT EXISTS click_counter_flushes (
+	id VARCHAR(32) PRIMARY KEY,
+	flushed_at TIMESTAMP NOT NULL
+);
+{{createIndex "click_counter_flushes" "idx_click_counter_flushes_flushed_at" "flushed_at"}};
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+)
+
+// SQLitePrefix starts the storage URL of a SQLite database, such as
+// sqlite:./data.db
+const SQLitePrefix = "sqlite:"
+
+// SQLiteTimeFormat is how timestamps are stored in SQLite, where they are
+// text. Every timestamp is written in UTC so they sort as they compare.
+const SQLiteTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// IsSQLite reports whether a storage URL names a SQLite database
+func IsSQLite(databaseURL string) bool {
+	return strings.HasPrefix(databaseURL, SQLitePrefix)
+}
+
+// sqliteDSN returns the driver DSN of a sqlite: storage URL, creating the
+// directory of the database file. Foreign keys are enforced, readers do not
+// block the writer, and transactions take the write lock when they begin so
+// concurrent writers wait for each other instead of failing.
+func sqliteDSN(databaseURL string) (string, error) {
+	path := strings.TrimPrefix(databaseURL, SQLitePrefix)
+	if path == "" {
+		return "", fmt.Errorf("SQLite storage needs a file, such as sqlite:./data.db")
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("failed to create database directory: %w", err)
+		}
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "busy_timeout(10000)")
+	params.Set("_txlock", "immediate")
+	params.Set("_time_format", "sqlite")
+	return "file:" + path + "?" + params.Encode(), nil
+}
+
+// The PostgreSQL functions queries and migrations use, for SQLite
+func init() {
+	sqlite.MustRegisterScalarFunction("gen_random_uuid", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return uuid.NewString(), nil
+	})
+	sqlite.MustRegisterScalarFunction("now", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return time.Now().UTC().Format(SQLiteTimeFormat), nil
+	})
+	// Timestamps are stored in UTC already, which is the only zone queries
+	// convert to
+	sqlite.MustRegisterDeterministicScalarFunction("timezone", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		if zone, _ := args[0].(string); zone != "UTC" {
+			return nil, fmt.Errorf("timezone: unsupported zone %q", zone)
+		}
+		return args[1], nil
+	})
+	// IP addresses are stored as text, without a netmask to strip
+	sqlite.MustRegisterDeterministicScalarFunction("host", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		return args[0], nil
+	})
+	// Timestamps are truncated in UTC, as PostgreSQL does for TIMESTAMP
+	sqlite.MustRegisterDeterministicScalarFunction("date_trunc", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		unit, _ := args[0].(string)
+		var ts NullTime
+		if err := ts.Scan(args[1]); err != nil {
+			return nil, fmt.Errorf("date_trunc: %w", err)
+		}
+		if !ts.Valid {
+			return nil, nil
+		}
+		t := ts.Time.UTC()
+		switch unit {
+		case "minute":
+			t = t.Truncate(time.Minute)
+		case "hour":
+			t = t.Truncate(time.Hour)
+		case "day":
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		default:
+			return nil, fmt.Errorf("date_trunc: unsupported unit %q", unit)
+		}
+		return t.Format(SQLiteTimeFormat), nil
+	})
+	sqlite.MustRegisterDeterministicScalarFunction("greatest", -1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		var greatest int64
+		found := false
+		for _, arg := range args {
+			n, ok := arg.(int64)
+			if !ok {
+				if arg == nil {
+					continue
+				}
+				return nil, fmt.Errorf("greatest: unsupported argument %T", arg)
+			}
+			if !found || n > greatest {
+				greatest, found = n, true
+			}
+		}
+		if !found {
+			return nil, nil
+		}
+		return greatest, nil
+	})
+}
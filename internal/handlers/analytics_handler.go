@@ -1,9 +1,8 @@
 package handlers
 
 import (
-	"linksprint/internal/database"
+	"linksprint/internal/middleware"
 	"linksprint/internal/models"
-	"linksprint/internal/redis"
 	"linksprint/internal/services"
 
 	"github.com/gofiber/fiber/v2"
@@ -15,14 +14,14 @@ type AnalyticsHandler struct {
 }
 
 // NewAnalyticsHandler creates a new analytics handler
-func NewAnalyticsHandler(db *database.DB, redis *redis.Client) *AnalyticsHandler {
-	analyticsService := services.NewAnalyticsService(db, redis)
+func NewAnalyticsHandler(analyticsService *services.AnalyticsService) *AnalyticsHandler {
 	return &AnalyticsHandler{
 		analyticsService: analyticsService,
 	}
 }
 
-// GetAnalytics handles GET /api/v1/analytics/:shortCode
+// GetAnalytics handles GET /api/v1/analytics/:shortCode; the from, to,
+// interval and tz query parameters select its click series
 func (h *AnalyticsHandler) GetAnalytics(c *fiber.Ctx) error {
 	shortCode := c.Params("shortCode")
 	if shortCode == "" {
@@ -31,23 +30,43 @@ func (h *AnalyticsHandler) GetAnalytics(c *fiber.Ctx) error {
 		})
 	}
 
-	analytics, err := h.analyticsService.GetAnalytics(c.Context(), shortCode)
+	clickRange, err := parseClickRange(c)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
+	analytics, err := h.analyticsService.GetAnalytics(c.UserContext(), middleware.CurrentPrincipal(c), shortCode, clickRange)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
 	return c.JSON(analytics)
 }
 
+// ListClicks handles GET /api/v1/analytics/:shortCode/clicks
+func (h *AnalyticsHandler) ListClicks(c *fiber.Ctx) error {
+	shortCode := c.Params("shortCode")
+	if shortCode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Short code is required",
+		})
+	}
+
+	clicks, err := h.analyticsService.ListClicks(c.UserContext(), middleware.CurrentPrincipal(c), shortCode, c.Query("cursor"), parseLimit(c), c.QueryBool("include_total"))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(clicks)
+}
+
 // GetGlobalAnalytics handles GET /api/v1/analytics/global
 func (h *AnalyticsHandler) GetGlobalAnalytics(c *fiber.Ctx) error {
-	analytics, err := h.analyticsService.GetGlobalAnalytics(c.Context())
+	analytics, err := h.analyticsService.GetGlobalAnalytics(c.UserContext(), middleware.CurrentPrincipal(c))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return serviceError(c, err)
 	}
 
 	return c.JSON(analytics)
@@ -70,11 +89,9 @@ func (h *AnalyticsHandler) TrackClick(c *fiber.Ctx) error {
 	}
 
 	// Track the click
-	err := h.analyticsService.TrackClick(c.Context(), &req)
+	err := h.analyticsService.TrackClickFor(c.UserContext(), middleware.CurrentPrincipal(c), &req)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return serviceError(c, err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -82,3 +99,20 @@ func (h *AnalyticsHandler) TrackClick(c *fiber.Ctx) error {
 		"short_code": req.ShortCode,
 	})
 }
+
+// parseClickRange reads the from and to (RFC 3339), interval and tz query
+// parameters
+func parseClickRange(c *fiber.Ctx) (*models.ClickRange, error) {
+	clickRange := &models.ClickRange{
+		Interval: c.Query("interval"),
+		Timezone: c.Query("tz"),
+	}
+	var err error
+	if clickRange.From, err = parseTimeQuery(c, "from"); err != nil {
+		return nil, err
+	}
+	if clickRange.To, err = parseTimeQuery(c, "to"); err != nil {
+		return nil, err
+	}
+	return clickRange, nil
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"linksprint/internal/middleware"
+	"linksprint/internal/models"
+	"linksprint/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIKeyHandler handles API key management HTTP requests
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// CreateAPIKey handles POST /api/v1/api-keys
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	var req models.CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	response, err := h.apiKeyService.CreateAPIKey(c.UserContext(), middleware.CurrentPrincipal(c), &req)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// ListAPIKeys handles GET /api/v1/api-keys
+func (h *APIKeyHandler) ListAPIKeys(c *fiber.Ctx) error {
+	keys, err := h.apiKeyService.ListAPIKeys(c.UserContext(), middleware.CurrentPrincipal(c))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"api_keys": keys,
+	})
+}
+
+// RevokeAPIKey handles DELETE /api/v1/api-keys/:id
+func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	keyID := c.Params("id")
+	if keyID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "API key ID is required",
+		})
+	}
+
+	err := h.apiKeyService.RevokeAPIKey(c.UserContext(), middleware.CurrentPrincipal(c), keyID)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "API key revoked successfully",
+		"id":      keyID,
+	})
+}
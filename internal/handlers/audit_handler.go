@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"linksprint/internal/middleware"
+	"linksprint/internal/models"
+	"linksprint/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AuditHandler handles audit log HTTP requests
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(auditService *services.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// ListEvents handles GET /api/v1/audit
+func (h *AuditHandler) ListEvents(c *fiber.Ctx) error {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	response, err := h.auditService.ListEvents(c.UserContext(), middleware.CurrentPrincipal(c), filter, c.Query("cursor"), parseLimit(c))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(response)
+}
+
+// ExportEvents handles GET /api/v1/audit/export, streaming matching events
+// as newline-delimited JSON
+func (h *AuditHandler) ExportEvents(c *fiber.Ctx) error {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	export, err := h.auditService.ExportEvents(middleware.CurrentPrincipal(c), filter)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="audit.ndjson"`)
+	// The stream is written after the handler returns, so it cannot use the
+	// request's context
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := export(context.Background(), w); err != nil {
+			logger.Error("audit export failed", slog.Any("error", err))
+		}
+	})
+	return nil
+}
+
+// parseAuditFilter reads the action, actor, target_type, target_id, from
+// and to query parameters; times are RFC 3339
+func parseAuditFilter(c *fiber.Ctx) (*models.AuditFilter, error) {
+	filter := &models.AuditFilter{
+		Action:     c.Query("action"),
+		ActorID:    c.Query("actor"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+	var err error
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		return nil, err
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// parseTimeQuery reads an optional RFC 3339 time query parameter
+func parseTimeQuery(c *fiber.Ctx, param string) (*time.Time, error) {
+	value := c.Query(param)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 time", param)
+	}
+	return &t, nil
+}
@@ -1,9 +1,18 @@
 package handlers
 
 import (
+	"errors"
+
+	"linksprint/internal/logging"
+	"linksprint/internal/pagination"
+	"linksprint/internal/services"
+
 	"github.com/gofiber/fiber/v2"
 )
 
+// logger is the logger of the handlers package
+var logger = logging.For("handlers")
+
 // ErrorHandler handles application errors
 func ErrorHandler(c *fiber.Ctx, err error) error {
 	// Default error
@@ -25,3 +34,49 @@ func ErrorHandler(c *fiber.Ctx, err error) error {
 		"request_id": c.Get("X-Request-ID", "unknown"),
 	})
 }
+
+// serviceError responds with the HTTP status matching an error returned by
+// the services; unknown errors are internal server errors
+func serviceError(c *fiber.Ctx, err error) error {
+	return c.Status(statusFor(err)).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, services.ErrURLNotFound),
+		errors.Is(err, services.ErrAPIKeyNotFound),
+		errors.Is(err, services.ErrWorkspaceNotFound),
+		errors.Is(err, services.ErrMemberNotFound),
+		errors.Is(err, services.ErrInvitationNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, services.ErrForbidden),
+		errors.Is(err, services.ErrIPNotAllowed),
+		errors.Is(err, services.ErrRegistrationClosed):
+		return fiber.StatusForbidden
+	case errors.Is(err, services.ErrInvalidCredentials),
+		errors.Is(err, services.ErrInvalidToken):
+		return fiber.StatusUnauthorized
+	case errors.Is(err, services.ErrEmailTaken),
+		errors.Is(err, services.ErrShortCodeTaken),
+		errors.Is(err, services.ErrDomainTaken),
+		errors.Is(err, services.ErrAlreadyMember),
+		errors.Is(err, services.ErrLastOwner):
+		return fiber.StatusConflict
+	case errors.Is(err, services.ErrQuotaExceeded):
+		return fiber.StatusTooManyRequests
+	case errors.Is(err, services.ErrInvalidRegistration),
+		errors.Is(err, services.ErrInvalidAPIKey),
+		errors.Is(err, services.ErrInvalidWorkspace),
+		errors.Is(err, services.ErrInvalidURL),
+		errors.Is(err, services.ErrInvalidShortCode),
+		errors.Is(err, services.ErrInvalidRedirectType),
+		errors.Is(err, services.ErrInvalidAuditFilter),
+		errors.Is(err, services.ErrInvalidClickRange),
+		errors.Is(err, pagination.ErrInvalidCursor):
+		return fiber.StatusBadRequest
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
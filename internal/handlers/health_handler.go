@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Readiness states reported by /readyz
+const (
+	statusReady    = "ready"
+	statusDegraded = "degraded"
+	statusUnready  = "unready"
+	statusDraining = "draining"
+)
+
+// HealthCheck is a dependency probed by /readyz
+type HealthCheck struct {
+	Name string
+	// Critical dependencies make the service unready when they are down;
+	// the others only degrade it
+	Critical bool
+	Check    func(ctx context.Context) error
+}
+
+// HealthHandler serves the liveness and readiness probes
+type HealthHandler struct {
+	checks   []HealthCheck
+	timeout  time.Duration
+	started  time.Time
+	draining atomic.Bool
+}
+
+// NewHealthHandler creates a health handler running each check with the
+// given timeout
+func NewHealthHandler(timeout time.Duration, checks ...HealthCheck) *HealthHandler {
+	return &HealthHandler{
+		checks:  checks,
+		timeout: timeout,
+		started: time.Now(),
+	}
+}
+
+// SetDraining makes /readyz fail so load balancers stop sending traffic
+// while the server shuts down
+func (h *HealthHandler) SetDraining() {
+	h.draining.Store(true)
+}
+
+// Livez handles GET /livez. It only reports that the process is serving
+// requests and never checks dependencies, so an outage of Redis or the
+// database does not get the server restarted.
+func (h *HealthHandler) Livez(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status":         "ok",
+		"service":        "LinkSprint",
+		"version":        "1.0.0",
+		"uptime_seconds": int64(time.Since(h.started).Seconds()),
+	})
+}
+
+// checkResult is the outcome of one health check
+type checkResult struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Readyz handles GET /readyz. It responds 503 when a critical dependency is
+// down or the server is draining, and 200 with a degraded status when only
+// optional dependencies are down.
+func (h *HealthHandler) Readyz(c *fiber.Ctx) error {
+	results := make(map[string]checkResult, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Check(ctx)
+			result := checkResult{Status: "up", Critical: check.Critical, LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = "down"
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	status := statusReady
+	for _, result := range results {
+		if result.Status == "up" {
+			continue
+		}
+		if result.Critical {
+			status = statusUnready
+			break
+		}
+		status = statusDegraded
+	}
+	if h.draining.Load() {
+		status = statusDraining
+	}
+
+	code := fiber.StatusOK
+	if status == statusUnready || status == statusDraining {
+		code = fiber.StatusServiceUnavailable
+	}
+	return c.Status(code).JSON(fiber.Map{
+		"status": status,
+		"checks": results,
+	})
+}
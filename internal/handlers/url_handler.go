@@ -2,25 +2,40 @@ package handlers
 
 import (
 	"strconv"
+	"time"
 
-	"linksprint/internal/database"
+	"linksprint/internal/config"
+	"linksprint/internal/middleware"
 	"linksprint/internal/models"
-	"linksprint/internal/redis"
 	"linksprint/internal/services"
+	"linksprint/internal/useragent"
+	"linksprint/internal/visitor"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 )
 
 // URLHandler handles URL-related HTTP requests
 type URLHandler struct {
 	urlService *services.URLService
+	clicks     *services.ClickPipeline
+	tracking   bool
+	// visitorCookie sets the visitor cookie on redirects, and visitorKey
+	// keys the visitor IDs of clients without one
+	visitorCookie bool
+	visitorKey    []byte
 }
 
-// NewURLHandler creates a new URL handler
-func NewURLHandler(db *database.DB, redis *redis.Client) *URLHandler {
-	urlService := services.NewURLService(db, redis)
+// NewURLHandler creates a new URL handler recording redirect clicks through
+// the given pipeline, unless click tracking is turned off
+func NewURLHandler(urlService *services.URLService, live *config.Live, clicks *services.ClickPipeline) *URLHandler {
+	cfg := live.Config()
 	return &URLHandler{
-		urlService: urlService,
+		urlService:    urlService,
+		clicks:        clicks,
+		tracking:      cfg.Features.ClickTracking,
+		visitorCookie: cfg.Clicks.VisitorCookie,
+		visitorKey:    cfg.VisitorKey(),
 	}
 }
 
@@ -41,11 +56,9 @@ func (h *URLHandler) CreateShortURL(c *fiber.Ctx) error {
 	}
 
 	// Create short URL
-	response, err := h.urlService.CreateShortURL(c.Context(), &req)
+	response, err := h.urlService.CreateShortURL(c.UserContext(), middleware.CurrentPrincipal(c), &req)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return serviceError(c, err)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(response)
@@ -61,30 +74,59 @@ func (h *URLHandler) RedirectToOriginal(c *fiber.Ctx) error {
 	}
 
 	// Get original URL
-	originalURL, err := h.urlService.GetOriginalURL(c.Context(), shortCode)
+	redirect, err := h.urlService.GetOriginalURL(c.UserContext(), c.Hostname(), shortCode)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "URL not found or expired",
 		})
 	}
 
-	// Track analytics (async)
-	go func() {
-		analyticsReq := &models.AnalyticsRequest{
-			ShortCode: shortCode,
-			IPAddress: c.IP(),
-			UserAgent: c.Get("User-Agent"),
-			Referer:   c.Get("Referer"),
-		}
-		// Note: In a real application, you'd want to use a proper analytics service
-		// For now, we'll just log the click
-		_ = analyticsReq
-	}()
-
-	// Redirect to original URL
-	return c.Redirect(originalURL, fiber.StatusMovedPermanently)
+	// Track analytics (async), except for HEAD requests and bots. Fiber
+	// reuses request memory once the handler returns, so the queued strings
+	// are copied.
+	if h.tracking && c.Method() != fiber.MethodHead && !useragent.IsBot(c.Get("User-Agent")) {
+		h.clicks.Track(models.AnalyticsRequest{
+			ShortCode: utils.CopyString(shortCode),
+			Domain:    utils.CopyString(redirect.Domain),
+			IPAddress: utils.CopyString(middleware.ClientIP(c)),
+			UserAgent: utils.CopyString(c.Get("User-Agent")),
+			Referer:   utils.CopyString(c.Get("Referer")),
+			VisitorID: h.visitorID(c),
+			ClickedAt: time.Now().UTC(),
+		})
+	}
+
+	// Redirect to original URL with the link's redirect type
+	return c.Redirect(redirect.OriginalURL, redirect.StatusCode)
 }
 
+// visitorID returns the ID of the visitor from their cookie. A visitor
+// without one gets the hash of their IP address and user agent, kept in a
+// new cookie so they stay the same visitor when their address changes.
+// With the cookie turned off, it returns "" and the hash is taken when the
+// click is recorded.
+func (h *URLHandler) visitorID(c *fiber.Ctx) string {
+	if !h.visitorCookie {
+		return ""
+	}
+	if id := c.Cookies(visitor.CookieName); visitor.Valid(id) {
+		return utils.CopyString(id)
+	}
+	id := visitor.ID(h.visitorKey, middleware.ClientIP(c), c.Get("User-Agent"))
+	c.Cookie(&fiber.Cookie{
+		Name:     visitor.CookieName,
+		Value:    id,
+		MaxAge:   visitorCookieMaxAge,
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return id
+}
+
+// visitorCookieMaxAge is how long the visitor cookie is kept, in seconds
+const visitorCookieMaxAge = 365 * 24 * 60 * 60
+
 // GetURLStats handles GET /api/v1/urls/:shortCode/stats
 func (h *URLHandler) GetURLStats(c *fiber.Ctx) error {
 	shortCode := c.Params("shortCode")
@@ -94,18 +136,23 @@ func (h *URLHandler) GetURLStats(c *fiber.Ctx) error {
 		})
 	}
 
-	stats, err := h.urlService.GetURLStats(c.Context(), shortCode)
+	stats, err := h.urlService.GetURLStats(c.UserContext(), middleware.CurrentPrincipal(c), shortCode)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return serviceError(c, err)
 	}
 
 	return c.JSON(stats)
 }
 
 // ListURLs handles GET /api/v1/urls
+//
+// Passing a cursor parameter (empty for the first page) switches to keyset
+// pagination; otherwise the classic page/per_page mode is used.
 func (h *URLHandler) ListURLs(c *fiber.Ctx) error {
+	if c.Context().QueryArgs().Has("cursor") {
+		return h.listURLsByCursor(c)
+	}
+
 	// Parse pagination parameters
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	perPage, _ := strconv.Atoi(c.Query("per_page", "10"))
@@ -119,16 +166,47 @@ func (h *URLHandler) ListURLs(c *fiber.Ctx) error {
 	}
 
 	// Get URLs
-	response, err := h.urlService.ListURLs(c.Context(), page, perPage)
+	response, err := h.urlService.ListURLs(c.UserContext(), middleware.CurrentPrincipal(c), page, perPage)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return serviceError(c, err)
 	}
 
 	return c.JSON(response)
 }
 
+func (h *URLHandler) listURLsByCursor(c *fiber.Ctx) error {
+	response, err := h.urlService.ListURLsByCursor(c.UserContext(), middleware.CurrentPrincipal(c), c.Query("cursor"), parseLimit(c), c.QueryBool("include_total"))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(response)
+}
+
+// UpdateURL handles PATCH /api/v1/urls/:shortCode
+func (h *URLHandler) UpdateURL(c *fiber.Ctx) error {
+	shortCode := c.Params("shortCode")
+	if shortCode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Short code is required",
+		})
+	}
+
+	var req models.UpdateURLRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	url, err := h.urlService.UpdateURL(c.UserContext(), middleware.CurrentPrincipal(c), shortCode, &req)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(url)
+}
+
 // DeleteURL handles DELETE /api/v1/urls/:shortCode
 func (h *URLHandler) DeleteURL(c *fiber.Ctx) error {
 	shortCode := c.Params("shortCode")
@@ -138,10 +216,22 @@ func (h *URLHandler) DeleteURL(c *fiber.Ctx) error {
 		})
 	}
 
-	// For now, we'll just return a success message
-	// In a real application, you'd implement soft delete
+	if err := h.urlService.DeleteURL(c.UserContext(), middleware.CurrentPrincipal(c), shortCode); err != nil {
+		return serviceError(c, err)
+	}
+
 	return c.JSON(fiber.Map{
 		"message":    "URL deleted successfully",
 		"short_code": shortCode,
 	})
 }
+
+// parseLimit reads the page size for cursor listings, accepting per_page as
+// an alias of limit
+func parseLimit(c *fiber.Ctx) int {
+	limit, _ := strconv.Atoi(c.Query("limit", c.Query("per_page", "10")))
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+	return limit
+}
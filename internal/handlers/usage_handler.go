@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"linksprint/internal/middleware"
+	"linksprint/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UsageHandler handles plan usage HTTP requests
+type UsageHandler struct {
+	usageService *services.UsageService
+}
+
+// NewUsageHandler creates a new usage handler
+func NewUsageHandler(usageService *services.UsageService) *UsageHandler {
+	return &UsageHandler{
+		usageService: usageService,
+	}
+}
+
+// GetUsage handles GET /api/v1/usage
+func (h *UsageHandler) GetUsage(c *fiber.Ctx) error {
+	usage, err := h.usageService.GetUsage(c.UserContext(), middleware.CurrentPrincipal(c))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(usage)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"linksprint/internal/middleware"
+	"linksprint/internal/models"
+	"linksprint/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WorkspaceHandler handles workspace, member and invitation HTTP requests
+type WorkspaceHandler struct {
+	workspaceService *services.WorkspaceService
+}
+
+// NewWorkspaceHandler creates a new workspace handler
+func NewWorkspaceHandler(workspaceService *services.WorkspaceService) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		workspaceService: workspaceService,
+	}
+}
+
+// CreateWorkspace handles POST /api/v1/workspaces
+func (h *WorkspaceHandler) CreateWorkspace(c *fiber.Ctx) error {
+	var req models.CreateWorkspaceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	workspace, err := h.workspaceService.CreateWorkspace(c.UserContext(), middleware.CurrentPrincipal(c), &req)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(workspace)
+}
+
+// ListWorkspaces handles GET /api/v1/workspaces
+func (h *WorkspaceHandler) ListWorkspaces(c *fiber.Ctx) error {
+	workspaces, err := h.workspaceService.ListWorkspaces(c.UserContext(), middleware.CurrentPrincipal(c))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"workspaces": workspaces,
+	})
+}
+
+// UpdateWorkspace handles PATCH /api/v1/workspaces/:id
+func (h *WorkspaceHandler) UpdateWorkspace(c *fiber.Ctx) error {
+	var req models.UpdateWorkspaceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	workspace, err := h.workspaceService.UpdateWorkspace(c.UserContext(), middleware.CurrentPrincipal(c), c.Params("id"), &req)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(workspace)
+}
+
+// ListMembers handles GET /api/v1/workspaces/:id/members
+func (h *WorkspaceHandler) ListMembers(c *fiber.Ctx) error {
+	members, err := h.workspaceService.ListMembers(c.UserContext(), middleware.CurrentPrincipal(c), c.Params("id"))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"members": members,
+	})
+}
+
+// UpdateMember handles PUT /api/v1/workspaces/:id/members/:userId
+func (h *WorkspaceHandler) UpdateMember(c *fiber.Ctx) error {
+	var req models.UpdateMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	userID := c.Params("userId")
+	if err := h.workspaceService.UpdateMemberRole(c.UserContext(), middleware.CurrentPrincipal(c), c.Params("id"), userID, req.Role); err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Member updated successfully",
+		"user_id": userID,
+		"role":    req.Role,
+	})
+}
+
+// RemoveMember handles DELETE /api/v1/workspaces/:id/members/:userId
+func (h *WorkspaceHandler) RemoveMember(c *fiber.Ctx) error {
+	userID := c.Params("userId")
+	if err := h.workspaceService.RemoveMember(c.UserContext(), middleware.CurrentPrincipal(c), c.Params("id"), userID); err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Member removed successfully",
+		"user_id": userID,
+	})
+}
+
+// CreateInvitation handles POST /api/v1/workspaces/:id/invitations
+func (h *WorkspaceHandler) CreateInvitation(c *fiber.Ctx) error {
+	var req models.CreateInvitationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	response, err := h.workspaceService.CreateInvitation(c.UserContext(), middleware.CurrentPrincipal(c), c.Params("id"), &req)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// ListInvitations handles GET /api/v1/workspaces/:id/invitations
+func (h *WorkspaceHandler) ListInvitations(c *fiber.Ctx) error {
+	invitations, err := h.workspaceService.ListInvitations(c.UserContext(), middleware.CurrentPrincipal(c), c.Params("id"))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"invitations": invitations,
+	})
+}
+
+// RevokeInvitation handles DELETE /api/v1/workspaces/:id/invitations/:invitationId
+func (h *WorkspaceHandler) RevokeInvitation(c *fiber.Ctx) error {
+	invitationID := c.Params("invitationId")
+	if err := h.workspaceService.RevokeInvitation(c.UserContext(), middleware.CurrentPrincipal(c), c.Params("id"), invitationID); err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Invitation revoked successfully",
+		"id":      invitationID,
+	})
+}
+
+// AcceptInvitation handles POST /api/v1/invitations/accept
+func (h *WorkspaceHandler) AcceptInvitation(c *fiber.Ctx) error {
+	var req models.AcceptInvitationRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "token is required",
+		})
+	}
+
+	workspace, err := h.workspaceService.AcceptInvitation(c.UserContext(), middleware.CurrentPrincipal(c), req.Token)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(workspace)
+}
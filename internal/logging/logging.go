@@ -0,0 +1,235 @@
+// Package logging provides structured log/slog loggers. Each package logs
+// through its own logger, created with For, so levels can be set per
+// package. Request attributes stored in the context with With, such as the
+// request ID, are added to every line logged with that context, and
+// sensitive attributes are redacted before they are written.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Log formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Options configures logging
+type Options struct {
+	// Format is json or text
+	Format string
+	// Level is the minimum level logged by packages without their own level
+	Level string
+	// Levels overrides Level by package name, such as "redis" or "services"
+	Levels map[string]string
+	// Output receives the log lines; nil writes to stdout
+	Output io.Writer
+}
+
+// levels is the minimum level of each package, with a default
+type levels struct {
+	base     slog.Level
+	packages map[string]slog.Level
+}
+
+func (l *levels) of(pkg string) slog.Level {
+	if level, ok := l.packages[pkg]; ok {
+		return level
+	}
+	return l.base
+}
+
+var (
+	root    atomic.Pointer[slog.Handler]
+	current atomic.Pointer[levels]
+)
+
+func init() {
+	handler := newHandler(FormatJSON, os.Stdout)
+	root.Store(&handler)
+	current.Store(&levels{base: slog.LevelInfo})
+	slog.SetDefault(For("app"))
+}
+
+// Setup installs the log format, output and levels. Loggers created with For
+// before Setup follow it. The standard library's log package is routed
+// through the "app" logger.
+func Setup(opts Options) error {
+	switch opts.Format {
+	case "", FormatJSON, FormatText:
+	default:
+		return fmt.Errorf("unknown log format %q", opts.Format)
+	}
+	if err := SetLevels(opts.Level, opts.Levels); err != nil {
+		return err
+	}
+
+	output := opts.Output
+	if output == nil {
+		output = os.Stdout
+	}
+	handler := newHandler(opts.Format, output)
+	root.Store(&handler)
+	slog.SetDefault(For("app"))
+	return nil
+}
+
+// SetLevels replaces the default and per-package levels while logging
+func SetLevels(level string, packageLevels map[string]string) error {
+	next := &levels{base: slog.LevelInfo, packages: make(map[string]slog.Level, len(packageLevels))}
+	if level != "" {
+		base, err := ParseLevel(level)
+		if err != nil {
+			return err
+		}
+		next.base = base
+	}
+	for pkg, value := range packageLevels {
+		parsed, err := ParseLevel(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", pkg, err)
+		}
+		next.packages[pkg] = parsed
+	}
+	current.Store(next)
+	return nil
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("log level %q must be debug, info, warn or error", value)
+	}
+	return level, nil
+}
+
+// For returns the logger of the named package. Its lines carry a "package"
+// attribute and are filtered by the package's level.
+func For(pkg string) *slog.Logger {
+	return slog.New(&packageHandler{pkg: pkg})
+}
+
+type attrsKey struct{}
+
+// With returns a copy of ctx whose log lines carry attrs in addition to
+// those already stored in ctx
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(existing)+len(attrs))
+	merged = append(merged, existing...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, attrsKey{}, merged)
+}
+
+func newHandler(format string, output io.Writer) slog.Handler {
+	opts := &slog.HandlerOptions{
+		// Levels are checked per package before records get here
+		Level:       slog.LevelDebug,
+		ReplaceAttr: redact,
+	}
+	if format == FormatText {
+		return slog.NewTextHandler(output, opts)
+	}
+	return slog.NewJSONHandler(output, opts)
+}
+
+// packageHandler filters records by the level of its package and writes them
+// to the current root handler with the attributes of the context
+type packageHandler struct {
+	pkg string
+	// derive replays WithAttrs and WithGroup calls on the root handler
+	derive []func(slog.Handler) slog.Handler
+}
+
+func (h *packageHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= current.Load().of(h.pkg)
+}
+
+func (h *packageHandler) Handle(ctx context.Context, record slog.Record) error {
+	handler := *root.Load()
+	handler = handler.WithAttrs([]slog.Attr{slog.String("package", h.pkg)})
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		handler = handler.WithAttrs(attrs)
+	}
+	for _, derive := range h.derive {
+		handler = derive(handler)
+	}
+	return handler.Handle(ctx, record)
+}
+
+func (h *packageHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *packageHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *packageHandler) with(derive func(slog.Handler) slog.Handler) slog.Handler {
+	next := &packageHandler{pkg: h.pkg, derive: make([]func(slog.Handler) slog.Handler, 0, len(h.derive)+1)}
+	next.derive = append(next.derive, h.derive...)
+	next.derive = append(next.derive, derive)
+	return next
+}
+
+// redactedKeys are attributes whose values are never logged
+var redactedKeys = map[string]bool{
+	"password":      true,
+	"new_password":  true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"api_key":       true,
+	"secret":        true,
+	"authorization": true,
+	"cookie":        true,
+}
+
+// ipKeys are attributes holding client IPs, which are logged truncated
+var ipKeys = map[string]bool{
+	"ip":         true,
+	"client_ip":  true,
+	"ip_address": true,
+	"remote_ip":  true,
+}
+
+// redacted replaces the value of sensitive attributes
+const redacted = "[REDACTED]"
+
+func redact(_ []string, attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	switch {
+	case redactedKeys[key]:
+		return slog.String(attr.Key, redacted)
+	case ipKeys[key]:
+		return slog.String(attr.Key, RedactIP(attr.Value.String()))
+	}
+	return attr
+}
+
+// RedactIP truncates an IP address to its network, zeroing the last octet
+// of IPv4 addresses and all but the first 48 bits of IPv6 ones. Values that
+// are not IP addresses are redacted entirely.
+func RedactIP(value string) string {
+	ip := net.ParseIP(value)
+	switch {
+	case ip == nil:
+		if value == "" {
+			return value
+		}
+		return redacted
+	case ip.To4() != nil:
+		return ip.Mask(net.CIDRMask(24, 32)).String()
+	default:
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	}
+}
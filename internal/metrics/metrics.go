@@ -0,0 +1,175 @@
+// Package metrics defines the Prometheus metrics exported on /metrics.
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// namespace prefixes every LinkSprint metric
+const namespace = "linksprint"
+
+// Results of a redirect cache lookup; negative means the short code was
+// cached as not found, and stale that the link was past its TTL and served
+// while looked up again
+const (
+	CacheHit      = "hit"
+	CacheMiss     = "miss"
+	CacheError    = "error"
+	CacheNegative = "negative"
+	CacheStale    = "stale"
+)
+
+// Reasons for looking a cached link up again in the background
+const (
+	RefreshEarly = "early"
+	RefreshStale = "stale"
+)
+
+// Tiers of the link cache
+const (
+	CacheTierLocal = "local"
+	CacheTierRedis = "redis"
+)
+
+var (
+	// HTTPRequests counts handled requests by method, route pattern and
+	// status code
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration observes request latency by method, route pattern and
+	// status code
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status code.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"method", "route", "status"})
+
+	// RedirectCache counts redirect cache lookups by result: hit, miss,
+	// error or negative
+	RedirectCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirect_cache_lookups_total",
+		Help:      "Redirect cache lookups by result (hit, miss, error, negative, stale).",
+	}, []string{"result"})
+
+	// CacheRefreshes counts background lookups of cached links by reason:
+	// early, before the link expires, or stale, after it did
+	CacheRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_refreshes_total",
+		Help:      "Background lookups of cached links by reason (early, stale).",
+	}, []string{"reason"})
+
+	// CacheLookups counts link cache lookups by tier (local, redis) and
+	// result, for the hit rate of each tier
+	CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Link cache lookups by tier (local, redis) and result (hit, miss, error, negative).",
+	}, []string{"tier", "result"})
+
+	// FilterRejections counts redirects to short codes the Bloom filter of
+	// existing links ruled out, answered without a database query
+	FilterRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bloom_filter_rejections_total",
+		Help:      "Redirects to unknown short codes rejected by the Bloom filter.",
+	})
+
+	// ClicksFlushed counts clicks moved from the Redis click counters to
+	// the database
+	ClicksFlushed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "clicks_flushed_total",
+		Help:      "Clicks flushed from the Redis click counters to the database.",
+	})
+
+	// LinksCreated counts short links created
+	LinksCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "links_created_total",
+		Help:      "Short links created.",
+	})
+)
+
+// ClickQueue is the click pipeline as seen by its metrics
+type ClickQueue interface {
+	// Depth returns the number of clicks waiting to be recorded
+	Depth() int
+	// Dropped returns the number of clicks dropped because the queue was full
+	Dropped() int64
+}
+
+// RegisterClickQueue exports the queue depth and dropped clicks of the
+// click pipeline
+func RegisterClickQueue(queue ClickQueue) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "click_queue_depth",
+			Help:      "Clicks waiting to be recorded.",
+		}, func() float64 { return float64(queue.Depth()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "clicks_dropped_total",
+			Help:      "Clicks dropped because the click queue was full.",
+		}, func() float64 { return float64(queue.Dropped()) }),
+	)
+}
+
+// RegisterDB exports the connection pool stats of the database, labelled
+// with its name
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterRedis exports the connection pool stats of the Redis client
+func RegisterRedis(client *goredis.Client) {
+	prometheus.MustRegister(&redisPoolCollector{client: client})
+}
+
+// redisPoolCollector reads the Redis pool stats at scrape time
+type redisPoolCollector struct {
+	client *goredis.Client
+}
+
+var (
+	redisPoolHits = prometheus.NewDesc(namespace+"_redis_pool_hits_total",
+		"Times a free connection was found in the pool.", nil, nil)
+	redisPoolMisses = prometheus.NewDesc(namespace+"_redis_pool_misses_total",
+		"Times a free connection was not found in the pool.", nil, nil)
+	redisPoolTimeouts = prometheus.NewDesc(namespace+"_redis_pool_timeouts_total",
+		"Times waiting for a connection timed out.", nil, nil)
+	redisPoolConns = prometheus.NewDesc(namespace+"_redis_pool_connections",
+		"Connections in the pool by state (idle, in_use).", []string{"state"}, nil)
+	redisPoolStale = prometheus.NewDesc(namespace+"_redis_pool_stale_connections_total",
+		"Stale connections removed from the pool.", nil, nil)
+)
+
+func (c *redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- redisPoolHits
+	ch <- redisPoolMisses
+	ch <- redisPoolTimeouts
+	ch <- redisPoolConns
+	ch <- redisPoolStale
+}
+
+func (c *redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(redisPoolHits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(redisPoolMisses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(redisPoolTimeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(redisPoolConns, prometheus.GaugeValue, float64(stats.IdleConns), "idle")
+	ch <- prometheus.MustNewConstMetric(redisPoolConns, prometheus.GaugeValue, float64(stats.TotalConns-stats.IdleConns), "in_use")
+	ch <- prometheus.MustNewConstMetric(redisPoolStale, prometheus.CounterValue, float64(stats.StaleConns))
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"linksprint/internal/models"
+	"linksprint/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// principalKey is the fiber.Ctx locals key holding the authenticated caller
+const principalKey = "principal"
+
+// TokenVerifier validates JWT access tokens and returns their caller
+type TokenVerifier interface {
+	VerifyAccessToken(ctx context.Context, token string) (*models.Principal, error)
+}
+
+// APIKeyVerifier validates API keys presented from a client IP
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key, clientIP string) (*models.Principal, error)
+}
+
+// WorkspaceResolver picks the workspace a principal acts in
+type WorkspaceResolver interface {
+	ResolveWorkspace(ctx context.Context, principal *models.Principal, workspaceID string) error
+}
+
+// RequireAuth rejects requests without a valid bearer credential and stores
+// the authenticated principal in the request context. The bearer value may
+// be a JWT access token or an API key.
+func RequireAuth(tokens TokenVerifier, apiKeys APIKeyVerifier) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := bearerToken(c)
+		if token == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authorization header with a bearer token is required",
+			})
+		}
+
+		var (
+			principal *models.Principal
+			err       error
+		)
+		if strings.HasPrefix(token, services.APIKeyPrefix) {
+			principal, err = apiKeys.VerifyAPIKey(c.UserContext(), token, ClientIP(c))
+		} else {
+			principal, err = tokens.VerifyAccessToken(c.UserContext(), token)
+		}
+		if errors.Is(err, services.ErrAuthUnavailable) {
+			logger.ErrorContext(c.UserContext(), "failed to verify credential", slog.Any("error", err))
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "Authentication is temporarily unavailable",
+			})
+		}
+		if errors.Is(err, services.ErrIPNotAllowed) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired token",
+			})
+		}
+
+		c.Locals(principalKey, principal)
+		if principal.IsAPIKey() {
+			withLogAttrs(c, slog.String("api_key_id", principal.APIKeyID))
+		} else {
+			withLogAttrs(c, slog.String("user_id", principal.UserID))
+		}
+		return c.Next()
+	}
+}
+
+// ResolveWorkspace sets the workspace the principal acts in, taken from the
+// X-Workspace-ID header or else the principal's default workspace, together
+// with the principal's role there
+func ResolveWorkspace(resolver WorkspaceResolver) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := CurrentPrincipal(c)
+		if principal == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authentication required",
+			})
+		}
+
+		err := resolver.ResolveWorkspace(c.UserContext(), principal, c.Get("X-Workspace-ID"))
+		switch {
+		case errors.Is(err, services.ErrWorkspaceNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrForbidden):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "API key belongs to a different workspace",
+			})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		withLogAttrs(c, slog.String("workspace_id", principal.WorkspaceID))
+		return c.Next()
+	}
+}
+
+// RequireUser rejects callers authenticated with an API key, for endpoints
+// that need a signed-in user such as API key management
+func RequireUser() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal := CurrentPrincipal(c)
+		if principal == nil || principal.IsAPIKey() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "This endpoint requires a signed-in user",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// CurrentPrincipal returns the principal set by RequireAuth, or nil for
+// anonymous requests
+func CurrentPrincipal(c *fiber.Ctx) *models.Principal {
+	principal, _ := c.Locals(principalKey).(*models.Principal)
+	return principal
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header
+func bearerToken(c *fiber.Ctx) string {
+	header := c.Get(fiber.HeaderAuthorization)
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
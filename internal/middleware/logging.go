@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"linksprint/internal/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// accessLog is the logger of the access log
+var accessLog = logging.For("access")
+
+// AccessLog writes a line per request with its route, status, latency,
+// client IP, request ID and caller. Requests to the routes named in
+// sampleRates are logged at the rate returned for them, from 0 to 1, unless
+// they fail; the rates are fetched on every request so reloads apply. It
+// must run after RequestContext.
+func AccessLog(sampleRates func() map[string]float64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		if err := c.Next(); err != nil {
+			if handlerErr := c.App().Config().ErrorHandler(c, err); handlerErr != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		if rate, ok := sampleRates()[c.Route().Name]; ok && status < fiber.StatusBadRequest && rand.Float64() >= rate {
+			return nil
+		}
+
+		route := c.Route().Path
+		if route == "/" && c.Path() != "/" {
+			route = unmatchedRoute
+		}
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Method()),
+			slog.String("path", c.Path()),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", ClientIP(c)),
+		}
+		if shortCode := c.Params("shortCode"); shortCode != "" {
+			attrs = append(attrs, slog.String("short_code", shortCode))
+		}
+		accessLog.LogAttrs(c.UserContext(), level, "request", attrs...)
+		return nil
+	}
+}
+
+// withLogAttrs adds attributes to the log lines of the rest of the request
+func withLogAttrs(c *fiber.Ctx, attrs ...slog.Attr) {
+	c.SetUserContext(logging.With(c.UserContext(), attrs...))
+}
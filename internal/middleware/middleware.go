@@ -1,38 +1,115 @@
 package middleware
 
 import (
+	"log/slog"
 	"time"
 
+	"linksprint/internal/audit"
+	"linksprint/internal/clientip"
+	"linksprint/internal/config"
+	"linksprint/internal/logging"
+
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
-	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// RateLimiter creates a rate limiter middleware
-func RateLimiter() fiber.Handler {
-	return limiter.New(limiter.Config{
-		Max:        100,             // Maximum number of requests
-		Expiration: 1 * time.Minute, // Time window
-		KeyGenerator: func(c *fiber.Ctx) string {
-			return c.IP() // Use IP as key
-		},
-		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error":       "Rate limit exceeded",
-				"retry_after": "1 minute",
+// logger is the logger of the middleware package
+var logger = logging.For("middleware")
+
+// RequestID adds a request ID to each request and its response. It is the
+// trace ID when the request is traced, so logs and traces can be joined;
+// otherwise the caller's X-Request-ID is kept if it is a valid request ID,
+// or a new ID generated. The ID is stored in the "requestid" local.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var id string
+		if spanContext := trace.SpanContextFromContext(c.UserContext()); spanContext.HasTraceID() {
+			id = spanContext.TraceID().String()
+		} else if header := c.Get(fiber.HeaderXRequestID); validRequestID(header) {
+			id = utils.CopyString(header)
+		} else {
+			id = time.Now().Format("20060102150405") + "-" + utils.UUIDv4()[:8]
+		}
+
+		c.Set(fiber.HeaderXRequestID, id)
+		c.Locals("requestid", id)
+		return c.Next()
+	}
+}
+
+// maxRequestIDLength is the longest request ID accepted from callers, the
+// size of audit_events.request_id
+const maxRequestIDLength = 64
+
+// validRequestID reports whether a caller's request ID is safe to echo, log
+// and store: 1 to 64 letters, digits, dots, underscores or hyphens
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// clientIPKey is the fiber.Ctx locals key holding the resolved client IP
+const clientIPKey = "client_ip"
+
+// ResolveClientIP resolves the client IP behind trusted proxies once per
+// request; read it with ClientIP. It must run before anything using the
+// client IP, such as RequestContext and rate limiting.
+func ResolveClientIP(resolver *clientip.Resolver) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ip := resolver.Resolve(c.Context().RemoteIP(), func(header string) string {
+			return c.Get(header)
+		})
+		c.Locals(clientIPKey, ip)
+		return c.Next()
+	}
+}
+
+// ClientIP returns the client IP set by ResolveClientIP, falling back to the
+// connection's address
+func ClientIP(c *fiber.Ctx) string {
+	if ip, ok := c.Locals(clientIPKey).(string); ok {
+		return ip
+	}
+	return c.IP()
+}
+
+// Blocklist refuses requests from blocked client IPs. The blocklist is
+// fetched on every request so reloads apply immediately. It must run after
+// ResolveClientIP.
+func Blocklist(blocklist func() *config.Blocklist) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if blocklist().BlocksIP(ClientIP(c)) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Access denied",
 			})
-		},
-	})
+		}
+		return c.Next()
+	}
 }
 
-// RequestID adds a unique request ID to each request
-func RequestID() fiber.Handler {
-	return requestid.New(requestid.Config{
-		Header: "X-Request-ID",
-		Generator: func() string {
-			return time.Now().Format("20060102150405") + "-" + fiber.RandomString(8)
-		},
-	})
+// RequestContext stores the client IP and request ID in the request's user
+// context, where services pick them up for the audit log and log lines. It must run after
+// RequestID and ResolveClientIP.
+func RequestContext() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestID, _ := c.Locals("requestid").(string)
+		ctx := audit.WithRequest(c.UserContext(), audit.Request{
+			IPAddress: ClientIP(c),
+			RequestID: requestID,
+		})
+		c.SetUserContext(logging.With(ctx, slog.String("request_id", requestID)))
+		return c.Next()
+	}
 }
 
 // SecurityHeaders adds security headers to responses
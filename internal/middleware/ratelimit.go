@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"linksprint/internal/config"
+	"linksprint/internal/redis"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RateLimiter checks a request against a limit of limit requests per period
+// for a key, and charges extra requests; it is implemented by redis.Client
+type RateLimiter interface {
+	AllowRate(ctx context.Context, key string, limit int, period time.Duration) (*redis.RateLimitResult, error)
+	ChargeRate(ctx context.Context, key string, limit int, period time.Duration, n int) error
+}
+
+// RateLimit enforces a named rate limit policy shared by all replicas.
+// Callers are identified by API key, then signed-in user, then client IP, so
+// on authenticated routes it should run after RequireAuth. Responses carry
+// the RateLimit-* headers, and Retry-After when the limit is exceeded. If
+// the limiter is unavailable requests are let through. The policy is looked
+// up by name on every request so reloaded limits apply immediately.
+func RateLimit(limiter RateLimiter, name string, policies func(name string) config.RateLimit) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		policy := policies(name)
+		if policy.Limit <= 0 {
+			return c.Next()
+		}
+
+		result, err := limiter.AllowRate(c.UserContext(), rateLimitKey(c, name), policy.Limit, policy.Period)
+		if err != nil {
+			logger.WarnContext(c.UserContext(), "rate limiter unavailable, allowing request", slog.String("policy", name), slog.Any("error", err))
+			return c.Next()
+		}
+
+		c.Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		c.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, ceilSeconds(policy.Period)))
+
+		if !result.Allowed {
+			retryAfter := ceilSeconds(result.RetryAfter)
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":       "Rate limit exceeded",
+				"retry_after": retryAfter,
+			})
+		}
+		return c.Next()
+	}
+}
+
+// ChargeNotFound makes requests answered with 404 count as cost requests
+// against a named rate limit policy, so clients scanning for resources run
+// into the limit sooner. It runs after RateLimit for the same policy, which
+// has already counted one.
+func ChargeNotFound(limiter RateLimiter, name string, policies func(name string) config.RateLimit, cost func() int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		policy, extra := policies(name), cost()-1
+		if c.Response().StatusCode() != fiber.StatusNotFound || policy.Limit <= 0 || extra <= 0 {
+			return nil
+		}
+		if err := limiter.ChargeRate(c.UserContext(), rateLimitKey(c, name), policy.Limit, policy.Period, extra); err != nil {
+			logger.WarnContext(c.UserContext(), "failed to charge rate limit", slog.String("policy", name), slog.Any("error", err))
+		}
+		return nil
+	}
+}
+
+// rateLimitKey is the key a request is counted under for a policy
+func rateLimitKey(c *fiber.Ctx, name string) string {
+	return fmt.Sprintf("ratelimit:%s:%s", name, rateLimitIdentity(c))
+}
+
+// rateLimitIdentity names the caller a request is counted against
+func rateLimitIdentity(c *fiber.Ctx) string {
+	if principal := CurrentPrincipal(c); principal != nil {
+		if principal.IsAPIKey() {
+			return "key:" + principal.APIKeyID
+		}
+		return "user:" + principal.UserID
+	}
+	return "ip:" + ClientIP(c)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
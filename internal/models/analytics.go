@@ -6,27 +6,45 @@ import (
 
 // Analytics represents a click event
 type Analytics struct {
-	ID        string    `json:"id" db:"id"`
-	URLID     string    `json:"url_id" db:"url_id"`
-	ShortCode string    `json:"short_code" db:"short_code"`
-	IPAddress string    `json:"ip_address,omitempty" db:"ip_address"`
-	UserAgent string    `json:"user_agent,omitempty" db:"user_agent"`
-	Referer   string    `json:"referer,omitempty" db:"referer"`
-	Country   string    `json:"country,omitempty" db:"country"`
-	City      string    `json:"city,omitempty" db:"city"`
-	ClickedAt time.Time `json:"clicked_at" db:"clicked_at"`
+	ID        string `json:"id" db:"id"`
+	URLID     string `json:"url_id" db:"url_id"`
+	ShortCode string `json:"short_code" db:"short_code"`
+	IPAddress string `json:"ip_address,omitempty" db:"ip_address"`
+	UserAgent string `json:"user_agent,omitempty" db:"user_agent"`
+	Referer   string `json:"referer,omitempty" db:"referer"`
+	Country   string `json:"country,omitempty" db:"country"`
+	City      string `json:"city,omitempty" db:"city"`
+	// RefererDomain, Device and Browser classify the click for the rollups
+	RefererDomain string    `json:"referer_domain,omitempty" db:"referer_domain"`
+	Device        string    `json:"device,omitempty" db:"device"`
+	Browser       string    `json:"browser,omitempty" db:"browser"`
+	VisitorID     string    `json:"visitor_id,omitempty" db:"visitor_id"`
+	ClickedAt     time.Time `json:"clicked_at" db:"clicked_at"`
+	// RecordedAt is when the click was stored, by the database's clock
+	RecordedAt time.Time `json:"-" db:"recorded_at"`
+}
+
+// ClickListResponse represents a page of raw click events fetched by cursor
+type ClickListResponse struct {
+	Clicks     []Analytics `json:"clicks"`
+	Limit      int         `json:"limit"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	HasMore    bool        `json:"has_more"`
+	Total      *int64      `json:"total,omitempty"`
 }
 
 // AnalyticsSummary represents aggregated analytics data
 type AnalyticsSummary struct {
-	ShortCode     string    `json:"short_code"`
-	TotalClicks   int64     `json:"total_clicks"`
-	UniqueClicks  int64     `json:"unique_clicks"`
-	TopCountries  []Country `json:"top_countries"`
-	TopCities     []City    `json:"top_cities"`
-	TopReferers   []Referer `json:"top_referers"`
-	ClickTrend    []ClickTrend `json:"click_trend"`
-	LastClickedAt *time.Time `json:"last_clicked_at,omitempty"`
+	ShortCode     string       `json:"short_code"`
+	TotalClicks   int64        `json:"total_clicks"`
+	UniqueClicks  int64        `json:"unique_clicks"`
+	TopCountries  []Country    `json:"top_countries"`
+	TopCities     []City       `json:"top_cities"`
+	TopReferers   []Referer    `json:"top_referers"`
+	TopDevices    []Device     `json:"top_devices"`
+	TopBrowsers   []Browser    `json:"top_browsers"`
+	Series        *ClickSeries `json:"series"`
+	LastClickedAt *time.Time   `json:"last_clicked_at,omitempty"`
 }
 
 // Country represents country analytics
@@ -41,34 +59,100 @@ type City struct {
 	Count int64  `json:"count"`
 }
 
-// Referer represents referer analytics
+// Referer represents referer analytics, by referring domain
 type Referer struct {
-	URL   string `json:"url"`
+	Domain string `json:"domain"`
+	Count  int64  `json:"count"`
+}
+
+// Device represents device analytics: desktop, mobile, tablet or bot
+type Device struct {
+	Name  string `json:"name"`
 	Count int64  `json:"count"`
 }
 
-// ClickTrend represents click trends over time
-type ClickTrend struct {
-	Date  string `json:"date"`
+// Browser represents browser analytics
+type Browser struct {
+	Name  string `json:"name"`
 	Count int64  `json:"count"`
 }
 
+// Intervals clicks are bucketed by in a click series
+const (
+	IntervalMinute = "minute"
+	IntervalHour   = "hour"
+	IntervalDay    = "day"
+	IntervalWeek   = "week"
+	IntervalMonth  = "month"
+)
+
+// ClickRange selects a click series: the time range, the interval clicks
+// are bucketed by and the IANA time zone the buckets start in. Empty fields
+// take defaults.
+type ClickRange struct {
+	From     *time.Time
+	To       *time.Time
+	Interval string
+	Timezone string
+}
+
+// ClickSeries represents the clicks of a link per interval over a range,
+// every interval included, compared with the period of the same length
+// just before it
+type ClickSeries struct {
+	Interval string    `json:"interval"`
+	Timezone string    `json:"timezone"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Total    int64     `json:"total"`
+	// Unique counts the distinct visitors of the UTC days the range touches
+	Unique   int64        `json:"unique"`
+	Points   []ClickPoint `json:"points"`
+	Previous ClickPeriod  `json:"previous"`
+	// Change is the percentage change of Total from the previous period,
+	// null when the previous period has no clicks
+	Change *float64 `json:"change"`
+}
+
+// ClickPeriod represents the clicks of the period a series is compared
+// with; its points line up with those of the series
+type ClickPeriod struct {
+	From   time.Time    `json:"from"`
+	To     time.Time    `json:"to"`
+	Total  int64        `json:"total"`
+	Unique int64        `json:"unique"`
+	Points []ClickPoint `json:"points"`
+}
+
+// ClickPoint represents the clicks of the interval starting at Time
+type ClickPoint struct {
+	Time  time.Time `json:"time"`
+	Count int64     `json:"count"`
+}
+
 // GlobalAnalytics represents global statistics
 type GlobalAnalytics struct {
-	TotalURLs      int64 `json:"total_urls"`
-	TotalClicks    int64 `json:"total_clicks"`
-	ActiveURLs     int64 `json:"active_urls"`
-	TodayClicks    int64 `json:"today_clicks"`
-	ThisWeekClicks int64 `json:"this_week_clicks"`
+	TotalURLs       int64 `json:"total_urls"`
+	TotalClicks     int64 `json:"total_clicks"`
+	ActiveURLs      int64 `json:"active_urls"`
+	TodayClicks     int64 `json:"today_clicks"`
+	ThisWeekClicks  int64 `json:"this_week_clicks"`
 	ThisMonthClicks int64 `json:"this_month_clicks"`
 }
 
 // AnalyticsRequest represents the request to track analytics
 type AnalyticsRequest struct {
 	ShortCode string `json:"short_code" validate:"required"`
+	Domain    string `json:"-"`
 	IPAddress string `json:"ip_address,omitempty"`
 	UserAgent string `json:"user_agent,omitempty"`
 	Referer   string `json:"referer,omitempty"`
 	Country   string `json:"country,omitempty"`
 	City      string `json:"city,omitempty"`
-} 
\ No newline at end of file
+	// VisitorID identifies the visitor by their cookie; it defaults to a
+	// hash of the IP address and user agent
+	VisitorID string `json:"-"`
+	// ClickedAt is when a redirect happened; it defaults to the time the
+	// click is recorded
+	ClickedAt time.Time `json:"-"`
+}
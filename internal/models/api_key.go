@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// API key scopes
+const (
+	ScopeLinksWrite    = "links:write"
+	ScopeLinksRead     = "links:read"
+	ScopeAnalyticsRead = "analytics:read"
+)
+
+// AllScopes lists every scope an API key can be granted
+var AllScopes = []string{ScopeLinksWrite, ScopeLinksRead, ScopeAnalyticsRead}
+
+// APIKey represents a key used by programmatic clients. Keys belong to a
+// workspace and act with the role of the user who created them, limited to
+// their scopes. Only a hash of the secret is stored; the prefix stays visible
+// so keys can be told apart.
+type APIKey struct {
+	ID          string     `json:"id" db:"id"`
+	UserID      string     `json:"user_id" db:"user_id"`
+	WorkspaceID string     `json:"workspace_id,omitempty" db:"workspace_id"`
+	Name        string     `json:"name" db:"name"`
+	Prefix      string     `json:"prefix" db:"prefix"`
+	KeyHash     string     `json:"-" db:"key_hash"`
+	Scopes      []string   `json:"scopes" db:"scopes"`
+	AllowedIPs  []string   `json:"allowed_ips,omitempty" db:"allowed_ips"`
+	Plan        string     `json:"plan,omitempty" db:"plan"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	LastUsedIP  string     `json:"last_used_ip,omitempty" db:"last_used_ip"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CreateAPIKeyRequest represents the request to create an API key
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name" validate:"required"`
+	Scopes     []string   `json:"scopes" validate:"required"`
+	AllowedIPs []string   `json:"allowed_ips,omitempty"`
+	Plan       string     `json:"plan,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateAPIKeyResponse carries the new key; the secret is only shown once
+type CreateAPIKeyResponse struct {
+	*APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditLinkCreate       = "link.create"
+	AuditLinkUpdate       = "link.update"
+	AuditLinkDelete       = "link.delete"
+	AuditAPIKeyCreate     = "api_key.create"
+	AuditAPIKeyRevoke     = "api_key.revoke"
+	AuditWorkspaceCreate  = "workspace.create"
+	AuditWorkspaceUpdate  = "workspace.update"
+	AuditMemberUpdate     = "member.update"
+	AuditMemberRemove     = "member.remove"
+	AuditInvitationCreate = "invitation.create"
+	AuditInvitationRevoke = "invitation.revoke"
+	AuditInvitationAccept = "invitation.accept"
+	AuditUserRegister     = "user.register"
+)
+
+// AuditEvent represents a recorded administrative action. Before and After
+// hold the fields of the target that the action changed.
+type AuditEvent struct {
+	ID            string          `json:"id" db:"id"`
+	WorkspaceID   string          `json:"workspace_id,omitempty" db:"workspace_id"`
+	ActorUserID   string          `json:"actor_user_id,omitempty" db:"actor_user_id"`
+	ActorAPIKeyID string          `json:"actor_api_key_id,omitempty" db:"actor_api_key_id"`
+	Action        string          `json:"action" db:"action"`
+	TargetType    string          `json:"target_type" db:"target_type"`
+	TargetID      string          `json:"target_id" db:"target_id"`
+	Before        json.RawMessage `json:"before,omitempty" db:"before_state"`
+	After         json.RawMessage `json:"after,omitempty" db:"after_state"`
+	IPAddress     string          `json:"ip_address,omitempty" db:"ip_address"`
+	RequestID     string          `json:"request_id,omitempty" db:"request_id"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+}
+
+// AuditFilter narrows audit log queries; empty fields match everything
+type AuditFilter struct {
+	Action     string
+	ActorID    string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+}
+
+// AuditListResponse represents a page of audit events, newest first
+type AuditListResponse struct {
+	Events     []AuditEvent `json:"events"`
+	Limit      int          `json:"limit"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+	HasMore    bool         `json:"has_more"`
+}
@@ -1,31 +1,71 @@
 package models
 
 import (
+	"net/http"
 	"time"
 )
 
+// DefaultRedirectType is the status code links redirect with unless they
+// were given another one
+const DefaultRedirectType = http.StatusMovedPermanently
+
+// ValidRedirectType reports whether code is a redirect status code links
+// can use: 301, 302, 307 or 308
+func ValidRedirectType(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// Redirect is where a short link sends visitors, and how
+type Redirect struct {
+	OriginalURL string
+	// Domain is the domain the link was found on, "" for the default one
+	Domain     string
+	StatusCode int
+}
+
 // URL represents a shortened URL
 type URL struct {
-	ID          string    `json:"id" db:"id"`
-	ShortCode   string    `json:"short_code" db:"short_code"`
-	OriginalURL string    `json:"original_url" db:"original_url"`
-	Title       string    `json:"title,omitempty" db:"title"`
-	Description string    `json:"description,omitempty" db:"description"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
-	CreatedBy   string    `json:"created_by,omitempty" db:"created_by"`
-	IsActive    bool      `json:"is_active" db:"is_active"`
+	ID          string     `json:"id" db:"id"`
+	ShortCode   string     `json:"short_code" db:"short_code"`
+	OriginalURL string     `json:"original_url" db:"original_url"`
+	Title       string     `json:"title,omitempty" db:"title"`
+	Description string     `json:"description,omitempty" db:"description"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	CreatedBy   string     `json:"created_by,omitempty" db:"created_by"`
+	WorkspaceID string     `json:"workspace_id,omitempty" db:"workspace_id"`
+	Domain      string     `json:"domain,omitempty" db:"domain"`
+	IsActive    bool       `json:"is_active" db:"is_active"`
 	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
-	ClickCount  int64     `json:"click_count,omitempty"`
+	// RedirectType is the HTTP status code visitors are redirected with
+	RedirectType int   `json:"redirect_type" db:"redirect_type"`
+	ClickCount   int64 `json:"click_count,omitempty"`
 }
 
 // CreateURLRequest represents the request to create a new URL
 type CreateURLRequest struct {
-	OriginalURL string `json:"original_url" validate:"required,url"`
-	Title       string `json:"title,omitempty"`
-	Description string `json:"description,omitempty"`
-	CustomCode  string `json:"custom_code,omitempty"`
+	OriginalURL string     `json:"original_url" validate:"required,url"`
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	CustomCode  string     `json:"custom_code,omitempty"`
 	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	// RedirectType is 301 (the default), 302, 307 or 308
+	RedirectType int `json:"redirect_type,omitempty"`
+}
+
+// UpdateURLRequest represents the request to repoint or edit a URL; omitted
+// fields are left unchanged
+type UpdateURLRequest struct {
+	OriginalURL *string    `json:"original_url,omitempty"`
+	Title       *string    `json:"title,omitempty"`
+	Description *string    `json:"description,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	// RedirectType is 301, 302, 307 or 308
+	RedirectType *int `json:"redirect_type,omitempty"`
 }
 
 // CreateURLResponse represents the response when creating a URL
@@ -38,20 +78,29 @@ type CreateURLResponse struct {
 
 // URLListResponse represents the response for listing URLs
 type URLListResponse struct {
-	URLs        []URL `json:"urls"`
-	Total       int   `json:"total"`
-	Page        int   `json:"page"`
-	PerPage     int   `json:"per_page"`
-	TotalPages  int   `json:"total_pages"`
+	URLs       []URL `json:"urls"`
+	Total      int   `json:"total"`
+	Page       int   `json:"page"`
+	PerPage    int   `json:"per_page"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// URLCursorListResponse represents a page of URLs fetched by cursor
+type URLCursorListResponse struct {
+	URLs       []URL  `json:"urls"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Total      *int64 `json:"total,omitempty"`
 }
 
 // URLStats represents statistics for a URL
 type URLStats struct {
-	ShortCode     string    `json:"short_code"`
-	OriginalURL   string    `json:"original_url"`
-	TotalClicks   int64     `json:"total_clicks"`
-	UniqueClicks  int64     `json:"unique_clicks"`
-	CreatedAt     time.Time `json:"created_at"`
+	ShortCode     string     `json:"short_code"`
+	OriginalURL   string     `json:"original_url"`
+	TotalClicks   int64      `json:"total_clicks"`
+	UniqueClicks  int64      `json:"unique_clicks"`
+	CreatedAt     time.Time  `json:"created_at"`
 	LastClickedAt *time.Time `json:"last_clicked_at,omitempty"`
 }
 
@@ -63,7 +112,7 @@ func (u *URL) IsExpired() bool {
 	return time.Now().After(*u.ExpiresAt)
 }
 
-// IsActive checks if the URL is active and not expired
-func (u *URL) IsActive() bool {
+// IsAvailable checks if the URL is active and not expired
+func (u *URL) IsAvailable() bool {
 	return u.IsActive && !u.IsExpired()
-} 
\ No newline at end of file
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+)
+
+// Plan holds the quotas of a plan; zero means unlimited
+type Plan struct {
+	Name                string `json:"name"`
+	LinksPerMonth       int64  `json:"links_per_month"`
+	ActiveLinks         int64  `json:"active_links"`
+	CustomCodesPerMonth int64  `json:"custom_codes_per_month"`
+	ClicksPerMonth      int64  `json:"clicks_per_month"`
+}
+
+// Plan names
+const (
+	PlanFree       = "free"
+	PlanTeam       = "team"
+	PlanEnterprise = "enterprise"
+)
+
+// Plans lists the available plans by name
+var Plans = map[string]Plan{
+	PlanFree: {
+		Name:                PlanFree,
+		LinksPerMonth:       1000,
+		ActiveLinks:         500,
+		CustomCodesPerMonth: 50,
+		ClicksPerMonth:      100000,
+	},
+	PlanTeam: {
+		Name:                PlanTeam,
+		LinksPerMonth:       20000,
+		ActiveLinks:         10000,
+		CustomCodesPerMonth: 2000,
+		ClicksPerMonth:      5000000,
+	},
+	PlanEnterprise: {
+		Name: PlanEnterprise,
+	},
+}
+
+// Metered usage
+const (
+	MetricLinksCreated = "links_created"
+	MetricCustomCodes  = "custom_codes"
+	MetricClicks       = "clicks"
+	MetricActiveLinks  = "active_links"
+)
+
+// Limit returns the plan's quota for a metric; zero means unlimited
+func (p Plan) Limit(metric string) int64 {
+	switch metric {
+	case MetricLinksCreated:
+		return p.LinksPerMonth
+	case MetricCustomCodes:
+		return p.CustomCodesPerMonth
+	case MetricClicks:
+		return p.ClicksPerMonth
+	case MetricActiveLinks:
+		return p.ActiveLinks
+	}
+	return 0
+}
+
+// UsageMetric reports consumption of one metric; a nil Limit is unlimited
+type UsageMetric struct {
+	Used  int64  `json:"used"`
+	Limit *int64 `json:"limit"`
+}
+
+// UsageReport reports a workspace's or API key's consumption against its plan
+type UsageReport struct {
+	Plan    string                 `json:"plan"`
+	Metrics map[string]UsageMetric `json:"metrics"`
+}
+
+// UsageResponse represents the usage of the current workspace, and of the
+// calling API key when it has its own plan
+type UsageResponse struct {
+	WorkspaceID string       `json:"workspace_id"`
+	Period      string       `json:"period"`
+	ResetsAt    time.Time    `json:"resets_at"`
+	Workspace   UsageReport  `json:"workspace"`
+	APIKey      *UsageReport `json:"api_key,omitempty"`
+}
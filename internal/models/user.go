@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+)
+
+// User represents a registered account
+type User struct {
+	ID           string    `json:"id" db:"id"`
+	Email        string    `json:"email" db:"email"`
+	PasswordHash string    `json:"-" db:"password_hash"`
+	Name         string    `json:"name,omitempty" db:"name"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	IsActive     bool      `json:"is_active" db:"is_active"`
+}
+
+// RegisterRequest represents the request to create an account
+type RegisterRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8"`
+	Name     string `json:"name,omitempty"`
+}
+
+// LoginRequest represents the request to sign in
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// RefreshRequest carries a refresh token for rotation or logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// AuthResponse represents the tokens issued after register, login or refresh
+type AuthResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	User         *User  `json:"user"`
+}
+
+// Principal identifies the authenticated caller of a request
+type Principal struct {
+	UserID  string
+	Email   string
+	TokenID string
+
+	// APIKeyID and Scopes are set when the caller used an API key. Callers
+	// signed in with a password hold every scope.
+	APIKeyID string
+	Scopes   []string
+	// APIKeyPlan caps the key's own usage on top of its workspace's plan
+	APIKeyPlan string
+
+	// WorkspaceID and Role describe the workspace the request acts in. API
+	// keys are bound to the workspace they were created in.
+	WorkspaceID string
+	Role        Role
+}
+
+// IsAPIKey reports whether the caller authenticated with an API key
+func (p *Principal) IsAPIKey() bool {
+	return p.APIKeyID != ""
+}
+
+// HasScope reports whether the caller may act within the given scope
+func (p *Principal) HasScope(scope string) bool {
+	if !p.IsAPIKey() {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the caller's role in the current workspace grants the
+// permission. API keys are further limited to their scopes.
+func (p *Principal) Can(perm Permission) bool {
+	if p.WorkspaceID == "" || !p.Role.Can(perm) {
+		return false
+	}
+	return p.HasScope(string(perm))
+}
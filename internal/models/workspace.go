@@ -0,0 +1,124 @@
+package models
+
+import (
+	"time"
+)
+
+// Role is a member's role within a workspace
+type Role string
+
+// Workspace roles, from most to least privileged
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+)
+
+// Permission is an action that roles and API key scopes grant
+type Permission string
+
+// Permissions checked by the services. The links and analytics permissions
+// share their names with the API key scopes that grant them.
+const (
+	PermLinksRead       Permission = ScopeLinksRead
+	PermLinksWrite      Permission = ScopeLinksWrite
+	PermAnalyticsRead   Permission = ScopeAnalyticsRead
+	PermAPIKeysManage   Permission = "api_keys:manage"
+	PermMembersManage   Permission = "members:manage"
+	PermWorkspaceManage Permission = "workspace:manage"
+	PermAuditRead       Permission = "audit:read"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleViewer: {PermLinksRead, PermAnalyticsRead},
+	RoleEditor: {PermLinksRead, PermAnalyticsRead, PermLinksWrite},
+	RoleAdmin:  {PermLinksRead, PermAnalyticsRead, PermLinksWrite, PermAPIKeysManage, PermMembersManage, PermAuditRead},
+	RoleOwner:  {PermLinksRead, PermAnalyticsRead, PermLinksWrite, PermAPIKeysManage, PermMembersManage, PermAuditRead, PermWorkspaceManage},
+}
+
+// IsValid reports whether r is a known role
+func (r Role) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants a permission
+func (r Role) Can(perm Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Workspace groups links and the members allowed to manage them
+type Workspace struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Slug      string    `json:"slug" db:"slug"`
+	Domain    string    `json:"domain,omitempty" db:"domain"`
+	Plan      string    `json:"plan" db:"plan"`
+	CreatedBy string    `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	Role      Role      `json:"role,omitempty"`
+}
+
+// WorkspaceMember represents a user's membership in a workspace
+type WorkspaceMember struct {
+	WorkspaceID string    `json:"workspace_id" db:"workspace_id"`
+	UserID      string    `json:"user_id" db:"user_id"`
+	Email       string    `json:"email"`
+	Name        string    `json:"name,omitempty"`
+	Role        Role      `json:"role" db:"role"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// WorkspaceInvitation represents a pending invitation to join a workspace
+type WorkspaceInvitation struct {
+	ID          string     `json:"id" db:"id"`
+	WorkspaceID string     `json:"workspace_id" db:"workspace_id"`
+	Email       string     `json:"email" db:"email"`
+	Role        Role       `json:"role" db:"role"`
+	InvitedBy   string     `json:"invited_by" db:"invited_by"`
+	ExpiresAt   time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CreateWorkspaceRequest represents the request to create a workspace
+type CreateWorkspaceRequest struct {
+	Name   string `json:"name" validate:"required"`
+	Domain string `json:"domain,omitempty"`
+}
+
+// UpdateWorkspaceRequest represents the request to rename a workspace or
+// change its short link domain
+type UpdateWorkspaceRequest struct {
+	Name   *string `json:"name,omitempty"`
+	Domain *string `json:"domain,omitempty"`
+}
+
+// UpdateMemberRequest represents the request to change a member's role
+type UpdateMemberRequest struct {
+	Role Role `json:"role" validate:"required"`
+}
+
+// CreateInvitationRequest represents the request to invite someone
+type CreateInvitationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  Role   `json:"role" validate:"required"`
+}
+
+// CreateInvitationResponse carries the invitation token; it is only shown once
+type CreateInvitationResponse struct {
+	*WorkspaceInvitation
+	Token string `json:"token"`
+}
+
+// AcceptInvitationRequest represents the request to accept an invitation
+type AcceptInvitationRequest struct {
+	Token string `json:"token" validate:"required"`
+}
@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrBloomNotReady is returned by BloomTest when the filter was never fully
+// built, for example after Redis lost its data
+var ErrBloomNotReady = errors.New("bloom filter not built")
+
+// bloomTestScript checks the bits of a member in a Bloom filter bitmap,
+// returning -1 unless the filter was built (KEYS[2] is set), then 1 if all
+// bits are set and 0 otherwise
+var bloomTestScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	return -1
+end
+for _, position in ipairs(ARGV) do
+	if redis.call('GETBIT', KEYS[1], position) == 0 then
+		return 0
+	end
+end
+return 1
+`)
+
+// BloomTest reports whether all bits at positions are set in the Bloom
+// filter bitmap at key, or returns ErrBloomNotReady
+func (c *Client) BloomTest(ctx context.Context, key string, positions []uint64) (bool, error) {
+	args := make([]interface{}, len(positions))
+	for i, p := range positions {
+		args[i] = p
+	}
+	found, err := bloomTestScript.Run(ctx, c.Client, []string{key, bloomReadyKey(key)}, args...).Int()
+	if err != nil {
+		return false, err
+	}
+	if found < 0 {
+		return false, ErrBloomNotReady
+	}
+	return found == 1, nil
+}
+
+// BloomAdd sets the bits at positions in the Bloom filter bitmap at key
+func (c *Client) BloomAdd(ctx context.Context, key string, positions []uint64) error {
+	_, err := c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, p := range positions {
+			pipe.SetBit(ctx, key, int64(p), 1)
+		}
+		return nil
+	})
+	return err
+}
+
+// BloomMerge ORs bits into the Bloom filter bitmap at key and marks the
+// filter as built. Bits set concurrently by BloomAdd are kept.
+func (c *Client) BloomMerge(ctx context.Context, key string, bits []byte) error {
+	merging := key + ":merging"
+	_, err := c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, merging, bits, 0)
+		pipe.BitOpOr(ctx, key, key, merging)
+		pipe.Del(ctx, merging)
+		pipe.Set(ctx, bloomReadyKey(key), 1, 0)
+		return nil
+	})
+	return err
+}
+
+// bloomReadyKey is set once the Bloom filter at key was fully built
+func bloomReadyKey(key string) string {
+	return key + ":ready"
+}
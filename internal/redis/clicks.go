@@ -0,0 +1,155 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Click counts share the {clicks} hash tag, so a flush moves them between
+// keys in one script on a cluster too
+const (
+	// pendingClicksKey is the hash of the clicks counted per link since
+	// they were last taken for a flush
+	pendingClicksKey = "{clicks}:pending"
+	// pendingMinutesKey is the hash of the same clicks per minute they were
+	// stored in and link, by fields <unix minute>:<link ID>
+	pendingMinutesKey = "{clicks}:pending:minutes"
+	// flushesKey is the sorted set of the flushes taken and not dropped yet,
+	// scored by the unix minute their clicks were stored before
+	flushesKey = "{clicks}:flushes"
+)
+
+// flushingKey is the hash of the clicks per link taken for a flush
+func flushingKey(flushID string) string {
+	return "{clicks}:flushing:" + flushID
+}
+
+// ClickFlush holds the clicks taken for a flush
+type ClickFlush struct {
+	// Before is the time the clicks were stored before
+	Before time.Time
+	// Counts holds the clicks by link ID
+	Counts map[string]int64
+}
+
+// takeClicksScript takes the pending clicks stored before the minute ARGV[2]
+// in one step: those stored before the minute ARGV[3] are dropped, and the
+// rest are moved to the hash of flush ARGV[1] and returned. Clicks counted
+// meanwhile are left for the next flush.
+var takeClicksScript = redis.NewScript(`
+local before, drop = tonumber(ARGV[2]), tonumber(ARGV[3])
+local taken = false
+local fields = redis.call('HGETALL', KEYS[2])
+for i = 1, #fields, 2 do
+	local minute, urlID = string.match(fields[i], '^(-?%d+):(.+)$')
+	minute = tonumber(minute)
+	if minute < before then
+		local count = tonumber(fields[i + 1])
+		redis.call('HDEL', KEYS[2], fields[i])
+		if redis.call('HINCRBY', KEYS[1], urlID, -count) <= 0 then
+			redis.call('HDEL', KEYS[1], urlID)
+		end
+		if minute >= drop then
+			redis.call('HINCRBY', KEYS[3], urlID, count)
+			taken = true
+		end
+	end
+end
+if not taken then
+	return {}
+end
+redis.call('ZADD', KEYS[4], before, ARGV[1])
+return redis.call('HGETALL', KEYS[3])
+`)
+
+// IncrementPendingClicks counts a click on a link, stored at recordedAt,
+// until it is flushed
+func (c *Client) IncrementPendingClicks(ctx context.Context, urlID string, recordedAt time.Time) error {
+	_, err := c.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, pendingClicksKey, urlID, 1)
+		pipe.HIncrBy(ctx, pendingMinutesKey, strconv.FormatInt(unixMinute(recordedAt), 10)+":"+urlID, 1)
+		return nil
+	})
+	return err
+}
+
+// GetPendingClicks returns the clicks counted on a link since the last
+// flush, or 0
+func (c *Client) GetPendingClicks(ctx context.Context, urlID string) (int64, error) {
+	count, err := c.Client.HGet(ctx, pendingClicksKey, urlID).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return count, err
+}
+
+// TakePendingClicks moves the pending clicks of every link stored before
+// before to flush flushID and returns them, dropping those stored before
+// drop. Times are truncated to the minute. The clicks taken are kept until
+// DropFlushedClicks, so a flush cut short can be applied again.
+func (c *Client) TakePendingClicks(ctx context.Context, flushID string, before, drop time.Time) (map[string]int64, error) {
+	values, err := takeClicksScript.Run(ctx, c.Client,
+		[]string{pendingClicksKey, pendingMinutesKey, flushingKey(flushID), flushesKey},
+		flushID, unixMinute(before), unixMinute(drop)).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	return parseClickCounts(values)
+}
+
+// UnflushedClicks returns the flushes taken and not dropped, by flush ID
+func (c *Client) UnflushedClicks(ctx context.Context) (map[string]ClickFlush, error) {
+	flushes, err := c.Client.ZRangeWithScores(ctx, flushesKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	unflushed := make(map[string]ClickFlush, len(flushes))
+	for _, flush := range flushes {
+		flushID, _ := flush.Member.(string)
+		values, err := c.Client.HGetAll(ctx, flushingKey(flushID)).Result()
+		if err != nil {
+			return nil, err
+		}
+		counts := make(map[string]int64, len(values))
+		for urlID, value := range values {
+			if counts[urlID], err = strconv.ParseInt(value, 10, 64); err != nil {
+				return nil, err
+			}
+		}
+		unflushed[flushID] = ClickFlush{Before: time.Unix(int64(flush.Score)*60, 0).UTC(), Counts: counts}
+	}
+	return unflushed, nil
+}
+
+// DropFlushedClicks forgets flush flushID once its clicks are in the
+// database
+func (c *Client) DropFlushedClicks(ctx context.Context, flushID string) error {
+	_, err := c.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, flushingKey(flushID))
+		pipe.ZRem(ctx, flushesKey, flushID)
+		return nil
+	})
+	return err
+}
+
+// unixMinute returns the minutes from the Unix epoch to the minute of t
+func unixMinute(t time.Time) int64 {
+	return t.Truncate(time.Minute).Unix() / 60
+}
+
+// parseClickCounts parses the field and value pairs of a click count hash
+func parseClickCounts(values []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		count, err := strconv.ParseInt(values[i+1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		counts[values[i]] = count
+	}
+	return counts, nil
+}
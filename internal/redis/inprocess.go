@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// clockTick is how often the in-process server's keys age
+const clockTick = time.Second
+
+// NewInProcess starts a Redis server inside the process and connects a
+// client to it, for single-instance deployments without Redis. Caching,
+// rate limits, usage counters and token revocation keep working, but only
+// for this process and only until it exits.
+func NewInProcess(options Options) (*Client, error) {
+	server := miniredis.NewMiniRedis()
+	if err := server.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start in-process Redis: %w", err)
+	}
+
+	client, err := NewClientWithOptions("redis://"+server.Addr(), options)
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	stop := make(chan struct{})
+	go runClock(server, stop)
+	client.stopServer = func() {
+		close(stop)
+		server.Close()
+	}
+
+	logger.Warn("using in-process Redis; its state is lost on restart and not shared between replicas")
+	return client, nil
+}
+
+// runClock expires keys of the in-process server, whose TTLs only run down
+// when told to, until stop is closed
+func runClock(server *miniredis.Miniredis, stop <-chan struct{}) {
+	ticker := time.NewTicker(clockTick)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			server.SetTime(now)
+			server.FastForward(now.Sub(last))
+			last = now
+		}
+	}
+}
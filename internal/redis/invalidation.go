@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// invalidationChannel carries the links whose cached destination changed,
+// so every instance drops its in-process copy
+const invalidationChannel = "linksprint:url-invalidations"
+
+// resubscribeDelay is how long to wait before receiving again after the
+// subscription failed
+const resubscribeDelay = time.Second
+
+// PublishURLInvalidation tells every instance that the cached destination
+// of a link changed
+func (c *Client) PublishURLInvalidation(ctx context.Context, shortCode string) error {
+	return c.Publish(ctx, invalidationChannel, shortCode).Err()
+}
+
+// SubscribeURLInvalidations calls invalidate with every link invalidated by
+// any instance, until the returned function is called. Invalidations
+// published while the subscription is down are lost, so reset is called
+// whenever it is (re)established or fails.
+func (c *Client) SubscribeURLInvalidations(invalidate func(shortCode string), reset func()) (stop func()) {
+	ctx := context.Background()
+	pubsub := c.Subscribe(ctx, invalidationChannel)
+
+	var stopped atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			// Receive ignores cancellation while blocked, so stopping
+			// closes the subscription instead
+			msg, err := pubsub.Receive(ctx)
+			if stopped.Load() {
+				return
+			}
+			if err != nil {
+				logger.Warn("URL invalidation subscription failed", slog.Any("error", err))
+				reset()
+				time.Sleep(resubscribeDelay)
+				continue
+			}
+
+			switch msg := msg.(type) {
+			case *redis.Subscription:
+				reset()
+			case *redis.Message:
+				invalidate(msg.Payload)
+			}
+		}
+	}()
+
+	return func() {
+		stopped.Store(true)
+		pubsub.Close()
+		<-done
+	}
+}
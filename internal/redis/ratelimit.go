@@ -0,0 +1,84 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitResult is the outcome of a rate limit check
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+	ResetAfter time.Duration
+}
+
+// gcraScript implements the generic cell rate algorithm. The key stores the
+// theoretical arrival time (TAT) in milliseconds; a request is allowed when
+// it would not push the TAT more than one period ahead of now. Redis time is
+// used so every replica shares the same clock.
+var gcraScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if tat == nil or tat < now then
+	tat = now
+end
+
+local new_tat = tat + interval
+local allow_at = new_tat - period
+if allow_at > now then
+	return {0, 0, math.ceil(allow_at - now), math.ceil(tat - now)}
+end
+
+redis.call('SET', KEYS[1], new_tat, 'PX', math.ceil(new_tat - now))
+local remaining = math.floor((period - (new_tat - now)) / interval)
+return {1, remaining, 0, math.ceil(new_tat - now)}
+`)
+
+// AllowRate checks one request against a limit of limit requests per period,
+// allowing bursts of up to limit requests
+func (c *Client) AllowRate(ctx context.Context, key string, limit int, period time.Duration) (*RateLimitResult, error) {
+	interval := float64(period.Milliseconds()) / float64(limit)
+	values, err := gcraScript.Run(ctx, c.Client, []string{key}, interval, period.Milliseconds()).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	return &RateLimitResult{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		ResetAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+// chargeScript pushes the TAT of a GCRA key forward by ARGV[3] requests
+// without checking them, capped at one period ahead of now so the caller
+// is blocked for at most a period
+var chargeScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if tat == nil or tat < now then
+	tat = now
+end
+
+local new_tat = math.min(tat + interval * n, now + period)
+redis.call('SET', KEYS[1], new_tat, 'PX', math.ceil(new_tat - now))
+return 1
+`)
+
+// ChargeRate counts n more requests against a limit checked by AllowRate
+func (c *Client) ChargeRate(ctx context.Context, key string, limit int, period time.Duration, n int) error {
+	interval := float64(period.Milliseconds()) / float64(limit)
+	return chargeScript.Run(ctx, c.Client, []string{key}, interval, period.Milliseconds(), n).Err()
+}
@@ -2,20 +2,47 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"time"
 
+	"linksprint/internal/logging"
+
 	"github.com/redis/go-redis/v9"
 )
 
+// logger is the logger of the redis package
+var logger = logging.For("redis")
+
+// defaultURLTTL is how long resolved links stay cached by default
+const defaultURLTTL = 24 * time.Hour
+
 // Client wraps the Redis client
 type Client struct {
 	*redis.Client
+	urlTTL      time.Duration
+	urlStaleTTL time.Duration
+
+	// stopServer stops the in-process server, if any; see NewInProcess
+	stopServer func()
 }
 
-// NewClient creates a new Redis client
+// Options tunes the Redis client; zero values keep the defaults
+type Options struct {
+	PoolSize int
+	URLTTL   time.Duration
+	// URLStaleTTL keeps cached links this long past URLTTL, for serving
+	// while they are looked up again
+	URLStaleTTL time.Duration
+}
+
+// NewClient creates a new Redis client with the default options
 func NewClient(redisURL string) (*Client, error) {
+	return NewClientWithOptions(redisURL, Options{})
+}
+
+// NewClientWithOptions creates a new Redis client
+func NewClientWithOptions(redisURL string, options Options) (*Client, error) {
 	opts, err := redis.ParseURL(redisURL)
 	if err != nil {
 		// If URL parsing fails, try to connect to localhost
@@ -26,7 +53,16 @@ func NewClient(redisURL string) (*Client, error) {
 		}
 	}
 
+	if options.PoolSize > 0 {
+		opts.PoolSize = options.PoolSize
+	}
+	urlTTL := options.URLTTL
+	if urlTTL <= 0 {
+		urlTTL = defaultURLTTL
+	}
+
 	client := redis.NewClient(opts)
+	client.AddHook(tracingHook{})
 
 	// Test the connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -36,8 +72,13 @@ func NewClient(redisURL string) (*Client, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	log.Println("✅ Redis connected successfully")
-	return &Client{client}, nil
+	logger.Info("redis connected")
+	return &Client{Client: client, urlTTL: urlTTL, urlStaleTTL: options.URLStaleTTL}, nil
+}
+
+// IsNil reports whether err means the key does not exist
+func IsNil(err error) bool {
+	return errors.Is(err, redis.Nil)
 }
 
 // SetWithTTL sets a key with a TTL
@@ -66,40 +107,56 @@ func (c *Client) Increment(ctx context.Context, key string) (int64, error) {
 	return c.Client.Incr(ctx, key).Result()
 }
 
-// SetURL sets a URL in cache with default TTL
-func (c *Client) SetURL(ctx context.Context, shortCode, originalURL string) error {
+// SetURL caches the record of a short link for ttl
+func (c *Client) SetURL(ctx context.Context, shortCode, record string, ttl time.Duration) error {
 	key := fmt.Sprintf("url:%s", shortCode)
-	return c.SetWithTTL(ctx, key, originalURL, 24*time.Hour)
+	return c.SetWithTTL(ctx, key, record, ttl)
 }
 
-// GetURL gets a URL from cache
-func (c *Client) GetURL(ctx context.Context, shortCode string) (string, error) {
+// URLCacheTTLs returns how long cached URLs stay fresh, and how long they
+// are kept stale after that
+func (c *Client) URLCacheTTLs() (ttl, staleTTL time.Duration) {
+	return c.urlTTL, c.urlStaleTTL
+}
+
+// SetURLNotFound caches for ttl that a short code resolves to no link,
+// stored as an empty record
+func (c *Client) SetURLNotFound(ctx context.Context, shortCode string, ttl time.Duration) error {
 	key := fmt.Sprintf("url:%s", shortCode)
-	return c.Get(ctx, key)
+	return c.SetWithTTL(ctx, key, "", ttl)
 }
 
-// IncrementClickCount increments the click count for a URL
-func (c *Client) IncrementClickCount(ctx context.Context, shortCode string) error {
-	key := fmt.Sprintf("clicks:%s", shortCode)
-	_, err := c.Increment(ctx, key)
-	return err
+// GetURL gets the cached record of a short link
+func (c *Client) GetURL(ctx context.Context, shortCode string) (string, error) {
+	key := fmt.Sprintf("url:%s", shortCode)
+	return c.Get(ctx, key)
 }
 
-// GetClickCount gets the click count for a URL
-func (c *Client) GetClickCount(ctx context.Context, shortCode string) (int64, error) {
-	key := fmt.Sprintf("clicks:%s", shortCode)
-	result, err := c.Get(ctx, key)
+// GetURLWithTTL gets the cached record of a short link together with the
+// time it has left there
+func (c *Client) GetURLWithTTL(ctx context.Context, shortCode string) (string, time.Duration, error) {
+	key := fmt.Sprintf("url:%s", shortCode)
+	var (
+		get *redis.StringCmd
+		ttl *redis.DurationCmd
+	)
+	_, err := c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		ttl = pipe.PTTL(ctx, key)
+		return nil
+	})
 	if err != nil {
-		return 0, err
+		return "", 0, err
 	}
-	
-	// Parse the result as int64
-	var count int64
-	_, err = fmt.Sscanf(result, "%d", &count)
-	return count, err
+	return get.Val(), ttl.Val(), nil
 }
 
-// Close closes the Redis connection
+// Close closes the Redis connection, and stops the in-process server if
+// there is one
 func (c *Client) Close() error {
-	return c.Client.Close()
-} 
\ No newline at end of file
+	err := c.Client.Close()
+	if c.stopServer != nil {
+		c.stopServer()
+	}
+	return err
+}
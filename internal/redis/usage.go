@@ -0,0 +1,101 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// usageMonthTTL keeps monthly counters until the month is safely over
+	usageMonthTTL = 40 * 24 * time.Hour
+	// usageDayTTL keeps daily counters until they have been rolled up
+	usageDayTTL = 3 * 24 * time.Hour
+)
+
+// UsageKeys names the counters of one metered metric. Day counters are
+// listed under DayIndex as Member so the rollup can find them.
+type UsageKeys struct {
+	Month    string
+	Day      string
+	DayIndex string
+	Member   string
+}
+
+// ErrUsageNotSeeded is returned by ConsumeUsage when the monthly counter
+// does not exist yet and must be seeded with SeedUsage first
+var ErrUsageNotSeeded = errors.New("usage counter not seeded")
+
+// consumeScript adds to the monthly counter unless that would exceed the
+// limit, then mirrors the amount in the daily counter
+var consumeScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return {0, -1}
+end
+local n = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local used = redis.call('INCRBY', KEYS[1], n)
+if limit > 0 and used > limit then
+	redis.call('DECRBY', KEYS[1], n)
+	return {used - n, 0}
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('INCRBY', KEYS[2], n)
+redis.call('PEXPIRE', KEYS[2], ARGV[4])
+redis.call('SADD', KEYS[3], ARGV[5])
+redis.call('PEXPIRE', KEYS[3], ARGV[4])
+return {used, 1}
+`)
+
+// ConsumeUsage adds n to a metric unless its monthly total would exceed
+// limit; a zero limit is unlimited. It returns the monthly total and
+// whether the amount was added.
+func (c *Client) ConsumeUsage(ctx context.Context, keys UsageKeys, n, limit int64) (int64, bool, error) {
+	values, err := consumeScript.Run(ctx, c.Client, []string{keys.Month, keys.Day, keys.DayIndex},
+		n, limit, usageMonthTTL.Milliseconds(), usageDayTTL.Milliseconds(), keys.Member).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	if values[1] == -1 {
+		return 0, false, ErrUsageNotSeeded
+	}
+	return values[0], values[1] == 1, nil
+}
+
+// RefundUsage takes back an amount added by ConsumeUsage
+func (c *Client) RefundUsage(ctx context.Context, keys UsageKeys, n int64) error {
+	pipe := c.Client.TxPipeline()
+	pipe.DecrBy(ctx, keys.Month, n)
+	pipe.DecrBy(ctx, keys.Day, n)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SeedUsage initializes missing counters from the rolled-up totals, so usage
+// survives Redis losing its data; existing counters are left alone
+func (c *Client) SeedUsage(ctx context.Context, keys UsageKeys, month, day int64) error {
+	pipe := c.Client.TxPipeline()
+	pipe.SetNX(ctx, keys.Month, month, usageMonthTTL)
+	pipe.SetNX(ctx, keys.Day, day, usageDayTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetUsage returns the value of a usage counter; a missing counter is nil
+func (c *Client) GetUsage(ctx context.Context, key string) (*int64, error) {
+	value, err := c.Client.Get(ctx, key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// UsageDayMembers lists the counters recorded under a day index
+func (c *Client) UsageDayMembers(ctx context.Context, dayIndex string) ([]string, error) {
+	return c.Client.SMembers(ctx, dayIndex).Result()
+}
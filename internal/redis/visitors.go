@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// visitorsTTL is how long the daily visitors of a link are kept
+const visitorsTTL = 400 * 24 * time.Hour
+
+// maxVisitorDays bounds the days counted at once, matching visitorsTTL
+const maxVisitorDays = 400
+
+// visitorsKey is the HyperLogLog of the visitors of a link on a UTC day.
+// The link ID is a hash tag, so the days of a link share a cluster slot and
+// can be counted together.
+func visitorsKey(urlID string, day time.Time) string {
+	return "visitors:{" + urlID + "}:" + day.UTC().Format("2006-01-02")
+}
+
+// AddVisitors adds visitors to the visitors of a link on the UTC day of t
+func (c *Client) AddVisitors(ctx context.Context, urlID string, t time.Time, visitorIDs ...string) error {
+	if len(visitorIDs) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(visitorIDs))
+	for i, id := range visitorIDs {
+		members[i] = id
+	}
+	key := visitorsKey(urlID, t)
+	pipe := c.Client.Pipeline()
+	pipe.PFAdd(ctx, key, members...)
+	pipe.Expire(ctx, key, visitorsTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// CountVisitors estimates the distinct visitors of a link over the UTC days
+// from from to to, both included, merging their HyperLogLogs. Days before
+// the last maxVisitorDays have expired and are skipped.
+func (c *Client) CountVisitors(ctx context.Context, urlID string, from, to time.Time) (int64, error) {
+	from, to = from.UTC().Truncate(24*time.Hour), to.UTC().Truncate(24*time.Hour)
+	if earliest := to.AddDate(0, 0, -maxVisitorDays+1); from.Before(earliest) {
+		from = earliest
+	}
+	var keys []string
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		keys = append(keys, visitorsKey(urlID, day))
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	return c.Client.PFCount(ctx, keys...).Result()
+}
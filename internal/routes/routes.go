@@ -2,30 +2,106 @@ package routes
 
 import (
 	"linksprint/internal/handlers"
+	"linksprint/internal/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// RedirectRoute names the short link redirect route, whose access log is
+// sampled
+const RedirectRoute = "redirect"
+
+// Handlers groups the HTTP handlers and middleware wired into the routes
+type Handlers struct {
+	URL        *handlers.URLHandler
+	Analytics  *handlers.AnalyticsHandler
+	Auth       *handlers.AuthHandler
+	APIKeys    *handlers.APIKeyHandler
+	Workspaces *handlers.WorkspaceHandler
+	Audit      *handlers.AuditHandler
+	Usage      *handlers.UsageHandler
+	Health     *handlers.HealthHandler
+	// Metrics serves the Prometheus metrics
+	Metrics     fiber.Handler
+	RequireAuth fiber.Handler
+	// ResolveWorkspace picks the workspace a request acts in; it runs after
+	// RequireAuth
+	ResolveWorkspace fiber.Handler
+	// RateLimit returns the middleware enforcing a named rate limit policy
+	RateLimit func(policy string) fiber.Handler
+	// ChargeNotFound returns the middleware charging 404 responses extra
+	// against a named rate limit policy; it runs after RateLimit
+	ChargeNotFound func(policy string) fiber.Handler
+}
+
 // SetupRoutes configures all application routes
-func SetupRoutes(app *fiber.App, urlHandler *handlers.URLHandler, analyticsHandler *handlers.AnalyticsHandler) {
-	// API v1 group
-	api := app.Group("/api/v1")
+func SetupRoutes(app *fiber.App, h Handlers) {
+	// Health probes; /health is kept for older deployments and reports
+	// readiness
+	app.Get("/livez", h.Health.Livez)
+	app.Get("/readyz", h.Health.Readyz)
+	app.Get("/health", h.Health.Readyz)
+	app.Get("/metrics", h.Metrics)
+
+	// API v1 group. The api_ip limit counts every request per client IP
+	// before it is authenticated, so floods of bogus credentials are turned
+	// away too; the api limit applies once the caller is known, so it counts
+	// per API key or user.
+	api := app.Group("/api/v1", h.RateLimit("api_ip"))
+	limit := h.RateLimit("api")
+
+	// Authentication endpoints
+	auth := api.Group("/auth", h.RateLimit("auth"))
+	auth.Post("/register", h.Auth.Register)
+	auth.Post("/login", h.Auth.Login)
+	auth.Post("/refresh", h.Auth.Refresh)
+	auth.Post("/logout", h.RequireAuth, middleware.RequireUser(), h.Auth.Logout)
+
+	// Workspace endpoints (signed-in users only)
+	workspaces := api.Group("/workspaces", h.RequireAuth, middleware.RequireUser(), limit)
+	workspaces.Post("/", h.Workspaces.CreateWorkspace)
+	workspaces.Get("/", h.Workspaces.ListWorkspaces)
+	workspaces.Patch("/:id", h.Workspaces.UpdateWorkspace)
+	workspaces.Get("/:id/members", h.Workspaces.ListMembers)
+	workspaces.Put("/:id/members/:userId", h.Workspaces.UpdateMember)
+	workspaces.Delete("/:id/members/:userId", h.Workspaces.RemoveMember)
+	workspaces.Post("/:id/invitations", h.Workspaces.CreateInvitation)
+	workspaces.Get("/:id/invitations", h.Workspaces.ListInvitations)
+	workspaces.Delete("/:id/invitations/:invitationId", h.Workspaces.RevokeInvitation)
+	api.Post("/invitations/accept", h.RequireAuth, middleware.RequireUser(), limit, h.Workspaces.AcceptInvitation)
+
+	// API key management endpoints (signed-in users only)
+	apiKeys := api.Group("/api-keys", h.RequireAuth, middleware.RequireUser(), h.ResolveWorkspace, limit)
+	apiKeys.Post("/", h.APIKeys.CreateAPIKey)
+	apiKeys.Get("/", h.APIKeys.ListAPIKeys)
+	apiKeys.Delete("/:id", h.APIKeys.RevokeAPIKey)
 
-	// URL shortening endpoints
-	urls := api.Group("/urls")
-	urls.Post("/shorten", urlHandler.CreateShortURL)
-	urls.Get("/", urlHandler.ListURLs)
-	urls.Get("/:shortCode/stats", urlHandler.GetURLStats)
-	urls.Delete("/:shortCode", urlHandler.DeleteURL)
+	// URL shortening endpoints; permissions are checked against the
+	// principal's role and API key scopes by the services
+	urls := api.Group("/urls", h.RequireAuth, h.ResolveWorkspace, limit)
+	urls.Post("/shorten", h.RateLimit("create"), h.URL.CreateShortURL)
+	urls.Get("/", h.URL.ListURLs)
+	urls.Get("/:shortCode/stats", h.URL.GetURLStats)
+	urls.Patch("/:shortCode", h.URL.UpdateURL)
+	urls.Delete("/:shortCode", h.URL.DeleteURL)
 
 	// Analytics endpoints
-	analytics := api.Group("/analytics")
-	analytics.Get("/:shortCode", analyticsHandler.GetAnalytics)
-	analytics.Get("/global", analyticsHandler.GetGlobalAnalytics)
-	analytics.Post("/track", analyticsHandler.TrackClick)
+	analytics := api.Group("/analytics", h.RequireAuth, h.ResolveWorkspace, limit, h.RateLimit("analytics"))
+	analytics.Get("/global", h.Analytics.GetGlobalAnalytics)
+	analytics.Get("/:shortCode", h.Analytics.GetAnalytics)
+	analytics.Get("/:shortCode/clicks", h.Analytics.ListClicks)
+	analytics.Post("/track", h.Analytics.TrackClick)
+
+	// Audit log endpoints
+	auditLog := api.Group("/audit", h.RequireAuth, h.ResolveWorkspace, limit)
+	auditLog.Get("/", h.Audit.ListEvents)
+	auditLog.Get("/export", h.Audit.ExportEvents)
+
+	// Plan usage endpoint
+	api.Get("/usage", h.RequireAuth, h.ResolveWorkspace, limit, h.Usage.GetUsage)
 
 	// Redirect endpoint (must be last to avoid conflicts)
-	app.Get("/:shortCode", urlHandler.RedirectToOriginal)
+	app.Get("/:shortCode", h.RateLimit("redirect"), h.ChargeNotFound("redirect"), h.URL.RedirectToOriginal).Name(RedirectRoute)
 
 	// API documentation endpoint
 	api.Get("/", func(c *fiber.Ctx) error {
@@ -34,16 +110,48 @@ func SetupRoutes(app *fiber.App, urlHandler *handlers.URLHandler, analyticsHandl
 			"version":     "1.0.0",
 			"description": "Distributed URL Shortener & Analytics API",
 			"endpoints": fiber.Map{
+				"auth": fiber.Map{
+					"POST /api/v1/auth/register": "Create an account",
+					"POST /api/v1/auth/login":    "Sign in and get tokens",
+					"POST /api/v1/auth/refresh":  "Rotate a refresh token",
+					"POST /api/v1/auth/logout":   "Revoke the current session",
+				},
+				"workspaces": fiber.Map{
+					"POST /api/v1/workspaces":                                 "Create a workspace",
+					"GET /api/v1/workspaces":                                  "List your workspaces",
+					"PATCH /api/v1/workspaces/:id":                            "Rename a workspace or set its domain",
+					"GET /api/v1/workspaces/:id/members":                      "List members",
+					"PUT /api/v1/workspaces/:id/members/:userId":              "Change a member's role",
+					"DELETE /api/v1/workspaces/:id/members/:userId":           "Remove a member",
+					"POST /api/v1/workspaces/:id/invitations":                 "Invite someone by email",
+					"GET /api/v1/workspaces/:id/invitations":                  "List pending invitations",
+					"DELETE /api/v1/workspaces/:id/invitations/:invitationId": "Revoke an invitation",
+					"POST /api/v1/invitations/accept":                         "Accept an invitation",
+				},
+				"api_keys": fiber.Map{
+					"POST /api/v1/api-keys":       "Create a scoped API key",
+					"GET /api/v1/api-keys":        "List your API keys",
+					"DELETE /api/v1/api-keys/:id": "Revoke an API key",
+				},
 				"urls": fiber.Map{
 					"POST /api/v1/urls/shorten":         "Create a short URL",
-					"GET /api/v1/urls":                  "List all URLs",
+					"GET /api/v1/urls":                  "List all URLs (page/per_page, or cursor/limit)",
 					"GET /api/v1/urls/:shortCode/stats": "Get URL statistics",
+					"PATCH /api/v1/urls/:shortCode":     "Repoint or edit a URL",
 					"DELETE /api/v1/urls/:shortCode":    "Delete a URL",
 				},
 				"analytics": fiber.Map{
-					"GET /api/v1/analytics/:shortCode": "Get analytics for a URL",
-					"GET /api/v1/analytics/global":     "Get global analytics",
-					"POST /api/v1/analytics/track":     "Track a click event",
+					"GET /api/v1/analytics/:shortCode":        "Get analytics for a URL",
+					"GET /api/v1/analytics/:shortCode/clicks": "List raw click events (cursor/limit)",
+					"GET /api/v1/analytics/global":            "Get global analytics",
+					"POST /api/v1/analytics/track":            "Track a click event",
+				},
+				"audit": fiber.Map{
+					"GET /api/v1/audit":        "List audit events (cursor/limit)",
+					"GET /api/v1/audit/export": "Export audit events as NDJSON",
+				},
+				"usage": fiber.Map{
+					"GET /api/v1/usage": "Get this month's usage against plan quotas",
 				},
 				"redirect": fiber.Map{
 					"GET /:shortCode": "Redirect to original URL",
@@ -2,110 +2,328 @@ package services
 
 import (
 	"context"
-	"database/sql"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
-	"linksprint/internal/database"
+	"linksprint/internal/metrics"
 	"linksprint/internal/models"
-	"linksprint/internal/redis"
+	"linksprint/internal/pagination"
+	"linksprint/internal/store"
+	"linksprint/internal/tracing"
+	"linksprint/internal/useragent"
+	"linksprint/internal/visitor"
+)
+
+const (
+	// rollupDelay is how long after an hour ends the clicks stored in it are
+	// rolled up, leaving clicks being stored time to commit
+	rollupDelay = 5 * time.Minute
+	// clickCountDelay is how long after a minute ends the clicks stored in
+	// it are flushed to the click counters, leaving clicks being stored time
+	// to commit and be counted in the cache
+	clickCountDelay = time.Minute
+	// maxRollupHours bounds the hours rolled up per RollUpClicks call, so a
+	// backlog is caught up over several runs
+	maxRollupHours = 24
 )
 
 // AnalyticsService handles analytics business logic
 type AnalyticsService struct {
-	db    *database.DB
-	redis *redis.Client
+	urls   store.URLStore
+	clicks store.ClickStore
+	cache  store.Cache
+	usage  *UsageService
+	// visitorKey keys the hash identifying visitors without a cookie
+	visitorKey []byte
 }
 
-// NewAnalyticsService creates a new analytics service
-func NewAnalyticsService(db *database.DB, redis *redis.Client) *AnalyticsService {
+// NewAnalyticsService creates a new analytics service on stores, metering
+// tracked clicks through usage and identifying visitors without a cookie
+// with visitorKey
+func NewAnalyticsService(stores Stores, usage *UsageService, visitorKey []byte) *AnalyticsService {
 	return &AnalyticsService{
-		db:    db,
-		redis: redis,
+		urls:       stores.URLs,
+		clicks:     stores.Clicks,
+		cache:      stores.Cache,
+		usage:      usage,
+		visitorKey: visitorKey,
 	}
 }
 
 // TrackClick tracks a click event
 func (s *AnalyticsService) TrackClick(ctx context.Context, req *models.AnalyticsRequest) error {
-	// Get URL ID from short code
-	urlID, err := s.getURLIDByShortCode(ctx, req.ShortCode)
+	ctx, span := tracing.Start(ctx, "AnalyticsService.TrackClick")
+	defer span.End()
+
+	return s.RecordClick(ctx, req)
+}
+
+// RecordClick stores a click event after charging it to the tracked click
+// quota of the link's workspace, and counts it on the link's click counter
+// and among the link's visitors of the day.
+// Clicks beyond the quota are neither stored nor counted and return
+// ErrQuotaExceeded.
+func (s *AnalyticsService) RecordClick(ctx context.Context, req *models.AnalyticsRequest) error {
+	ctx, span := tracing.Start(ctx, "AnalyticsService.RecordClick")
+	defer span.End()
+
+	target, err := s.clicks.ClickTarget(ctx, req.Domain, req.ShortCode)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrURLNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("URL not found: %w", err)
+		return err
 	}
 
-	// Insert analytics record
-	_, err = s.db.ExecContext(ctx, `
-		INSERT INTO analytics (url_id, short_code, ip_address, user_agent, referer, country, city)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, urlID, req.ShortCode, req.IPAddress, req.UserAgent, req.Referer, req.Country, req.City)
-	if err != nil {
-		return fmt.Errorf("failed to track click: %w", err)
+	if target.WorkspaceID != "" {
+		ok, err := s.usage.ConsumeClick(ctx, target.WorkspaceID, target.Plan)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrQuotaExceeded
+		}
 	}
 
-	// Increment click count in Redis
-	s.redis.IncrementClickCount(ctx, req.ShortCode)
+	clickedAt := req.ClickedAt
+	if clickedAt.IsZero() {
+		clickedAt = time.Now().UTC()
+	}
+	visitorID := req.VisitorID
+	if visitorID == "" {
+		visitorID = visitor.ID(s.visitorKey, req.IPAddress, req.UserAgent)
+	}
 
+	// Insert analytics record, classified for the rollups
+	click := &models.Analytics{
+		URLID:         target.URLID,
+		ShortCode:     req.ShortCode,
+		IPAddress:     req.IPAddress,
+		UserAgent:     req.UserAgent,
+		Referer:       req.Referer,
+		Country:       req.Country,
+		City:          req.City,
+		RefererDomain: useragent.RefererDomain(req.Referer),
+		Device:        useragent.Device(req.UserAgent),
+		Browser:       useragent.Browser(req.UserAgent),
+		VisitorID:     visitorID,
+		ClickedAt:     clickedAt,
+	}
+	if err := s.clicks.InsertClick(ctx, click); err != nil {
+		return err
+	}
+
+	// Count the click until it is flushed to the link's counter; counters
+	// rebuilt by ReconcileClickCounters repair clicks lost here
+	if err := s.cache.IncrementClicks(ctx, target.URLID, click.RecordedAt); err != nil {
+		logger.WarnContext(ctx, "failed to count click", slog.String("short_code", req.ShortCode), slog.Any("error", err))
+	}
+	// Likewise RebuildVisitors repairs visitors lost here
+	if err := s.cache.AddVisitors(ctx, target.URLID, clickedAt, visitorID); err != nil {
+		logger.WarnContext(ctx, "failed to count visitor", slog.String("short_code", req.ShortCode), slog.Any("error", err))
+	}
 	return nil
 }
 
-// GetAnalytics gets analytics for a specific URL
-func (s *AnalyticsService) GetAnalytics(ctx context.Context, shortCode string) (*models.AnalyticsSummary, error) {
-	// Get URL info
-	url, err := s.getURLByShortCode(ctx, shortCode)
+// FlushClickCounters moves the clicks counted in the cache to the click
+// counters of the ClickStore, once clickCountDelay has passed since the
+// minute they were stored in. The clicks are taken for a flush, which the
+// cache keeps until they are stored, so flushes cut short are applied again
+// first; the ClickStore adds each flush once. Clicks the counters were
+// rebuilt from since they were counted are dropped.
+func (s *AnalyticsService) FlushClickCounters(ctx context.Context) error {
+	var flushIDs []string
+	added, err := s.clicks.FlushClickCounters(ctx, clickCountDelay, func(before, countedUntil time.Time) (map[string]map[string]int64, error) {
+		unflushed, err := s.cache.UnflushedClicks(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read unflushed clicks: %w", err)
+		}
+		flushes := make(map[string]map[string]int64, len(unflushed)+1)
+		for flushID, flush := range unflushed {
+			flushIDs = append(flushIDs, flushID)
+			if flush.Before.After(countedUntil) {
+				flushes[flushID] = flush.Counts
+			}
+		}
+
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return nil, fmt.Errorf("failed to generate flush ID: %w", err)
+		}
+		flushID := hex.EncodeToString(id)
+		counts, err := s.cache.TakePendingClicks(ctx, flushID, before, countedUntil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to take pending clicks: %w", err)
+		}
+		if len(counts) > 0 {
+			flushIDs = append(flushIDs, flushID)
+			flushes[flushID] = counts
+		}
+		return flushes, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("URL not found: %w", err)
+		return fmt.Errorf("failed to flush click counters: %w", err)
 	}
+	metrics.ClicksFlushed.Add(float64(added))
 
-	// Get total clicks
-	var totalClicks int64
-	err = s.db.QueryRowContext(ctx, `
-		SELECT COUNT(*) FROM analytics WHERE short_code = $1
-	`, shortCode).Scan(&totalClicks)
+	for _, flushID := range flushIDs {
+		if err := s.cache.DropFlushedClicks(ctx, flushID); err != nil {
+			return fmt.Errorf("failed to drop flushed clicks: %w", err)
+		}
+	}
+	return nil
+}
+
+// StartClickCounterFlush runs FlushClickCounters every interval until ctx
+// is cancelled
+func (s *AnalyticsService) StartClickCounterFlush(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.FlushClickCounters(ctx); err != nil {
+					logger.WarnContext(ctx, "click counter flush failed", slog.Any("error", err))
+				}
+			}
+		}
+	}()
+}
+
+// RollUpClicks rolls up the clicks stored in every complete hour, up to
+// maxRollupHours per call, so analytics read rollups instead of scanning
+// click events. Hours are rolled up rollupDelay after they end.
+func (s *AnalyticsService) RollUpClicks(ctx context.Context) error {
+	for i := 0; i < maxRollupHours; i++ {
+		more, err := s.clicks.RollUpNextHour(ctx, rollupDelay)
+		if err != nil {
+			return fmt.Errorf("failed to roll up clicks: %w", err)
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
+
+// StartClickRollup runs RollUpClicks every interval until ctx is cancelled
+func (s *AnalyticsService) StartClickRollup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.RollUpClicks(ctx); err != nil {
+					logger.WarnContext(ctx, "click rollup failed", slog.Any("error", err))
+				}
+			}
+		}
+	}()
+}
+
+// ReconcileClickCounters rebuilds the click counter of every link from the
+// clicks stored up to clickCountDelay ago, and returns how many links have
+// clicks. The clicks pending in the cache that were stored before are then
+// dropped and the rest flushed, so no click is counted twice.
+func (s *AnalyticsService) ReconcileClickCounters(ctx context.Context) (int64, error) {
+	links, err := s.clicks.RebuildClickCounters(ctx, clickCountDelay)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get total clicks: %w", err)
+		return 0, err
 	}
+	return links, s.FlushClickCounters(ctx)
+}
 
-	// Get unique clicks (by IP)
-	var uniqueClicks int64
-	err = s.db.QueryRowContext(ctx, `
-		SELECT COUNT(DISTINCT ip_address) FROM analytics WHERE short_code = $1
-	`, shortCode).Scan(&uniqueClicks)
+// RebuildVisitors adds the visitors recorded with the clicks back to the
+// daily visitors of the cache, after the cache lost them, and returns how
+// many visitor days it added. Visitors already there are not counted
+// twice.
+func (s *AnalyticsService) RebuildVisitors(ctx context.Context) (int64, error) {
+	var days int64
+	err := s.clicks.DailyVisitors(ctx, func(urlID string, day time.Time, visitorIDs []string) error {
+		days++
+		return s.cache.AddVisitors(ctx, urlID, day, visitorIDs...)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get unique clicks: %w", err)
+		return 0, fmt.Errorf("failed to rebuild visitors: %w", err)
 	}
+	return days, nil
+}
 
-	// Get last clicked time
-	var lastClickedAt *time.Time
-	err = s.db.QueryRowContext(ctx, `
-		SELECT MAX(clicked_at) FROM analytics WHERE short_code = $1
-	`, shortCode).Scan(&lastClickedAt)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, fmt.Errorf("failed to get last clicked time: %w", err)
+// GetAnalytics gets analytics for a specific URL in the principal's
+// workspace, with its click series over r
+func (s *AnalyticsService) GetAnalytics(ctx context.Context, principal *models.Principal, shortCode string, r *models.ClickRange) (*models.AnalyticsSummary, error) {
+	ctx, span := tracing.Start(ctx, "AnalyticsService.GetAnalytics")
+	defer span.End()
+
+	// Make sure the URL exists and belongs to the caller's workspace
+	url, err := getWorkspaceURL(ctx, s.urls, principal, models.PermAnalyticsRead, shortCode)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get top countries
-	topCountries, err := s.getTopCountries(ctx, shortCode)
+	// Get total clicks
+	totalClicks, err := s.clicks.CountClicks(ctx, url.ID)
 	if err != nil {
-		log.Printf("Warning: failed to get top countries: %v", err)
+		return nil, fmt.Errorf("failed to get total clicks: %w", err)
 	}
 
-	// Get top cities
-	topCities, err := s.getTopCities(ctx, shortCode)
+	// Get unique visitors since the link was created
+	uniqueClicks, err := s.cache.CountVisitors(ctx, url.ID, url.CreatedAt, time.Now())
 	if err != nil {
-		log.Printf("Warning: failed to get top cities: %v", err)
+		logger.WarnContext(ctx, "failed to count visitors", slog.String("short_code", shortCode), slog.Any("error", err))
 	}
 
-	// Get top referers
-	topReferers, err := s.getTopReferers(ctx, shortCode)
+	// Get last clicked time
+	lastClickedAt, err := s.clicks.LastClickedAt(ctx, url.ID)
 	if err != nil {
-		log.Printf("Warning: failed to get top referers: %v", err)
+		return nil, fmt.Errorf("failed to get last clicked time: %w", err)
 	}
 
-	// Get click trend (last 7 days)
-	clickTrend, err := s.getClickTrend(ctx, shortCode, 7)
+	// Get the top values of each dimension
+	top := func(dimension string) []store.ValueCount {
+		values, err := s.clicks.TopValues(ctx, url.ID, dimension, 5)
+		if err != nil {
+			logger.WarnContext(ctx, "failed to get top values", slog.String("dimension", dimension), slog.Any("error", err))
+		}
+		return values
+	}
+	var (
+		topCountries []models.Country
+		topCities    []models.City
+		topReferers  []models.Referer
+		topDevices   []models.Device
+		topBrowsers  []models.Browser
+	)
+	for _, value := range top(store.DimensionCountry) {
+		topCountries = append(topCountries, models.Country{Name: value.Value, Count: value.Count})
+	}
+	for _, value := range top(store.DimensionCity) {
+		topCities = append(topCities, models.City{Name: value.Value, Count: value.Count})
+	}
+	for _, value := range top(store.DimensionReferer) {
+		topReferers = append(topReferers, models.Referer{Domain: value.Value, Count: value.Count})
+	}
+	for _, value := range top(store.DimensionDevice) {
+		topDevices = append(topDevices, models.Device{Name: value.Value, Count: value.Count})
+	}
+	for _, value := range top(store.DimensionBrowser) {
+		topBrowsers = append(topBrowsers, models.Browser{Name: value.Value, Count: value.Count})
+	}
+
+	// Get the click series over the requested range
+	series, err := s.clickSeries(ctx, url.ID, r, time.Now())
 	if err != nil {
-		log.Printf("Warning: failed to get click trend: %v", err)
+		return nil, err
 	}
 
 	return &models.AnalyticsSummary{
@@ -115,63 +333,115 @@ func (s *AnalyticsService) GetAnalytics(ctx context.Context, shortCode string) (
 		TopCountries:  topCountries,
 		TopCities:     topCities,
 		TopReferers:   topReferers,
-		ClickTrend:    clickTrend,
+		TopDevices:    topDevices,
+		TopBrowsers:   topBrowsers,
+		Series:        series,
 		LastClickedAt: lastClickedAt,
 	}, nil
 }
 
-// GetGlobalAnalytics gets global analytics
-func (s *AnalyticsService) GetGlobalAnalytics(ctx context.Context) (*models.GlobalAnalytics, error) {
+// ListClicks lists raw click events for a URL in the principal's workspace
+// newest first, using keyset pagination on (clicked_at, id). The total is only
+// counted on request.
+func (s *AnalyticsService) ListClicks(ctx context.Context, principal *models.Principal, shortCode, cursor string, limit int, withTotal bool) (*models.ClickListResponse, error) {
+	ctx, span := tracing.Start(ctx, "AnalyticsService.ListClicks")
+	defer span.End()
+
+	after, err := pagination.Decode(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := getWorkspaceURL(ctx, s.urls, principal, models.PermAnalyticsRead, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra row to find out whether another page exists
+	clicks, err := s.clicks.ListClicks(ctx, url.ID, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.ClickListResponse{Limit: limit}
+	if len(clicks) > limit {
+		clicks = clicks[:limit]
+		last := clicks[len(clicks)-1]
+		response.HasMore = true
+		response.NextCursor = pagination.Cursor{Time: last.ClickedAt, ID: last.ID}.Encode()
+	}
+	response.Clicks = clicks
+
+	if withTotal {
+		total, err := s.clicks.CountClicks(ctx, url.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get total count: %w", err)
+		}
+		response.Total = &total
+	}
+
+	return response, nil
+}
+
+// TrackClickFor tracks a click reported through the API, which is only
+// allowed for URLs in the principal's workspace
+func (s *AnalyticsService) TrackClickFor(ctx context.Context, principal *models.Principal, req *models.AnalyticsRequest) error {
+	url, err := getWorkspaceURL(ctx, s.urls, principal, models.PermLinksWrite, req.ShortCode)
+	if err != nil {
+		return err
+	}
+	req.Domain = url.Domain
+	return s.TrackClick(ctx, req)
+}
+
+// GetGlobalAnalytics gets analytics across all URLs of the principal's
+// workspace. Days, weeks (starting on Monday) and months are in UTC.
+func (s *AnalyticsService) GetGlobalAnalytics(ctx context.Context, principal *models.Principal) (*models.GlobalAnalytics, error) {
+	ctx, span := tracing.Start(ctx, "AnalyticsService.GetGlobalAnalytics")
+	defer span.End()
+
+	if !principal.Can(models.PermAnalyticsRead) {
+		return nil, ErrForbidden
+	}
+	workspaceID := principal.WorkspaceID
+
+	now := time.Now().UTC()
+	today := startOfDay(now)
+	thisWeek := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	thisMonth := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+
 	// Get total URLs
-	var totalURLs int64
-	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM urls WHERE is_active = true").Scan(&totalURLs)
+	totalURLs, err := s.urls.CountURLs(ctx, workspaceID, time.Time{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total URLs: %w", err)
 	}
 
 	// Get total clicks
-	var totalClicks int64
-	err = s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM analytics").Scan(&totalClicks)
+	totalClicks, err := s.clicks.CountWorkspaceClicks(ctx, workspaceID, time.Time{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total clicks: %w", err)
 	}
 
 	// Get active URLs (created in last 30 days)
-	var activeURLs int64
-	err = s.db.QueryRowContext(ctx, `
-		SELECT COUNT(*) FROM urls 
-		WHERE is_active = true AND created_at >= NOW() - INTERVAL '30 days'
-	`).Scan(&activeURLs)
+	activeURLs, err := s.urls.CountURLs(ctx, workspaceID, now.AddDate(0, 0, -30))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get active URLs: %w", err)
 	}
 
 	// Get today's clicks
-	var todayClicks int64
-	err = s.db.QueryRowContext(ctx, `
-		SELECT COUNT(*) FROM analytics 
-		WHERE DATE(clicked_at) = CURRENT_DATE
-	`).Scan(&todayClicks)
+	todayClicks, err := s.clicks.CountWorkspaceClicks(ctx, workspaceID, today)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get today's clicks: %w", err)
 	}
 
 	// Get this week's clicks
-	var thisWeekClicks int64
-	err = s.db.QueryRowContext(ctx, `
-		SELECT COUNT(*) FROM analytics 
-		WHERE clicked_at >= DATE_TRUNC('week', CURRENT_DATE)
-	`).Scan(&thisWeekClicks)
+	thisWeekClicks, err := s.clicks.CountWorkspaceClicks(ctx, workspaceID, thisWeek)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get this week's clicks: %w", err)
 	}
 
 	// Get this month's clicks
-	var thisMonthClicks int64
-	err = s.db.QueryRowContext(ctx, `
-		SELECT COUNT(*) FROM analytics 
-		WHERE clicked_at >= DATE_TRUNC('month', CURRENT_DATE)
-	`).Scan(&thisMonthClicks)
+	thisMonthClicks, err := s.clicks.CountWorkspaceClicks(ctx, workspaceID, thisMonth)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get this month's clicks: %w", err)
 	}
@@ -186,141 +456,7 @@ func (s *AnalyticsService) GetGlobalAnalytics(ctx context.Context) (*models.Glob
 	}, nil
 }
 
-// Helper methods
-
-func (s *AnalyticsService) getURLIDByShortCode(ctx context.Context, shortCode string) (string, error) {
-	var urlID string
-	err := s.db.QueryRowContext(ctx, `
-		SELECT id FROM urls WHERE short_code = $1 AND is_active = true
-	`, shortCode).Scan(&urlID)
-	if err == sql.ErrNoRows {
-		return "", fmt.Errorf("URL not found")
-	}
-	return urlID, err
-}
-
-func (s *AnalyticsService) getURLByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
-	var url models.URL
-	err := s.db.QueryRowContext(ctx, `
-		SELECT id, short_code, original_url, title, description, created_at, updated_at, created_by, is_active, expires_at
-		FROM urls WHERE short_code = $1 AND is_active = true
-	`, shortCode).Scan(
-		&url.ID,
-		&url.ShortCode,
-		&url.OriginalURL,
-		&url.Title,
-		&url.Description,
-		&url.CreatedAt,
-		&url.UpdatedAt,
-		&url.CreatedBy,
-		&url.IsActive,
-		&url.ExpiresAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("URL not found")
-	}
-	return &url, err
-}
-
-func (s *AnalyticsService) getTopCountries(ctx context.Context, shortCode string) ([]models.Country, error) {
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT country, COUNT(*) as count 
-		FROM analytics 
-		WHERE short_code = $1 AND country IS NOT NULL AND country != ''
-		GROUP BY country 
-		ORDER BY count DESC 
-		LIMIT 5
-	`, shortCode)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var countries []models.Country
-	for rows.Next() {
-		var country models.Country
-		err := rows.Scan(&country.Name, &country.Count)
-		if err != nil {
-			return nil, err
-		}
-		countries = append(countries, country)
-	}
-	return countries, nil
-}
-
-func (s *AnalyticsService) getTopCities(ctx context.Context, shortCode string) ([]models.City, error) {
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT city, COUNT(*) as count 
-		FROM analytics 
-		WHERE short_code = $1 AND city IS NOT NULL AND city != ''
-		GROUP BY city 
-		ORDER BY count DESC 
-		LIMIT 5
-	`, shortCode)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var cities []models.City
-	for rows.Next() {
-		var city models.City
-		err := rows.Scan(&city.Name, &city.Count)
-		if err != nil {
-			return nil, err
-		}
-		cities = append(cities, city)
-	}
-	return cities, nil
-}
-
-func (s *AnalyticsService) getTopReferers(ctx context.Context, shortCode string) ([]models.Referer, error) {
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT referer, COUNT(*) as count 
-		FROM analytics 
-		WHERE short_code = $1 AND referer IS NOT NULL AND referer != ''
-		GROUP BY referer 
-		ORDER BY count DESC 
-		LIMIT 5
-	`, shortCode)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var referers []models.Referer
-	for rows.Next() {
-		var referer models.Referer
-		err := rows.Scan(&referer.URL, &referer.Count)
-		if err != nil {
-			return nil, err
-		}
-		referers = append(referers, referer)
-	}
-	return referers, nil
-}
-
-func (s *AnalyticsService) getClickTrend(ctx context.Context, shortCode string, days int) ([]models.ClickTrend, error) {
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT DATE(clicked_at) as date, COUNT(*) as count 
-		FROM analytics 
-		WHERE short_code = $1 AND clicked_at >= CURRENT_DATE - INTERVAL '$2 days'
-		GROUP BY DATE(clicked_at) 
-		ORDER BY date
-	`, shortCode, days)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var trends []models.ClickTrend
-	for rows.Next() {
-		var trend models.ClickTrend
-		err := rows.Scan(&trend.Date, &trend.Count)
-		if err != nil {
-			return nil, err
-		}
-		trends = append(trends, trend)
-	}
-	return trends, nil
+// startOfDay returns midnight UTC of the day of t
+func startOfDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
 }
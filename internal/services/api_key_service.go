@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"linksprint/internal/audit"
+	"linksprint/internal/database"
+	"linksprint/internal/models"
+	"linksprint/internal/store"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// APIKeyPrefix starts every API key so it can be told apart from a JWT
+	APIKeyPrefix = "lsk_"
+
+	// lastUsedInterval throttles last-used bookkeeping writes per key
+	lastUsedInterval = time.Minute
+)
+
+// APIKeyService handles creation, verification and revocation of API keys
+type APIKeyService struct {
+	db *database.DB
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(db *database.DB) *APIKeyService {
+	return &APIKeyService{
+		db: db,
+	}
+}
+
+// CreateAPIKey creates a key in the principal's workspace. Keys cannot be
+// granted scopes beyond the creator's role. The returned secret is not
+// stored and cannot be retrieved again.
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, principal *models.Principal, req *models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	if !principal.Can(models.PermAPIKeysManage) {
+		return nil, ErrForbidden
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("%w: name must be between 1 and 100 characters", ErrInvalidAPIKey)
+	}
+	scopes, err := validateScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range scopes {
+		if !principal.Role.Can(models.Permission(scope)) {
+			return nil, ErrForbidden
+		}
+	}
+	allowedIPs, err := validateAllowedIPs(req.AllowedIPs)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := models.Plans[req.Plan]; req.Plan != "" && !ok {
+		return nil, fmt.Errorf("%w: unknown plan %q", ErrInvalidAPIKey, req.Plan)
+	}
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAPIKey)
+		}
+		utc := req.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	// The prefix is hex so it never contains the "_" separator
+	prefixBytes := make([]byte, 4)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate key prefix: %w", err)
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key secret: %w", err)
+	}
+	prefix := hex.EncodeToString(prefixBytes)
+	key := APIKeyPrefix + prefix + "_" + secret
+
+	apiKey := &models.APIKey{
+		UserID:      principal.UserID,
+		WorkspaceID: principal.WorkspaceID,
+		Name:        name,
+		Prefix:      APIKeyPrefix + prefix,
+		Scopes:      scopes,
+		AllowedIPs:  allowedIPs,
+		Plan:        req.Plan,
+		ExpiresAt:   expiresAt,
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO api_keys (user_id, workspace_id, name, prefix, key_hash, scopes, allowed_ips, plan, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at
+	`, apiKey.UserID, apiKey.WorkspaceID, apiKey.Name, apiKey.Prefix, hashToken(key), strings.Join(scopes, ","),
+		strings.Join(allowedIPs, ","), nullString(apiKey.Plan), apiKey.ExpiresAt).Scan(&apiKey.ID, &apiKey.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	err = audit.Record(ctx, tx, principal, audit.Event{
+		Action:     models.AuditAPIKeyCreate,
+		TargetType: "api_key",
+		TargetID:   apiKey.ID,
+		After:      apiKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit API key: %w", err)
+	}
+
+	return &models.CreateAPIKeyResponse{APIKey: apiKey, Key: key}, nil
+}
+
+// ListAPIKeys lists the keys of the principal's workspace, including
+// revoked ones
+func (s *APIKeyService) ListAPIKeys(ctx context.Context, principal *models.Principal) ([]models.APIKey, error) {
+	if !principal.Can(models.PermAPIKeysManage) {
+		return nil, ErrForbidden
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys WHERE workspace_id = $1
+		ORDER BY created_at DESC
+	`, principal.WorkspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		if err := scanAPIKey(rows, &key); err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes a key of the principal's workspace
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, principal *models.Principal, keyID string) error {
+	if !principal.Can(models.PermAPIKeysManage) {
+		return ErrForbidden
+	}
+	if _, err := uuid.Parse(keyID); err != nil {
+		return ErrAPIKeyNotFound
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var before models.APIKey
+	err = scanAPIKey(tx.QueryRowContext(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys WHERE id = $1 AND workspace_id = $2 AND revoked_at IS NULL
+		`+s.db.Dialect.ForUpdate()+`
+	`, keyID, principal.WorkspaceID), &before)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load API key: %w", err)
+	}
+
+	after := before
+	revokedAt := time.Now().UTC()
+	after.RevokedAt = &revokedAt
+	if _, err := tx.ExecContext(ctx, `UPDATE api_keys SET revoked_at = $1 WHERE id = $2`, revokedAt, keyID); err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	err = audit.Record(ctx, tx, principal, audit.Event{
+		Action:     models.AuditAPIKeyRevoke,
+		TargetType: "api_key",
+		TargetID:   keyID,
+		Before:     before,
+		After:      after,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// VerifyAPIKey checks a presented key and the client IP against the stored
+// key and returns the principal it acts as
+func (s *APIKeyService) VerifyAPIKey(ctx context.Context, key, clientIP string) (*models.Principal, error) {
+	prefix, ok := apiKeyLookupPrefix(key)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	var apiKey models.APIKey
+	err := scanAPIKey(s.db.QueryRowContext(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys WHERE prefix = $1
+	`, prefix), &apiKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API key: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(hashToken(key))) != 1 {
+		return nil, ErrInvalidToken
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, ErrInvalidToken
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	if !ipAllowed(apiKey.AllowedIPs, clientIP) {
+		return nil, ErrIPNotAllowed
+	}
+
+	s.touchLastUsed(&apiKey, clientIP)
+
+	return &models.Principal{
+		UserID:      apiKey.UserID,
+		APIKeyID:    apiKey.ID,
+		Scopes:      apiKey.Scopes,
+		APIKeyPlan:  apiKey.Plan,
+		WorkspaceID: apiKey.WorkspaceID,
+	}, nil
+}
+
+// Helper methods
+
+// apiKeyColumns lists the api_keys columns read by scanAPIKey, in scan order
+const apiKeyColumns = `id, user_id, COALESCE(CAST(workspace_id AS TEXT), ''), name, prefix, key_hash, scopes, COALESCE(allowed_ips, ''),
+	COALESCE(plan, ''), expires_at, last_used_at, COALESCE(last_used_ip, ''), revoked_at, created_at`
+
+func scanAPIKey(row store.RowScanner, key *models.APIKey) error {
+	var scopes, allowedIPs string
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.WorkspaceID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&scopes,
+		&allowedIPs,
+		&key.Plan,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.LastUsedIP,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	key.Scopes = splitList(scopes)
+	key.AllowedIPs = splitList(allowedIPs)
+	return nil
+}
+
+// touchLastUsed records when and from where a key was used, at most once per
+// lastUsedInterval, without holding up the request
+func (s *APIKeyService) touchLastUsed(key *models.APIKey, clientIP string) {
+	now := time.Now().UTC()
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < lastUsedInterval && key.LastUsedIP == clientIP {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err := s.db.ExecContext(ctx, `
+			UPDATE api_keys SET last_used_at = $1, last_used_ip = $2 WHERE id = $3
+		`, now, clientIP, key.ID)
+		if err != nil {
+			logger.Warn("failed to record API key usage", slog.String("api_key_id", key.ID), slog.Any("error", err))
+		}
+	}()
+}
+
+// apiKeyLookupPrefix splits "lsk_<prefix>_<secret>" and returns "lsk_<prefix>"
+func apiKeyLookupPrefix(key string) (string, bool) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return "", false
+	}
+	rest := key[len(APIKeyPrefix):]
+	i := strings.IndexByte(rest, '_')
+	if i <= 0 || i == len(rest)-1 {
+		return "", false
+	}
+	return APIKeyPrefix + rest[:i], true
+}
+
+func validateScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKey)
+	}
+
+	seen := make(map[string]bool)
+	var valid []string
+	for _, scope := range scopes {
+		known := false
+		for _, s := range models.AllScopes {
+			if scope == s {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKey, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			valid = append(valid, scope)
+		}
+	}
+	return valid, nil
+}
+
+// validateAllowedIPs accepts single addresses and CIDR ranges
+func validateAllowedIPs(entries []string) ([]string, error) {
+	var valid []string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return nil, fmt.Errorf("%w: %q is not an IP address or CIDR range", ErrInvalidAPIKey, entry)
+		}
+		valid = append(valid, entry)
+	}
+	return valid, nil
+}
+
+// ipAllowed reports whether ip matches the allowlist; an empty list allows all
+func ipAllowed(allowlist []string, ip string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, entry := range allowlist {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(parsed) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
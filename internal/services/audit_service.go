@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"linksprint/internal/database"
+	"linksprint/internal/models"
+	"linksprint/internal/pagination"
+	"linksprint/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// AuditService reads the audit log of a workspace. Events are written by
+// the services that make the changes, through the audit package.
+type AuditService struct {
+	db *database.DB
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(db *database.DB) *AuditService {
+	return &AuditService{
+		db: db,
+	}
+}
+
+// ListEvents lists the audit events of the principal's workspace newest
+// first, using keyset pagination on (created_at, id)
+func (s *AuditService) ListEvents(ctx context.Context, principal *models.Principal, filter *models.AuditFilter, cursor string, limit int) (*models.AuditListResponse, error) {
+	where, args, err := auditConditions(principal, filter)
+	if err != nil {
+		return nil, err
+	}
+	after, err := pagination.Decode(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		args = append(args, after.Time, after.ID)
+		where += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+	args = append(args, limit+1)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+auditEventColumns+`
+		FROM audit_events
+		WHERE `+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT `+fmt.Sprintf("$%d", len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := scanAuditEvent(rows, &event); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit events: %w", err)
+	}
+
+	response := &models.AuditListResponse{Limit: limit}
+	if len(events) > limit {
+		events = events[:limit]
+		last := events[len(events)-1]
+		response.HasMore = true
+		response.NextCursor = pagination.Cursor{Time: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	response.Events = events
+	return response, nil
+}
+
+// ExportEvents checks that the principal may read the audit log and returns
+// a function writing every matching event as NDJSON, oldest first. The
+// check happens up front so the export can be streamed after the response
+// status has been sent.
+func (s *AuditService) ExportEvents(principal *models.Principal, filter *models.AuditFilter) (func(ctx context.Context, w io.Writer) error, error) {
+	where, args, err := auditConditions(principal, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, w io.Writer) error {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT `+auditEventColumns+`
+			FROM audit_events
+			WHERE `+where+`
+			ORDER BY created_at, id
+		`, args...)
+		if err != nil {
+			return fmt.Errorf("failed to query audit events: %w", err)
+		}
+		defer rows.Close()
+
+		encoder := json.NewEncoder(w)
+		for rows.Next() {
+			var event models.AuditEvent
+			if err := scanAuditEvent(rows, &event); err != nil {
+				return fmt.Errorf("failed to scan audit event: %w", err)
+			}
+			if err := encoder.Encode(&event); err != nil {
+				return fmt.Errorf("failed to write audit event: %w", err)
+			}
+		}
+		return rows.Err()
+	}, nil
+}
+
+// Helper methods
+
+// auditEventColumns lists the audit_events columns read by
+// scanAuditEvent, in scan order
+const auditEventColumns = `id, COALESCE(CAST(workspace_id AS TEXT), ''), COALESCE(CAST(actor_user_id AS TEXT), ''),
+	COALESCE(CAST(actor_api_key_id AS TEXT), ''), action, target_type, target_id,
+	CAST(before_state AS TEXT), CAST(after_state AS TEXT), COALESCE(ip_address, ''), COALESCE(request_id, ''), created_at`
+
+func scanAuditEvent(row store.RowScanner, event *models.AuditEvent) error {
+	var before, after sql.NullString
+	err := row.Scan(
+		&event.ID,
+		&event.WorkspaceID,
+		&event.ActorUserID,
+		&event.ActorAPIKeyID,
+		&event.Action,
+		&event.TargetType,
+		&event.TargetID,
+		&before,
+		&after,
+		&event.IPAddress,
+		&event.RequestID,
+		&event.CreatedAt,
+	)
+	if before.Valid {
+		event.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		event.After = json.RawMessage(after.String)
+	}
+	return err
+}
+
+// auditConditions checks that the principal may read the audit log and
+// builds the WHERE clause selecting its workspace's events that match the
+// filter
+func auditConditions(principal *models.Principal, filter *models.AuditFilter) (string, []interface{}, error) {
+	if !principal.Can(models.PermAuditRead) {
+		return "", nil, ErrForbidden
+	}
+
+	conditions := []string{"workspace_id = $1"}
+	args := []interface{}{principal.WorkspaceID}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.ActorID != "" {
+		if _, err := uuid.Parse(filter.ActorID); err != nil {
+			return "", nil, fmt.Errorf("%w: actor must be a user ID", ErrInvalidAuditFilter)
+		}
+		add("actor_user_id = $%d", filter.ActorID)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.TargetType != "" {
+		add("target_type = $%d", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		add("target_id = $%d", filter.TargetID)
+	}
+	if filter.From != nil {
+		add("created_at >= $%d", filter.From.UTC())
+	}
+	if filter.To != nil {
+		add("created_at < $%d", filter.To.UTC())
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
@@ -0,0 +1,384 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"strings"
+	"time"
+
+	"linksprint/internal/audit"
+	"linksprint/internal/config"
+	"linksprint/internal/database"
+	"linksprint/internal/models"
+	"linksprint/internal/redis"
+	"linksprint/internal/store"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	tokenIssuer       = "linksprint"
+	minPasswordLength = 8
+)
+
+// accessClaims are the claims carried by an access token
+type accessClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// AuthService handles user registration, login and token management
+type AuthService struct {
+	db         *database.DB
+	redis      *redis.Client
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	openSignup bool
+	// failOpen accepts access tokens whose revocation cannot be checked
+	failOpen bool
+}
+
+// NewAuthService creates a new auth service
+func NewAuthService(db *database.DB, redis *redis.Client, cfg *config.Config) *AuthService {
+	return &AuthService{
+		db:         db,
+		redis:      redis,
+		secret:     []byte(cfg.Auth.JWTSecret),
+		accessTTL:  cfg.Auth.AccessTokenTTL,
+		refreshTTL: cfg.Auth.RefreshTokenTTL,
+		openSignup: cfg.Features.Registration,
+		failOpen:   cfg.Auth.RevocationFailOpen,
+	}
+}
+
+// Register creates a new user and signs them in
+func (s *AuthService) Register(ctx context.Context, req *models.RegisterRequest) (*models.AuthResponse, error) {
+	if !s.openSignup {
+		return nil, ErrRegistrationClosed
+	}
+
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRegistration, err)
+	}
+	if len(req.Password) < minPasswordLength {
+		return nil, fmt.Errorf("%w: password must be at least %d characters", ErrInvalidRegistration, minPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	user := models.User{Email: email, Name: req.Name, IsActive: true}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (email, password_hash, name)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at
+	`, email, string(hash), req.Name).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	if database.IsUniqueViolation(err) {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	err = audit.Record(ctx, tx, &models.Principal{UserID: user.ID, Email: user.Email}, audit.Event{
+		Action:     models.AuditUserRegister,
+		TargetType: "user",
+		TargetID:   user.ID,
+		After:      &user,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit user: %w", err)
+	}
+
+	return s.issueTokens(ctx, &user)
+}
+
+// Login verifies credentials and issues a new token pair
+func (s *AuthService) Login(ctx context.Context, req *models.LoginRequest) (*models.AuthResponse, error) {
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	user, err := s.getUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Compare against a dummy hash so unknown emails take as long as bad passwords
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if !user.IsActive {
+		return nil, ErrInvalidCredentials
+	}
+
+	return s.issueTokens(ctx, user)
+}
+
+// Refresh rotates a refresh token: the presented token is revoked and a new
+// pair is issued. Presenting an already revoked token revokes every session
+// of its user, since it means the token has leaked.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*models.AuthResponse, error) {
+	tokenHash := hashToken(refreshToken)
+
+	var (
+		tokenID   string
+		userID    string
+		expiresAt time.Time
+		revokedAt *time.Time
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, user_id, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = $1
+	`, tokenHash).Scan(&tokenID, &userID, &expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load refresh token: %w", err)
+	}
+
+	if revokedAt != nil {
+		logger.WarnContext(ctx, "revoked refresh token reused, revoking all sessions", slog.String("user_id", userID))
+		if err := s.revokeAllRefreshTokens(ctx, userID); err != nil {
+			logger.ErrorContext(ctx, "failed to revoke refresh tokens", slog.Any("error", err))
+		}
+		return nil, ErrInvalidToken
+	}
+	if time.Now().UTC().After(expiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL
+	`, time.Now().UTC(), tokenID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Lost a race with a concurrent refresh of the same token
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.getUserByID(ctx, userID)
+	if err != nil || !user.IsActive {
+		return nil, ErrInvalidToken
+	}
+
+	return s.issueTokens(ctx, user)
+}
+
+// Logout revokes the caller's access token and the given refresh token, or
+// every refresh token of the user when none is given
+func (s *AuthService) Logout(ctx context.Context, principal *models.Principal, refreshToken string) error {
+	if principal.TokenID != "" {
+		// Deny the access token until it would have expired anyway
+		key := fmt.Sprintf("revoked_token:%s", principal.TokenID)
+		if err := s.redis.SetWithTTL(ctx, key, "1", s.accessTTL); err != nil {
+			logger.ErrorContext(ctx, "failed to revoke access token", slog.Any("error", err))
+		}
+	}
+
+	if refreshToken == "" {
+		return s.revokeAllRefreshTokens(ctx, principal.UserID)
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = $1
+		WHERE token_hash = $2 AND user_id = $3 AND revoked_at IS NULL
+	`, time.Now().UTC(), hashToken(refreshToken), principal.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return nil
+}
+
+// VerifyAccessToken validates an access token and returns its principal.
+// Tokens of deactivated users are refused at once, not only when they
+// expire. Tokens whose revocation cannot be checked return
+// ErrAuthUnavailable, unless the service fails open, as do tokens whose
+// user cannot be loaded.
+func (s *AuthService) VerifyAccessToken(ctx context.Context, token string) (*models.Principal, error) {
+	claims := &accessClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}), jwt.WithIssuer(tokenIssuer), jwt.WithExpirationRequired())
+	if err != nil || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.ID != "" {
+		revoked, err := s.redis.Exists(ctx, fmt.Sprintf("revoked_token:%s", claims.ID))
+		if err != nil {
+			if !s.failOpen {
+				return nil, fmt.Errorf("%w: failed to check access token revocation: %v", ErrAuthUnavailable, err)
+			}
+			logger.WarnContext(ctx, "failed to check access token revocation, accepting token", slog.Any("error", err))
+		}
+		if revoked {
+			return nil, ErrInvalidToken
+		}
+	}
+
+	var active bool
+	err = s.db.QueryRowContext(ctx, `SELECT is_active FROM users WHERE id = $1`, claims.Subject).Scan(&active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to check user: %v", ErrAuthUnavailable, err)
+	}
+	if !active {
+		return nil, ErrInvalidToken
+	}
+
+	return &models.Principal{
+		UserID:  claims.Subject,
+		Email:   claims.Email,
+		TokenID: claims.ID,
+	}, nil
+}
+
+// Helper methods
+
+// dummyPasswordHash is compared against when a login email is unknown
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("linksprint-dummy-password"), bcrypt.DefaultCost)
+
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User) (*models.AuthResponse, error) {
+	now := time.Now().UTC()
+
+	tokenID, err := randomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token ID: %w", err)
+	}
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims{
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   user.ID,
+			ID:        tokenID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
+		},
+	}).SignedString(s.secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, user.ID, hashToken(refreshToken), now.Add(s.refreshTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &models.AuthResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.accessTTL.Seconds()),
+		User:         user,
+	}, nil
+}
+
+func (s *AuthService) revokeAllRefreshTokens(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL
+	`, time.Now().UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// userColumns lists the users columns read by scanUser, in scan order
+const userColumns = `id, email, password_hash, COALESCE(name, ''), created_at, updated_at, is_active`
+
+func scanUser(row store.RowScanner, user *models.User) error {
+	return row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Name,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.IsActive,
+	)
+}
+
+func (s *AuthService) getUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	err := scanUser(s.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+` FROM users WHERE email = $1
+	`, email), &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *AuthService) getUserByID(ctx context.Context, userID string) (*models.User, error) {
+	var user models.User
+	err := scanUser(s.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+` FROM users WHERE id = $1
+	`, userID), &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil {
+		return "", fmt.Errorf("invalid email address")
+	}
+	return strings.ToLower(address.Address), nil
+}
+
+// randomToken returns n random bytes encoded for use in URLs and headers
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 of a token; tokens are high entropy so a
+// fast hash is enough and allows lookups by hash
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"linksprint/internal/models"
+)
+
+// clickTimeout bounds how long a worker spends recording one click
+const clickTimeout = 5 * time.Second
+
+// ClickPipeline records redirect clicks in the background so redirects never
+// wait on the database. Clicks are queued in a bounded buffer and dropped
+// when it is full.
+type ClickPipeline struct {
+	analytics *AnalyticsService
+	clicks    chan models.AnalyticsRequest
+	wg        sync.WaitGroup
+
+	mu      sync.RWMutex
+	closed  bool
+	dropped atomic.Int64
+}
+
+// NewClickPipeline creates a click pipeline and starts its workers
+func NewClickPipeline(analytics *AnalyticsService, workers, buffer int) *ClickPipeline {
+	if workers < 1 {
+		workers = 1
+	}
+	if buffer < 0 {
+		buffer = 0
+	}
+
+	p := &ClickPipeline{
+		analytics: analytics,
+		clicks:    make(chan models.AnalyticsRequest, buffer),
+	}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Track queues a click without blocking and reports whether it was accepted
+func (p *ClickPipeline) Track(click models.AnalyticsRequest) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+
+	select {
+	case p.clicks <- click:
+		return true
+	default:
+		if p.dropped.Add(1)%1000 == 1 {
+			logger.Warn("click buffer full, dropping clicks", slog.Int64("dropped", p.dropped.Load()))
+		}
+		return false
+	}
+}
+
+// Depth returns how many clicks are waiting to be recorded
+func (p *ClickPipeline) Depth() int {
+	return len(p.clicks)
+}
+
+// Dropped returns how many clicks were dropped because the buffer was full
+func (p *ClickPipeline) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+// Close stops accepting clicks and waits for the queued ones to be recorded
+func (p *ClickPipeline) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.clicks)
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// Shutdown is Close bounded by ctx. It returns ctx's error, with the number
+// of clicks still queued, if they could not all be recorded in time.
+func (p *ClickPipeline) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d clicks not recorded: %w", len(p.clicks), ctx.Err())
+	}
+}
+
+func (p *ClickPipeline) work() {
+	defer p.wg.Done()
+	for click := range p.clicks {
+		ctx, cancel := context.WithTimeout(context.Background(), clickTimeout)
+		err := p.analytics.RecordClick(ctx, &click)
+		cancel()
+
+		// Clicks beyond the plan's tracked click quota are not recorded
+		if err != nil && !errors.Is(err, ErrQuotaExceeded) {
+			logger.WarnContext(ctx, "failed to record click", slog.String("short_code", click.ShortCode), slog.Any("error", err))
+		}
+	}
+}
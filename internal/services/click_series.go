@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"linksprint/internal/models"
+	"linksprint/internal/store"
+	"linksprint/internal/tracing"
+)
+
+// maxSeriesPoints bounds the intervals of a click series
+const maxSeriesPoints = 1000
+
+// defaultSeriesSpans are how far back a click series reaches per interval
+// when the range has no start
+var defaultSeriesSpans = map[string]time.Duration{
+	models.IntervalMinute: time.Hour,
+	models.IntervalHour:   24 * time.Hour,
+	models.IntervalDay:    7 * 24 * time.Hour,
+	models.IntervalWeek:   12 * 7 * 24 * time.Hour,
+	models.IntervalMonth:  365 * 24 * time.Hour,
+}
+
+// ClickSeries returns the clicks of a link in the principal's workspace per
+// interval of a range, compared with the period just before it
+func (s *AnalyticsService) ClickSeries(ctx context.Context, principal *models.Principal, shortCode string, r *models.ClickRange) (*models.ClickSeries, error) {
+	ctx, span := tracing.Start(ctx, "AnalyticsService.ClickSeries")
+	defer span.End()
+
+	url, err := getWorkspaceURL(ctx, s.urls, principal, models.PermAnalyticsRead, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	return s.clickSeries(ctx, url.ID, r, time.Now())
+}
+
+// clickSeries returns the click series of link urlID. The range is widened
+// to whole intervals: it starts at the interval from falls in and ends with
+// the interval to falls in, which may still be under way. The previous
+// period has the same length, and its points are the intervals of the
+// series moved back by that length. Unique visitors are counted over the
+// UTC days each period touches.
+func (s *AnalyticsService) clickSeries(ctx context.Context, urlID string, r *models.ClickRange, now time.Time) (*models.ClickSeries, error) {
+	if r == nil {
+		r = &models.ClickRange{}
+	}
+	interval := r.Interval
+	if interval == "" {
+		interval = models.IntervalDay
+	}
+	span, ok := defaultSeriesSpans[interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: interval must be minute, hour, day, week or month", ErrInvalidClickRange)
+	}
+	timezone := r.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalidClickRange, timezone)
+	}
+	to := now
+	if r.To != nil {
+		to = *r.To
+	}
+	from := to.Add(-span)
+	if r.From != nil {
+		from = *r.From
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidClickRange)
+	}
+
+	// The start of every interval, and the end of the last
+	buckets := intervalBuckets{interval: interval, loc: loc}
+	starts := []time.Time{buckets.truncate(from)}
+	for end := buckets.next(starts[0]); end.Before(to); end = buckets.next(end) {
+		if len(starts) == maxSeriesPoints {
+			return nil, fmt.Errorf("%w: at most %d intervals", ErrInvalidClickRange, maxSeriesPoints)
+		}
+		starts = append(starts, end)
+	}
+	start, end := starts[0], buckets.next(starts[len(starts)-1])
+	length := end.Sub(start)
+	previousStarts := make([]time.Time, len(starts))
+	for i, t := range starts {
+		previousStarts[i] = t.Add(-length)
+	}
+
+	// Read hours, from the rollups, unless intervals do not start on the
+	// hour, as with minutes or time zones offset by half an hour
+	step := time.Hour
+	for _, t := range append(append([]time.Time{end}, starts...), previousStarts...) {
+		if interval == models.IntervalMinute || !t.Truncate(time.Hour).Equal(t) {
+			step = time.Minute
+			break
+		}
+	}
+	counts, err := s.clicks.ClickCounts(ctx, urlID, start.Add(-length), end, step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count clicks: %w", err)
+	}
+
+	series := &models.ClickSeries{
+		Interval: interval,
+		Timezone: loc.String(),
+		From:     start,
+		To:       end,
+		Points:   seriesPoints(starts),
+		Previous: models.ClickPeriod{
+			From:   start.Add(-length),
+			To:     start,
+			Points: seriesPoints(previousStarts),
+		},
+	}
+	for _, count := range counts {
+		if count.Time.Before(start) {
+			series.Previous.Total += addToPoint(series.Previous.Points, previousStarts, count)
+		} else {
+			series.Total += addToPoint(series.Points, starts, count)
+		}
+	}
+	series.Unique = s.countVisitors(ctx, urlID, start, end)
+	series.Previous.Unique = s.countVisitors(ctx, urlID, start.Add(-length), start)
+	if series.Previous.Total > 0 {
+		change := float64(series.Total-series.Previous.Total) / float64(series.Previous.Total) * 100
+		series.Change = &change
+	}
+	return series, nil
+}
+
+// countVisitors counts the distinct visitors of a link over the UTC days
+// [from, to) touches, or 0 if the cache cannot
+func (s *AnalyticsService) countVisitors(ctx context.Context, urlID string, from, to time.Time) int64 {
+	visitors, err := s.cache.CountVisitors(ctx, urlID, from, to.Add(-time.Nanosecond))
+	if err != nil {
+		logger.WarnContext(ctx, "failed to count visitors", slog.Any("error", err))
+	}
+	return visitors
+}
+
+// seriesPoints returns zero points starting at starts
+func seriesPoints(starts []time.Time) []models.ClickPoint {
+	points := make([]models.ClickPoint, len(starts))
+	for i, t := range starts {
+		points[i].Time = t
+	}
+	return points
+}
+
+// addToPoint adds count to the point of the interval it falls in and
+// returns the clicks added
+func addToPoint(points []models.ClickPoint, starts []time.Time, count store.TimeCount) int64 {
+	i := sort.Search(len(starts), func(i int) bool { return starts[i].After(count.Time) }) - 1
+	if i < 0 {
+		return 0
+	}
+	points[i].Count += count.Count
+	return count.Count
+}
+
+// intervalBuckets computes the starts of the intervals of a series in its
+// time zone; weeks start on Monday
+type intervalBuckets struct {
+	interval string
+	loc      *time.Location
+}
+
+// truncate returns the start of the interval t falls in
+func (b intervalBuckets) truncate(t time.Time) time.Time {
+	t = t.In(b.loc)
+	switch b.interval {
+	case models.IntervalMinute:
+		return t.Truncate(time.Minute)
+	case models.IntervalHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, b.loc)
+	case models.IntervalWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, b.loc)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case models.IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, b.loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, b.loc)
+	}
+}
+
+// next returns the start of the interval after the one starting at t
+func (b intervalBuckets) next(t time.Time) time.Time {
+	switch b.interval {
+	case models.IntervalMinute:
+		return t.Add(time.Minute)
+	case models.IntervalHour:
+		return t.Add(time.Hour)
+	case models.IntervalWeek:
+		return t.AddDate(0, 0, 7)
+	case models.IntervalMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
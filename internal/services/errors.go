@@ -0,0 +1,32 @@
+package services
+
+import "errors"
+
+// Errors returned by the services that handlers map to HTTP status codes
+var (
+	ErrURLNotFound         = errors.New("URL not found")
+	ErrInvalidURL          = errors.New("invalid URL")
+	ErrShortCodeTaken      = errors.New("short code already exists")
+	ErrInvalidShortCode    = errors.New("invalid custom code")
+	ErrInvalidRedirectType = errors.New("invalid redirect type")
+	ErrEmailTaken          = errors.New("email is already registered")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrInvalidToken        = errors.New("invalid or expired token")
+	ErrAuthUnavailable     = errors.New("authentication is unavailable")
+	ErrInvalidRegistration = errors.New("invalid registration")
+	ErrRegistrationClosed  = errors.New("registration is closed")
+	ErrAPIKeyNotFound      = errors.New("API key not found")
+	ErrInvalidAPIKey       = errors.New("invalid API key request")
+	ErrIPNotAllowed        = errors.New("API key is not allowed from this IP address")
+	ErrForbidden           = errors.New("your role does not allow this action")
+	ErrWorkspaceNotFound   = errors.New("workspace not found")
+	ErrInvalidWorkspace    = errors.New("invalid workspace request")
+	ErrDomainTaken         = errors.New("domain is already used by another workspace")
+	ErrMemberNotFound      = errors.New("member not found")
+	ErrLastOwner           = errors.New("a workspace must keep at least one owner")
+	ErrAlreadyMember       = errors.New("user is already a member of this workspace")
+	ErrInvitationNotFound  = errors.New("invitation not found or expired")
+	ErrInvalidAuditFilter  = errors.New("invalid audit filter")
+	ErrInvalidClickRange   = errors.New("invalid click range")
+	ErrQuotaExceeded       = errors.New("plan quota exceeded")
+)
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"linksprint/internal/database"
+	"linksprint/internal/redis"
+	"linksprint/internal/store"
+)
+
+// Stores are the storage behind the URL and analytics services
+type Stores struct {
+	URLs   store.URLStore
+	Clicks store.ClickStore
+	Cache  store.Cache
+	// Filter rules out unknown short codes before the URLStore is asked;
+	// nil sends every cache miss to the URLStore
+	Filter store.Filter
+}
+
+// NewStores returns the production stores: links and clicks in the
+// database, cached in Redis
+func NewStores(db *database.DB, redis *redis.Client) Stores {
+	sqlStore := store.NewSQL(db)
+	return Stores{
+		URLs:   sqlStore,
+		Clicks: sqlStore,
+		Cache:  store.NewRedisCache(redis),
+	}
+}
+
+// NewMemoryStores returns stores that keep links, clicks and the cache in
+// process
+func NewMemoryStores() Stores {
+	memory := store.NewMemory()
+	return Stores{
+		URLs:   memory,
+		Clicks: memory,
+		Cache:  store.NewMemoryCache(),
+	}
+}
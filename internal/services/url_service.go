@@ -3,37 +3,98 @@ package services
 import (
 	"context"
 	"crypto/rand"
-	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
+	mathrand "math/rand"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"linksprint/internal/database"
+	"linksprint/internal/config"
+	"linksprint/internal/logging"
+	"linksprint/internal/metrics"
 	"linksprint/internal/models"
-	"linksprint/internal/redis"
+	"linksprint/internal/pagination"
+	"linksprint/internal/store"
+	"linksprint/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// logger is the logger of the services package
+var logger = logging.For("services")
+
+const (
+	// earlyRefreshBeta scales how long before expiry hot links are looked
+	// up again; see shouldRefreshEarly
+	earlyRefreshBeta = 1.0
+	// refreshTimeout bounds background lookups of cached links
+	refreshTimeout = 5 * time.Second
 )
 
 // URLService handles URL shortening business logic
 type URLService struct {
-	db    *database.DB
-	redis *redis.Client
+	urls           store.URLStore
+	clicks         store.ClickStore
+	cache          store.Cache
+	filter         store.Filter
+	notFoundTTL    time.Duration
+	usage          *UsageService
+	config         *config.Live
+	baseURL        string
+	perDomainCodes bool
+
+	// lookups coalesces concurrent lookups of a link in the URLStore, and
+	// refreshing marks the links refreshed in the background
+	lookups    singleflight.Group
+	refreshing sync.Map
+	// lookupTime is a moving average of URLStore lookups, in nanoseconds
+	lookupTime atomic.Int64
 }
 
-// NewURLService creates a new URL service
-func NewURLService(db *database.DB, redis *redis.Client) *URLService {
+// NewURLService creates a new URL service on stores, charging new links to
+// usage. The destination blocklist is read from live on every check, so it
+// follows reloads.
+func NewURLService(stores Stores, usage *UsageService, live *config.Live) *URLService {
+	cfg := live.Config()
 	return &URLService{
-		db:    db,
-		redis: redis,
+		urls:           stores.URLs,
+		clicks:         stores.Clicks,
+		cache:          stores.Cache,
+		filter:         stores.Filter,
+		notFoundTTL:    cfg.Redis.NotFoundCacheTTL,
+		usage:          usage,
+		config:         live,
+		baseURL:        strings.TrimRight(cfg.Server.BaseURL, "/"),
+		perDomainCodes: cfg.Features.PerDomainShortCodes,
 	}
 }
 
-// CreateShortURL creates a new shortened URL
-func (s *URLService) CreateShortURL(ctx context.Context, req *models.CreateURLRequest) (*models.CreateURLResponse, error) {
+// CreateShortURL creates a new shortened URL in the principal's workspace
+func (s *URLService) CreateShortURL(ctx context.Context, principal *models.Principal, req *models.CreateURLRequest) (*models.CreateURLResponse, error) {
+	ctx, span := tracing.Start(ctx, "URLService.CreateShortURL")
+	defer span.End()
+
+	if !principal.Can(models.PermLinksWrite) {
+		return nil, ErrForbidden
+	}
+
 	// Validate original URL
 	if err := s.validateURL(req.OriginalURL); err != nil {
-		return nil, fmt.Errorf("invalid URL: %w", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	redirectType := models.DefaultRedirectType
+	if req.RedirectType != 0 {
+		if !models.ValidRedirectType(req.RedirectType) {
+			return nil, fmt.Errorf("%w: must be 301, 302, 307 or 308", ErrInvalidRedirectType)
+		}
+		redirectType = req.RedirectType
 	}
 
 	// Generate short code
@@ -47,132 +108,325 @@ func (s *URLService) CreateShortURL(ctx context.Context, req *models.CreateURLRe
 	} else {
 		// Validate custom code
 		if err := s.validateShortCode(shortCode); err != nil {
-			return nil, fmt.Errorf("invalid custom code: %w", err)
+			return nil, fmt.Errorf("%w: %v", ErrInvalidShortCode, err)
 		}
 	}
 
+	// Short codes are unique per domain; links only get the workspace's
+	// domain when per-domain short codes are enabled
+	domain, err := s.linkDomain(ctx, principal)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if short code already exists
-	exists, err := s.shortCodeExists(ctx, shortCode)
+	exists, err := s.urls.ShortCodeExists(ctx, domain, shortCode)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check short code: %w", err)
 	}
 	if exists {
-		return nil, fmt.Errorf("short code already exists")
+		return nil, ErrShortCodeTaken
 	}
 
-	// Create URL in database
-	urlID, err := s.createURLInDB(ctx, req, shortCode)
+	// Charge the link to the plan quotas, giving it back if creation fails
+	release, err := s.usage.ReserveLink(ctx, principal, req.CustomCode != "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create URL in database: %w", err)
+		return nil, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			release()
+		}
+	}()
+
+	// Let the link through the filter before it can be resolved
+	key := store.LinkKey(domain, shortCode)
+	if s.filter != nil {
+		if err := s.filter.Add(ctx, key); err != nil {
+			return nil, err
+		}
 	}
 
-	// Cache the URL in Redis
-	if err := s.redis.SetURL(ctx, shortCode, req.OriginalURL); err != nil {
-		log.Printf("Warning: failed to cache URL in Redis: %v", err)
+	// Create URL in database together with its audit event
+	created, err := s.urls.CreateURL(ctx, principal, &models.URL{
+		ShortCode:    shortCode,
+		OriginalURL:  req.OriginalURL,
+		Title:        req.Title,
+		Description:  req.Description,
+		ExpiresAt:    req.ExpiresAt,
+		RedirectType: redirectType,
+		CreatedBy:    principal.UserID,
+		WorkspaceID:  principal.WorkspaceID,
+		Domain:       domain,
+	})
+	if errors.Is(err, store.ErrConflict) {
+		return nil, ErrShortCodeTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	committed = true
+	metrics.LinksCreated.Inc()
+
+	// Cache the URL, replacing on every instance a cached lookup of the
+	// short code that found nothing
+	s.evictURL(ctx, created)
+	if err := s.cache.SetURL(ctx, key, store.NewLinkRecord(created)); err != nil {
+		logger.WarnContext(ctx, "failed to cache URL", slog.String("short_code", shortCode), slog.Any("error", err))
 	}
 
 	// Build short URL
-	shortURL := fmt.Sprintf("http://localhost:8080/%s", shortCode)
+	shortURL := fmt.Sprintf("%s/%s", s.baseURL, shortCode)
+	if domain != "" {
+		shortURL = fmt.Sprintf("https://%s/%s", domain, shortCode)
+	}
 
 	return &models.CreateURLResponse{
 		ShortCode:   shortCode,
 		OriginalURL: req.OriginalURL,
 		ShortURL:    shortURL,
-		CreatedAt:   time.Now(),
+		CreatedAt:   created.CreatedAt,
 	}, nil
 }
 
-// GetOriginalURL retrieves the original URL for a short code
-func (s *URLService) GetOriginalURL(ctx context.Context, shortCode string) (string, error) {
-	// Try to get from cache first
-	if originalURL, err := s.redis.GetURL(ctx, shortCode); err == nil {
-		// Increment click count in Redis
-		s.redis.IncrementClickCount(ctx, shortCode)
-		return originalURL, nil
+// GetOriginalURL resolves a short code requested on host to where it
+// redirects. With per-domain short codes, links of the workspace owning
+// host take precedence over links on the default domain. Cached and
+// freshly loaded links are checked alike, so expired and deleted links
+// stop redirecting whether they are cached or not.
+func (s *URLService) GetOriginalURL(ctx context.Context, host, shortCode string) (*models.Redirect, error) {
+	ctx, span := tracing.Start(ctx, "URLService.GetOriginalURL")
+	defer span.End()
+
+	domains := []string{""}
+	if s.perDomainCodes && host != "" {
+		domains = []string{strings.ToLower(host), ""}
+	}
+
+	var lastErr error
+	for _, domain := range domains {
+		record, err := s.lookupOriginalURL(ctx, domain, shortCode)
+		if err == nil {
+			redirect := &models.Redirect{
+				OriginalURL: record.OriginalURL,
+				Domain:      domain,
+				StatusCode:  record.RedirectType,
+			}
+			if !models.ValidRedirectType(redirect.StatusCode) {
+				redirect.StatusCode = models.DefaultRedirectType
+			}
+			return redirect, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (s *URLService) lookupOriginalURL(ctx context.Context, domain, shortCode string) (*store.LinkRecord, error) {
+	key := store.LinkKey(domain, shortCode)
+	span := trace.SpanFromContext(ctx)
+
+	// Try to get from cache first; cached links are checked the same way as
+	// links loaded from the database
+	entry, err := s.cache.GetURL(ctx, key)
+	switch {
+	case err == nil && !entry.Redirects(time.Now()):
+		metrics.RedirectCache.WithLabelValues(metrics.CacheNegative).Inc()
+		span.SetAttributes(attribute.String("cache.result", metrics.CacheNegative))
+		return nil, fmt.Errorf("URL not found: %w", store.ErrNotFound)
+	case err == nil && entry.Stale:
+		// Serve the last known destination, even if the database is down,
+		// while the link is looked up again
+		metrics.RedirectCache.WithLabelValues(metrics.CacheStale).Inc()
+		span.SetAttributes(attribute.String("cache.result", metrics.CacheStale))
+		s.refresh(ctx, domain, shortCode, metrics.RefreshStale)
+		return &entry.LinkRecord, nil
+	case err == nil:
+		metrics.RedirectCache.WithLabelValues(metrics.CacheHit).Inc()
+		span.SetAttributes(attribute.String("cache.result", metrics.CacheHit))
+		if s.shouldRefreshEarly(entry.FreshFor) {
+			s.refresh(ctx, domain, shortCode, metrics.RefreshEarly)
+		}
+		return &entry.LinkRecord, nil
+	case errors.Is(err, store.ErrCachedNotFound):
+		metrics.RedirectCache.WithLabelValues(metrics.CacheNegative).Inc()
+		span.SetAttributes(attribute.String("cache.result", metrics.CacheNegative))
+		return nil, fmt.Errorf("URL not found: %w", store.ErrNotFound)
+	case errors.Is(err, store.ErrCacheMiss):
+		metrics.RedirectCache.WithLabelValues(metrics.CacheMiss).Inc()
+		span.SetAttributes(attribute.String("cache.result", metrics.CacheMiss))
+	default:
+		metrics.RedirectCache.WithLabelValues(metrics.CacheError).Inc()
+		span.SetAttributes(attribute.String("cache.result", metrics.CacheError))
 	}
 
 	// If not in cache, get from database
-	originalURL, err := s.getURLFromDB(ctx, shortCode)
+	record, err := s.resolve(ctx, domain, shortCode)
 	if err != nil {
-		return "", fmt.Errorf("URL not found: %w", err)
+		return nil, fmt.Errorf("URL not found: %w", err)
+	}
+	return record, nil
+}
+
+// resolve looks a link up in the URLStore and caches the result. Concurrent
+// lookups of a link share one, so a hot link dropping out of the cache does
+// not send every request to the database.
+func (s *URLService) resolve(ctx context.Context, domain, shortCode string) (*store.LinkRecord, error) {
+	// The shared lookup outlives the caller that started it
+	lookupCtx := context.WithoutCancel(ctx)
+	record, err, _ := s.lookups.Do(store.LinkKey(domain, shortCode), func() (interface{}, error) {
+		return s.load(lookupCtx, domain, shortCode)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record.(*store.LinkRecord), nil
+}
+
+// load looks a link up in the URLStore, unless the filter rules it out, and
+// caches the result. Links that do not redirect are cached as not found.
+func (s *URLService) load(ctx context.Context, domain, shortCode string) (*store.LinkRecord, error) {
+	key := store.LinkKey(domain, shortCode)
+	span := trace.SpanFromContext(ctx)
+
+	// Short codes the filter rules out are not looked up at all
+	if s.filter != nil && !s.filter.MayExist(ctx, key) {
+		metrics.FilterRejections.Inc()
+		span.SetAttributes(attribute.Bool("filter.rejected", true))
+		s.cacheNotFound(ctx, key)
+		return nil, store.ErrNotFound
+	}
+
+	start := time.Now()
+	record, err := s.urls.ResolveURL(ctx, domain, shortCode)
+	s.observeLookup(time.Since(start))
+	if err == nil && !record.Redirects(time.Now()) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		s.cacheNotFound(ctx, key)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	// Cache the URL for future requests
-	if err := s.redis.SetURL(ctx, shortCode, originalURL); err != nil {
-		log.Printf("Warning: failed to cache URL in Redis: %v", err)
+	if err := s.cache.SetURL(ctx, key, *record); err != nil {
+		logger.WarnContext(ctx, "failed to cache URL", slog.String("short_code", shortCode), slog.Any("error", err))
 	}
+	return record, nil
+}
 
-	// Increment click count
-	s.redis.IncrementClickCount(ctx, shortCode)
+// refresh looks a cached link up again in the background, unless it
+// already is. Failures keep the cached destination.
+func (s *URLService) refresh(ctx context.Context, domain, shortCode, reason string) {
+	// Request strings are reused once the handler returns
+	domain, shortCode = strings.Clone(domain), strings.Clone(shortCode)
+	key := store.LinkKey(domain, shortCode)
+	if _, busy := s.refreshing.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	metrics.CacheRefreshes.WithLabelValues(reason).Inc()
 
-	return originalURL, nil
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+	go func() {
+		defer cancel()
+		defer s.refreshing.Delete(key)
+
+		if _, err := s.resolve(ctx, domain, shortCode); err != nil && !errors.Is(err, store.ErrNotFound) {
+			logger.WarnContext(ctx, "failed to refresh cached URL", slog.String("short_code", shortCode), slog.Any("error", err))
+		}
+	}()
 }
 
-// GetURLStats gets statistics for a URL
-func (s *URLService) GetURLStats(ctx context.Context, shortCode string) (*models.URLStats, error) {
+// shouldRefreshEarly decides whether a cached link fresh for freshFor is
+// looked up again before it expires. The probability rises as expiry
+// nears and is higher the slower lookups are ("optimal probabilistic cache
+// stampede prevention", Vattani et al.), so a hot link is usually refreshed
+// by a single request just before it expires.
+func (s *URLService) shouldRefreshEarly(freshFor time.Duration) bool {
+	lookupTime := s.lookupTime.Load()
+	if freshFor <= 0 || lookupTime <= 0 {
+		return false
+	}
+	return float64(lookupTime)*earlyRefreshBeta*-math.Log(mathrand.Float64()) >= float64(freshFor)
+}
+
+// observeLookup adds the duration of a URLStore lookup to the moving
+// average
+func (s *URLService) observeLookup(d time.Duration) {
+	for {
+		current := s.lookupTime.Load()
+		next := int64(d)
+		if current > 0 {
+			next = current + (next-current)/8
+		}
+		if s.lookupTime.CompareAndSwap(current, next) {
+			return
+		}
+	}
+}
+
+// GetURLStats gets statistics for a URL in the principal's workspace
+func (s *URLService) GetURLStats(ctx context.Context, principal *models.Principal, shortCode string) (*models.URLStats, error) {
+	ctx, span := tracing.Start(ctx, "URLService.GetURLStats")
+	defer span.End()
+
 	// Get URL from database
-	url, err := s.getURLByShortCode(ctx, shortCode)
+	url, err := getWorkspaceURL(ctx, s.urls, principal, models.PermLinksRead, shortCode)
 	if err != nil {
-		return nil, fmt.Errorf("URL not found: %w", err)
+		return nil, err
+	}
+
+	// Clicks flushed to the link's counter, plus those still pending in the
+	// cache
+	clickCount, err := s.clicks.ClickCounter(ctx, url.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get click count: %w", err)
+	}
+	pending, err := s.cache.PendingClicks(ctx, url.ID)
+	if err != nil {
+		logger.WarnContext(ctx, "failed to get pending clicks", slog.String("short_code", shortCode), slog.Any("error", err))
 	}
+	clickCount += pending
 
-	// Get click count from Redis
-	clickCount, err := s.redis.GetClickCount(ctx, shortCode)
+	// Unique visitors since the link was created
+	visitors, err := s.cache.CountVisitors(ctx, url.ID, url.CreatedAt, time.Now())
 	if err != nil {
-		clickCount = 0 // Default to 0 if not found
+		logger.WarnContext(ctx, "failed to count visitors", slog.String("short_code", shortCode), slog.Any("error", err))
 	}
 
 	return &models.URLStats{
-		ShortCode:   url.ShortCode,
-		OriginalURL: url.OriginalURL,
-		TotalClicks: clickCount,
-		CreatedAt:   url.CreatedAt,
+		ShortCode:    url.ShortCode,
+		OriginalURL:  url.OriginalURL,
+		TotalClicks:  clickCount,
+		UniqueClicks: visitors,
+		CreatedAt:    url.CreatedAt,
 	}, nil
 }
 
-// ListURLs lists all URLs with pagination
-func (s *URLService) ListURLs(ctx context.Context, page, perPage int) (*models.URLListResponse, error) {
+// ListURLs lists the URLs of the principal's workspace with pagination
+func (s *URLService) ListURLs(ctx context.Context, principal *models.Principal, page, perPage int) (*models.URLListResponse, error) {
+	ctx, span := tracing.Start(ctx, "URLService.ListURLs")
+	defer span.End()
+
+	if !principal.Can(models.PermLinksRead) {
+		return nil, ErrForbidden
+	}
 	offset := (page - 1) * perPage
 
 	// Get total count
-	var total int
-	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM urls WHERE is_active = true").Scan(&total)
+	count, err := s.urls.CountURLs(ctx, principal.WorkspaceID, time.Time{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total count: %w", err)
 	}
+	total := int(count)
 
 	// Get URLs
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, short_code, original_url, title, description, created_at, updated_at, created_by, is_active, expires_at
-		FROM urls 
-		WHERE is_active = true 
-		ORDER BY created_at DESC 
-		LIMIT $1 OFFSET $2
-	`, perPage, offset)
+	urls, err := s.urls.ListURLs(ctx, principal.WorkspaceID, offset, perPage)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query URLs: %w", err)
-	}
-	defer rows.Close()
-
-	var urls []models.URL
-	for rows.Next() {
-		var url models.URL
-		err := rows.Scan(
-			&url.ID,
-			&url.ShortCode,
-			&url.OriginalURL,
-			&url.Title,
-			&url.Description,
-			&url.CreatedAt,
-			&url.UpdatedAt,
-			&url.CreatedBy,
-			&url.IsActive,
-			&url.ExpiresAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan URL: %w", err)
-		}
-		urls = append(urls, url)
+		return nil, err
 	}
 
 	totalPages := (total + perPage - 1) / perPage
@@ -186,6 +440,118 @@ func (s *URLService) ListURLs(ctx context.Context, page, perPage int) (*models.U
 	}, nil
 }
 
+// ListURLsByCursor lists the URLs of the principal's workspace newest first
+// using keyset pagination on (created_at, id). It stays fast at any depth
+// and never skips or repeats rows while links are being created. The total
+// is only counted on request.
+func (s *URLService) ListURLsByCursor(ctx context.Context, principal *models.Principal, cursor string, limit int, withTotal bool) (*models.URLCursorListResponse, error) {
+	ctx, span := tracing.Start(ctx, "URLService.ListURLsByCursor")
+	defer span.End()
+
+	if !principal.Can(models.PermLinksRead) {
+		return nil, ErrForbidden
+	}
+	after, err := pagination.Decode(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra row to find out whether another page exists
+	urls, err := s.urls.ListURLsAfter(ctx, principal.WorkspaceID, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.URLCursorListResponse{Limit: limit}
+	if len(urls) > limit {
+		urls = urls[:limit]
+		last := urls[len(urls)-1]
+		response.HasMore = true
+		response.NextCursor = pagination.Cursor{Time: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	response.URLs = urls
+
+	if withTotal {
+		total, err := s.urls.CountURLs(ctx, principal.WorkspaceID, time.Time{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get total count: %w", err)
+		}
+		response.Total = &total
+	}
+
+	return response, nil
+}
+
+// UpdateURL repoints or edits a URL in the principal's workspace and evicts
+// it from the cache so redirects pick up the change
+func (s *URLService) UpdateURL(ctx context.Context, principal *models.Principal, shortCode string, req *models.UpdateURLRequest) (*models.URL, error) {
+	ctx, span := tracing.Start(ctx, "URLService.UpdateURL")
+	defer span.End()
+
+	if req.OriginalURL != nil {
+		if err := s.validateURL(*req.OriginalURL); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+		}
+	}
+	if req.RedirectType != nil && !models.ValidRedirectType(*req.RedirectType) {
+		return nil, fmt.Errorf("%w: must be 301, 302, 307 or 308", ErrInvalidRedirectType)
+	}
+
+	if !principal.Can(models.PermLinksWrite) {
+		return nil, ErrForbidden
+	}
+
+	url, err := s.urls.UpdateURL(ctx, principal, shortCode, func(url *models.URL) {
+		if req.OriginalURL != nil {
+			url.OriginalURL = *req.OriginalURL
+		}
+		if req.Title != nil {
+			url.Title = *req.Title
+		}
+		if req.Description != nil {
+			url.Description = *req.Description
+		}
+		if req.ExpiresAt != nil {
+			expiresAt := req.ExpiresAt.UTC()
+			url.ExpiresAt = &expiresAt
+		}
+		if req.RedirectType != nil {
+			url.RedirectType = *req.RedirectType
+		}
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.evictURL(ctx, url)
+	return url, nil
+}
+
+// DeleteURL soft-deletes a URL in the principal's workspace and evicts it
+// from the cache so it stops redirecting
+func (s *URLService) DeleteURL(ctx context.Context, principal *models.Principal, shortCode string) error {
+	ctx, span := tracing.Start(ctx, "URLService.DeleteURL")
+	defer span.End()
+
+	if !principal.Can(models.PermLinksWrite) {
+		return ErrForbidden
+	}
+
+	url, err := s.urls.DeleteURL(ctx, principal, shortCode)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrURLNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	s.evictURL(ctx, url)
+	return nil
+}
+
 // Helper methods
 
 func (s *URLService) validateURL(originalURL string) error {
@@ -196,6 +562,9 @@ func (s *URLService) validateURL(originalURL string) error {
 	if parsedURL.Scheme == "" || parsedURL.Host == "" {
 		return fmt.Errorf("URL must have scheme and host")
 	}
+	if s.config.Blocklist().BlocksDomain(parsedURL.Hostname()) {
+		return fmt.Errorf("links to %s are not allowed", parsedURL.Hostname())
+	}
 	return nil
 }
 
@@ -228,54 +597,46 @@ func (s *URLService) generateShortCode() (string, error) {
 	return string(bytes), nil
 }
 
-func (s *URLService) shortCodeExists(ctx context.Context, shortCode string) (bool, error) {
-	var exists bool
-	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM urls WHERE short_code = $1)", shortCode).Scan(&exists)
-	return exists, err
+// evictURL drops a URL from the cache; failures only delay the change until
+// the cache entry expires
+func (s *URLService) evictURL(ctx context.Context, url *models.URL) {
+	if err := s.cache.DeleteURL(ctx, store.LinkKey(url.Domain, url.ShortCode)); err != nil {
+		logger.WarnContext(ctx, "failed to evict URL from cache", slog.String("short_code", url.ShortCode), slog.Any("error", err))
+	}
 }
 
-func (s *URLService) createURLInDB(ctx context.Context, req *models.CreateURLRequest, shortCode string) (string, error) {
-	var urlID string
-	err := s.db.QueryRowContext(ctx, `
-		INSERT INTO urls (short_code, original_url, title, description, expires_at)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id
-	`, shortCode, req.OriginalURL, req.Title, req.Description, req.ExpiresAt).Scan(&urlID)
-	return urlID, err
+// cacheNotFound caches that a key resolves to no link, if negative caching
+// is enabled
+func (s *URLService) cacheNotFound(ctx context.Context, key string) {
+	if s.notFoundTTL <= 0 {
+		return
+	}
+	if err := s.cache.SetNotFound(ctx, key, s.notFoundTTL); err != nil {
+		logger.WarnContext(ctx, "failed to cache unknown short code", slog.String("key", key), slog.Any("error", err))
+	}
 }
 
-func (s *URLService) getURLFromDB(ctx context.Context, shortCode string) (string, error) {
-	var originalURL string
-	err := s.db.QueryRowContext(ctx, `
-		SELECT original_url FROM urls 
-		WHERE short_code = $1 AND is_active = true 
-		AND (expires_at IS NULL OR expires_at > NOW())
-	`, shortCode).Scan(&originalURL)
-	if err == sql.ErrNoRows {
-		return "", fmt.Errorf("URL not found or expired")
-	}
-	return originalURL, err
+// linkDomain returns the domain new links of the principal's workspace are
+// created on, or "" for the default domain
+func (s *URLService) linkDomain(ctx context.Context, principal *models.Principal) (string, error) {
+	if !s.perDomainCodes {
+		return "", nil
+	}
+
+	return s.urls.WorkspaceDomain(ctx, principal.WorkspaceID)
 }
 
-func (s *URLService) getURLByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
-	var url models.URL
-	err := s.db.QueryRowContext(ctx, `
-		SELECT id, short_code, original_url, title, description, created_at, updated_at, created_by, is_active, expires_at
-		FROM urls WHERE short_code = $1 AND is_active = true
-	`, shortCode).Scan(
-		&url.ID,
-		&url.ShortCode,
-		&url.OriginalURL,
-		&url.Title,
-		&url.Description,
-		&url.CreatedAt,
-		&url.UpdatedAt,
-		&url.CreatedBy,
-		&url.IsActive,
-		&url.ExpiresAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("URL not found")
-	}
-	return &url, err
-} 
\ No newline at end of file
+// getWorkspaceURL loads an active URL of the principal's workspace after
+// checking that the principal's role grants perm. URLs of other workspaces
+// are treated as missing so their existence is not revealed.
+func getWorkspaceURL(ctx context.Context, urls store.URLStore, principal *models.Principal, perm models.Permission, shortCode string) (*models.URL, error) {
+	if !principal.Can(perm) {
+		return nil, ErrForbidden
+	}
+
+	url, err := urls.GetURL(ctx, principal.WorkspaceID, shortCode)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrURLNotFound
+	}
+	return url, err
+}
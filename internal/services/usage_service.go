@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"linksprint/internal/database"
+	"linksprint/internal/models"
+	"linksprint/internal/redis"
+)
+
+// Kinds of usage scopes
+const (
+	usageScopeWorkspace = "workspace"
+	usageScopeAPIKey    = "api_key"
+)
+
+// UsageService meters usage against plan quotas. Counters live in Redis and
+// are rolled up per day into the usage_daily table, which also reseeds them
+// if Redis loses its data.
+type UsageService struct {
+	db    *database.DB
+	redis *redis.Client
+}
+
+// NewUsageService creates a new usage service
+func NewUsageService(db *database.DB, redis *redis.Client) *UsageService {
+	return &UsageService{
+		db:    db,
+		redis: redis,
+	}
+}
+
+// usageScope is something usage is charged to: a workspace, or an API key
+// with its own plan
+type usageScope struct {
+	kind string
+	id   string
+	plan models.Plan
+}
+
+// ReserveLink charges the creation of a link to the principal's workspace
+// and API key, checking the active link quota first. The returned function
+// gives the reservation back if the link ends up not being created.
+func (s *UsageService) ReserveLink(ctx context.Context, principal *models.Principal, customCode bool) (func(), error) {
+	scopes, err := s.principalScopes(ctx, principal)
+	if err != nil {
+		return nil, err
+	}
+
+	// Concurrent creations may overshoot the active link quota slightly;
+	// it is a gauge counted from the database rather than a metered total
+	if limit := scopes[0].plan.ActiveLinks; limit > 0 {
+		active, err := s.activeLinks(ctx, principal.WorkspaceID)
+		if err != nil {
+			return nil, err
+		}
+		if active >= limit {
+			return nil, fmt.Errorf("%w: %d active links", ErrQuotaExceeded, limit)
+		}
+	}
+
+	metrics := []string{models.MetricLinksCreated}
+	if customCode {
+		metrics = append(metrics, models.MetricCustomCodes)
+	}
+	return s.consume(ctx, scopes, metrics)
+}
+
+// ConsumeClick charges a tracked click to a workspace on the given plan and
+// reports whether the click is within the quota
+func (s *UsageService) ConsumeClick(ctx context.Context, workspaceID, planName string) (bool, error) {
+	scope := usageScope{kind: usageScopeWorkspace, id: workspaceID, plan: planFor(planName)}
+	if _, err := s.consume(ctx, []usageScope{scope}, []string{models.MetricClicks}); err != nil {
+		if errors.Is(err, ErrQuotaExceeded) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// GetUsage reports the usage of the principal's workspace for the current
+// month, and of the calling API key when it has its own plan
+func (s *UsageService) GetUsage(ctx context.Context, principal *models.Principal) (*models.UsageResponse, error) {
+	if !principal.Can(models.PermLinksRead) {
+		return nil, ErrForbidden
+	}
+	scopes, err := s.principalScopes(ctx, principal)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	response := &models.UsageResponse{
+		WorkspaceID: principal.WorkspaceID,
+		Period:      now.Format("2006-01"),
+		ResetsAt:    monthStart.AddDate(0, 1, 0),
+	}
+
+	for _, scope := range scopes {
+		report := models.UsageReport{Plan: scope.plan.Name, Metrics: map[string]models.UsageMetric{}}
+		for _, metric := range []string{models.MetricLinksCreated, models.MetricCustomCodes, models.MetricClicks} {
+			used, err := s.monthlyUsage(ctx, scope, metric, now)
+			if err != nil {
+				return nil, err
+			}
+			report.Metrics[metric] = usageMetric(used, scope.plan.Limit(metric))
+		}
+
+		if scope.kind == usageScopeWorkspace {
+			active, err := s.activeLinks(ctx, scope.id)
+			if err != nil {
+				return nil, err
+			}
+			report.Metrics[models.MetricActiveLinks] = usageMetric(active, scope.plan.ActiveLinks)
+			response.Workspace = report
+		} else {
+			response.APIKey = &report
+		}
+	}
+	return response, nil
+}
+
+// Rollup copies today's and yesterday's counters from Redis into the
+// usage_daily table. It is idempotent and never lowers a stored count.
+func (s *UsageService) Rollup(ctx context.Context) error {
+	now := time.Now().UTC()
+	for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+		members, err := s.redis.UsageDayMembers(ctx, usageDayIndex(day))
+		if err != nil {
+			return fmt.Errorf("failed to list usage counters: %w", err)
+		}
+
+		for _, member := range members {
+			parts := strings.SplitN(member, ":", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			scope := usageScope{kind: parts[0], id: parts[1]}
+			count, err := s.redis.GetUsage(ctx, usageKeys(scope, parts[2], day).Day)
+			if err != nil {
+				return fmt.Errorf("failed to read usage counter: %w", err)
+			}
+			if count == nil {
+				continue
+			}
+
+			_, err = s.db.ExecContext(ctx, `
+				INSERT INTO usage_daily (scope_type, scope_id, metric, day, count, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (scope_type, scope_id, metric, day)
+				DO UPDATE SET count = GREATEST(usage_daily.count, excluded.count), updated_at = excluded.updated_at
+			`, scope.kind, scope.id, parts[2], day.Format("2006-01-02"), *count, now)
+			if err != nil {
+				return fmt.Errorf("failed to roll up usage: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// StartRollup runs Rollup every interval until ctx is cancelled
+func (s *UsageService) StartRollup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Rollup(ctx); err != nil {
+					logger.WarnContext(ctx, "usage rollup failed", slog.Any("error", err))
+				}
+			}
+		}
+	}()
+}
+
+// Helper methods
+
+// principalScopes returns the workspace scope followed by the API key scope
+// when the calling key has a plan of its own
+func (s *UsageService) principalScopes(ctx context.Context, principal *models.Principal) ([]usageScope, error) {
+	var planName string
+	err := s.db.QueryRowContext(ctx, `SELECT plan FROM workspaces WHERE id = $1`, principal.WorkspaceID).Scan(&planName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workspace plan: %w", err)
+	}
+
+	scopes := []usageScope{{kind: usageScopeWorkspace, id: principal.WorkspaceID, plan: planFor(planName)}}
+	if principal.IsAPIKey() && principal.APIKeyPlan != "" {
+		scopes = append(scopes, usageScope{kind: usageScopeAPIKey, id: principal.APIKeyID, plan: planFor(principal.APIKeyPlan)})
+	}
+	return scopes, nil
+}
+
+// consume charges one unit of each metric to every scope, all or nothing.
+// Usage is let through when Redis is unavailable.
+func (s *UsageService) consume(ctx context.Context, scopes []usageScope, metrics []string) (func(), error) {
+	now := time.Now().UTC()
+	var consumed []redis.UsageKeys
+	refund := func() {
+		for _, keys := range consumed {
+			if err := s.redis.RefundUsage(context.Background(), keys, 1); err != nil {
+				logger.WarnContext(ctx, "failed to refund usage", slog.Any("error", err))
+			}
+		}
+	}
+
+	for _, scope := range scopes {
+		for _, metric := range metrics {
+			keys := usageKeys(scope, metric, now)
+			used, ok, err := s.redis.ConsumeUsage(ctx, keys, 1, scope.plan.Limit(metric))
+			if errors.Is(err, redis.ErrUsageNotSeeded) {
+				if err = s.seed(ctx, scope, metric, now); err == nil {
+					used, ok, err = s.redis.ConsumeUsage(ctx, keys, 1, scope.plan.Limit(metric))
+				}
+			}
+			if err != nil {
+				logger.WarnContext(ctx, "usage metering unavailable, allowing request", slog.String("metric", metric), slog.Any("error", err))
+				continue
+			}
+			if !ok {
+				refund()
+				return nil, fmt.Errorf("%w: %d of %d %s used this month", ErrQuotaExceeded, used, scope.plan.Limit(metric), metric)
+			}
+			consumed = append(consumed, keys)
+		}
+	}
+	return refund, nil
+}
+
+// seed initializes a scope's counters from the rolled-up daily totals
+func (s *UsageService) seed(ctx context.Context, scope usageScope, metric string, now time.Time) error {
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var month, today int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(count), 0), COALESCE(SUM(CASE WHEN day = $5 THEN count ELSE 0 END), 0)
+		FROM usage_daily
+		WHERE scope_type = $1 AND scope_id = $2 AND metric = $3 AND day >= $4
+	`, scope.kind, scope.id, metric, monthStart.Format("2006-01-02"), now.Format("2006-01-02")).Scan(&month, &today)
+	if err != nil {
+		return fmt.Errorf("failed to load rolled-up usage: %w", err)
+	}
+	return s.redis.SeedUsage(ctx, usageKeys(scope, metric, now), month, today)
+}
+
+// monthlyUsage reads a scope's usage of a metric this month
+func (s *UsageService) monthlyUsage(ctx context.Context, scope usageScope, metric string, now time.Time) (int64, error) {
+	keys := usageKeys(scope, metric, now)
+	used, err := s.redis.GetUsage(ctx, keys.Month)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read usage: %w", err)
+	}
+	if used == nil {
+		if err := s.seed(ctx, scope, metric, now); err != nil {
+			return 0, err
+		}
+		if used, err = s.redis.GetUsage(ctx, keys.Month); err != nil {
+			return 0, fmt.Errorf("failed to read usage: %w", err)
+		}
+		if used == nil {
+			return 0, nil
+		}
+	}
+	return *used, nil
+}
+
+func (s *UsageService) activeLinks(ctx context.Context, workspaceID string) (int64, error) {
+	var active int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM urls WHERE workspace_id = $1 AND is_active = true
+	`, workspaceID).Scan(&active)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count active links: %w", err)
+	}
+	return active, nil
+}
+
+// usageKeys names the Redis counters of a scope's metric at a time
+func usageKeys(scope usageScope, metric string, at time.Time) redis.UsageKeys {
+	member := fmt.Sprintf("%s:%s:%s", scope.kind, scope.id, metric)
+	return redis.UsageKeys{
+		Month:    fmt.Sprintf("usage:%s:m:%s", member, at.Format("2006-01")),
+		Day:      fmt.Sprintf("usage:%s:d:%s", member, at.Format("2006-01-02")),
+		DayIndex: usageDayIndex(at),
+		Member:   member,
+	}
+}
+
+func usageDayIndex(day time.Time) string {
+	return "usage:days:" + day.Format("2006-01-02")
+}
+
+// planFor looks up a plan by name, falling back to the free plan
+func planFor(name string) models.Plan {
+	if plan, ok := models.Plans[name]; ok {
+		return plan
+	}
+	return models.Plans[models.PlanFree]
+}
+
+func usageMetric(used, limit int64) models.UsageMetric {
+	metric := models.UsageMetric{Used: used}
+	if limit > 0 {
+		metric.Limit = &limit
+	}
+	return metric
+}
@@ -0,0 +1,805 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"linksprint/internal/audit"
+	"linksprint/internal/database"
+	"linksprint/internal/models"
+	"linksprint/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// invitationTTL is how long an invitation can be accepted
+const invitationTTL = 7 * 24 * time.Hour
+
+var (
+	domainPattern   = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+	slugUnsafeChars = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// WorkspaceService handles workspaces, memberships and invitations
+type WorkspaceService struct {
+	db *database.DB
+}
+
+// NewWorkspaceService creates a new workspace service
+func NewWorkspaceService(db *database.DB) *WorkspaceService {
+	return &WorkspaceService{
+		db: db,
+	}
+}
+
+// ResolveWorkspace sets the workspace the principal acts in and its role
+// there. API keys are bound to their own workspace; users may pick one of
+// their workspaces by ID and otherwise act in their oldest membership. A
+// user without any workspace gets a personal one.
+func (s *WorkspaceService) ResolveWorkspace(ctx context.Context, principal *models.Principal, workspaceID string) error {
+	if principal.WorkspaceID != "" {
+		if workspaceID != "" && workspaceID != principal.WorkspaceID {
+			return ErrForbidden
+		}
+		workspaceID = principal.WorkspaceID
+	}
+
+	if workspaceID == "" {
+		defaultID, err := s.defaultWorkspaceID(ctx, principal.UserID)
+		if err != nil {
+			return err
+		}
+		workspaceID = defaultID
+	}
+
+	role, err := s.memberRole(ctx, workspaceID, principal.UserID)
+	if err != nil {
+		return err
+	}
+
+	principal.WorkspaceID = workspaceID
+	principal.Role = role
+	return nil
+}
+
+// CreateWorkspace creates a workspace owned by the principal
+func (s *WorkspaceService) CreateWorkspace(ctx context.Context, principal *models.Principal, req *models.CreateWorkspaceRequest) (*models.Workspace, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("%w: name must be between 1 and 100 characters", ErrInvalidWorkspace)
+	}
+	domain, err := normalizeDomain(req.Domain)
+	if err != nil {
+		return nil, err
+	}
+	slug, err := newSlug(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate slug: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	workspace, err := insertWorkspace(ctx, tx, name, slug, domain, principal.UserID)
+	if err != nil {
+		return nil, err
+	}
+	workspace.Role = models.RoleOwner
+
+	err = audit.Record(ctx, tx, principal, audit.Event{
+		WorkspaceID: workspace.ID,
+		Action:      models.AuditWorkspaceCreate,
+		TargetType:  "workspace",
+		TargetID:    workspace.ID,
+		After:       workspace,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit workspace: %w", err)
+	}
+	return workspace, nil
+}
+
+// ListWorkspaces lists the workspaces the principal belongs to, with the
+// principal's role in each
+func (s *WorkspaceService) ListWorkspaces(ctx context.Context, principal *models.Principal) ([]models.Workspace, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+workspaceColumns+`, m.role
+		FROM workspaces w JOIN workspace_members m ON m.workspace_id = w.id
+		WHERE m.user_id = $1
+		ORDER BY m.created_at
+	`, principal.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	workspaces := []models.Workspace{}
+	for rows.Next() {
+		var workspace models.Workspace
+		if err := scanWorkspace(rows, &workspace, &workspace.Role); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
+		workspaces = append(workspaces, workspace)
+	}
+	return workspaces, rows.Err()
+}
+
+// UpdateWorkspace renames a workspace or changes its short link domain
+func (s *WorkspaceService) UpdateWorkspace(ctx context.Context, principal *models.Principal, workspaceID string, req *models.UpdateWorkspaceRequest) (*models.Workspace, error) {
+	role, err := s.requireRole(ctx, principal, workspaceID, models.PermWorkspaceManage)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := getWorkspaceTx(ctx, tx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	workspace := *before
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 100 {
+			return nil, fmt.Errorf("%w: name must be between 1 and 100 characters", ErrInvalidWorkspace)
+		}
+		workspace.Name = name
+	}
+	if req.Domain != nil {
+		domain, err := normalizeDomain(*req.Domain)
+		if err != nil {
+			return nil, err
+		}
+		workspace.Domain = domain
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE workspaces SET name = $1, domain = $2, updated_at = $3
+		WHERE id = $4
+		RETURNING updated_at
+	`, workspace.Name, nullString(workspace.Domain), time.Now().UTC(), workspaceID).Scan(&workspace.UpdatedAt)
+	if database.IsUniqueViolation(err) {
+		return nil, ErrDomainTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update workspace: %w", err)
+	}
+
+	err = audit.Record(ctx, tx, principal, audit.Event{
+		WorkspaceID: workspaceID,
+		Action:      models.AuditWorkspaceUpdate,
+		TargetType:  "workspace",
+		TargetID:    workspaceID,
+		Before:      before,
+		After:       &workspace,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit workspace: %w", err)
+	}
+
+	workspace.Role = role
+	return &workspace, nil
+}
+
+// SetPlan moves a workspace to another plan, whose quotas apply from its
+// next request. Plans are assigned by operators rather than members, so no
+// role is checked; principal is nil outside of requests.
+func (s *WorkspaceService) SetPlan(ctx context.Context, principal *models.Principal, workspaceID, plan string) (*models.Workspace, error) {
+	if _, ok := models.Plans[plan]; !ok {
+		return nil, fmt.Errorf("%w: unknown plan %q", ErrInvalidWorkspace, plan)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := getWorkspaceTx(ctx, tx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	workspace := *before
+	workspace.Plan = plan
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE workspaces SET plan = $1, updated_at = $2
+		WHERE id = $3
+		RETURNING updated_at
+	`, plan, time.Now().UTC(), workspaceID).Scan(&workspace.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update workspace plan: %w", err)
+	}
+
+	err = audit.Record(ctx, tx, principal, audit.Event{
+		WorkspaceID: workspaceID,
+		Action:      models.AuditWorkspaceUpdate,
+		TargetType:  "workspace",
+		TargetID:    workspaceID,
+		Before:      before,
+		After:       &workspace,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit workspace: %w", err)
+	}
+	return &workspace, nil
+}
+
+// ListMembers lists the members of a workspace the principal belongs to
+func (s *WorkspaceService) ListMembers(ctx context.Context, principal *models.Principal, workspaceID string) ([]models.WorkspaceMember, error) {
+	if _, err := s.requireRole(ctx, principal, workspaceID, models.PermLinksRead); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT m.workspace_id, m.user_id, u.email, COALESCE(u.name, ''), m.role, m.created_at
+		FROM workspace_members m JOIN users u ON u.id = m.user_id
+		WHERE m.workspace_id = $1
+		ORDER BY m.created_at
+	`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []models.WorkspaceMember{}
+	for rows.Next() {
+		var member models.WorkspaceMember
+		err := rows.Scan(&member.WorkspaceID, &member.UserID, &member.Email, &member.Name, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan member: %w", err)
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// UpdateMemberRole changes a member's role. Only owners may grant or take
+// away the owner role, and the last owner cannot be demoted.
+func (s *WorkspaceService) UpdateMemberRole(ctx context.Context, principal *models.Principal, workspaceID, userID string, role models.Role) error {
+	if !role.IsValid() {
+		return fmt.Errorf("%w: unknown role %q", ErrInvalidWorkspace, role)
+	}
+	actorRole, err := s.requireRole(ctx, principal, workspaceID, models.PermMembersManage)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := memberRoleTx(ctx, tx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if (current == models.RoleOwner || role == models.RoleOwner) && actorRole != models.RoleOwner {
+		return ErrForbidden
+	}
+	if current == models.RoleOwner && role != models.RoleOwner {
+		if err := ensureAnotherOwner(ctx, tx, workspaceID); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE workspace_members SET role = $1 WHERE workspace_id = $2 AND user_id = $3
+	`, string(role), workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update member: %w", err)
+	}
+
+	err = audit.Record(ctx, tx, principal, audit.Event{
+		WorkspaceID: workspaceID,
+		Action:      models.AuditMemberUpdate,
+		TargetType:  "member",
+		TargetID:    userID,
+		Before:      memberSnapshot{Role: current},
+		After:       memberSnapshot{Role: role},
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveMember removes a member from a workspace. Members may always leave
+// on their own; removing others needs the members:manage permission.
+func (s *WorkspaceService) RemoveMember(ctx context.Context, principal *models.Principal, workspaceID, userID string) error {
+	perm := models.PermMembersManage
+	if userID == principal.UserID {
+		perm = models.PermLinksRead
+	}
+	actorRole, err := s.requireRole(ctx, principal, workspaceID, perm)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := memberRoleTx(ctx, tx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if current == models.RoleOwner {
+		if actorRole != models.RoleOwner {
+			return ErrForbidden
+		}
+		if err := ensureAnotherOwner(ctx, tx, workspaceID); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2
+	`, workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+
+	err = audit.Record(ctx, tx, principal, audit.Event{
+		WorkspaceID: workspaceID,
+		Action:      models.AuditMemberRemove,
+		TargetType:  "member",
+		TargetID:    userID,
+		Before:      memberSnapshot{Role: current},
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateInvitation invites an email address to join a workspace with a role
+func (s *WorkspaceService) CreateInvitation(ctx context.Context, principal *models.Principal, workspaceID string, req *models.CreateInvitationRequest) (*models.CreateInvitationResponse, error) {
+	if !req.Role.IsValid() {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidWorkspace, req.Role)
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWorkspace, err)
+	}
+	actorRole, err := s.requireRole(ctx, principal, workspaceID, models.PermMembersManage)
+	if err != nil {
+		return nil, err
+	}
+	if req.Role == models.RoleOwner && actorRole != models.RoleOwner {
+		return nil, ErrForbidden
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+
+	invitation := &models.WorkspaceInvitation{
+		WorkspaceID: workspaceID,
+		Email:       email,
+		Role:        req.Role,
+		InvitedBy:   principal.UserID,
+		ExpiresAt:   time.Now().UTC().Add(invitationTTL),
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO workspace_invitations (workspace_id, email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, workspaceID, email, string(req.Role), hashToken(token), principal.UserID, invitation.ExpiresAt).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	err = audit.Record(ctx, tx, principal, audit.Event{
+		WorkspaceID: workspaceID,
+		Action:      models.AuditInvitationCreate,
+		TargetType:  "invitation",
+		TargetID:    invitation.ID,
+		After:       invitation,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit invitation: %w", err)
+	}
+
+	return &models.CreateInvitationResponse{WorkspaceInvitation: invitation, Token: token}, nil
+}
+
+// ListInvitations lists the pending invitations of a workspace
+func (s *WorkspaceService) ListInvitations(ctx context.Context, principal *models.Principal, workspaceID string) ([]models.WorkspaceInvitation, error) {
+	if _, err := s.requireRole(ctx, principal, workspaceID, models.PermMembersManage); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, workspace_id, email, role, invited_by, expires_at, accepted_at, created_at
+		FROM workspace_invitations
+		WHERE workspace_id = $1 AND accepted_at IS NULL AND expires_at > $2
+		ORDER BY created_at DESC
+	`, workspaceID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []models.WorkspaceInvitation{}
+	for rows.Next() {
+		var inv models.WorkspaceInvitation
+		err := rows.Scan(&inv.ID, &inv.WorkspaceID, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.ExpiresAt, &inv.AcceptedAt, &inv.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// RevokeInvitation deletes a pending invitation
+func (s *WorkspaceService) RevokeInvitation(ctx context.Context, principal *models.Principal, workspaceID, invitationID string) error {
+	if _, err := s.requireRole(ctx, principal, workspaceID, models.PermMembersManage); err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(invitationID); err != nil {
+		return ErrInvitationNotFound
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var inv models.WorkspaceInvitation
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM workspace_invitations
+		WHERE id = $1 AND workspace_id = $2 AND accepted_at IS NULL
+		RETURNING id, workspace_id, email, role, invited_by, expires_at, accepted_at, created_at
+	`, invitationID, workspaceID).Scan(&inv.ID, &inv.WorkspaceID, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.ExpiresAt, &inv.AcceptedAt, &inv.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvitationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+
+	err = audit.Record(ctx, tx, principal, audit.Event{
+		WorkspaceID: workspaceID,
+		Action:      models.AuditInvitationRevoke,
+		TargetType:  "invitation",
+		TargetID:    invitationID,
+		Before:      &inv,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AcceptInvitation adds the principal to the invitation's workspace. The
+// invitation must have been sent to the principal's email address.
+func (s *WorkspaceService) AcceptInvitation(ctx context.Context, principal *models.Principal, token string) (*models.Workspace, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		invitationID string
+		workspaceID  string
+		email        string
+		role         models.Role
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, workspace_id, email, role FROM workspace_invitations
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > $2
+	`, hashToken(token), time.Now().UTC()).Scan(&invitationID, &workspaceID, &email, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load invitation: %w", err)
+	}
+	if !strings.EqualFold(email, principal.Email) {
+		return nil, ErrInvitationNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, $3)
+	`, workspaceID, principal.UserID, string(role))
+	if database.IsUniqueViolation(err) {
+		return nil, ErrAlreadyMember
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to add member: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE workspace_invitations SET accepted_at = $1 WHERE id = $2
+	`, time.Now().UTC(), invitationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	workspace, err := getWorkspaceTx(ctx, tx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = audit.Record(ctx, tx, principal, audit.Event{
+		WorkspaceID: workspaceID,
+		Action:      models.AuditInvitationAccept,
+		TargetType:  "member",
+		TargetID:    principal.UserID,
+		After:       memberSnapshot{Role: role, InvitationID: invitationID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit invitation: %w", err)
+	}
+
+	workspace.Role = role
+	return workspace, nil
+}
+
+// Helper methods
+
+// workspaceColumns lists the workspaces columns read by scanWorkspace, in
+// scan order; queries alias the table as w
+const workspaceColumns = `w.id, w.name, w.slug, COALESCE(w.domain, ''), w.plan, COALESCE(CAST(w.created_by AS TEXT), ''), w.created_at, w.updated_at`
+
+func scanWorkspace(row store.RowScanner, workspace *models.Workspace, extra ...interface{}) error {
+	dest := []interface{}{
+		&workspace.ID,
+		&workspace.Name,
+		&workspace.Slug,
+		&workspace.Domain,
+		&workspace.Plan,
+		&workspace.CreatedBy,
+		&workspace.CreatedAt,
+		&workspace.UpdatedAt,
+	}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// memberSnapshot is the audited state of a workspace membership
+type memberSnapshot struct {
+	Role         models.Role `json:"role"`
+	InvitationID string      `json:"invitation_id,omitempty"`
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func getWorkspaceTx(ctx context.Context, q queryer, workspaceID string) (*models.Workspace, error) {
+	var workspace models.Workspace
+	err := scanWorkspace(q.QueryRowContext(ctx, `
+		SELECT `+workspaceColumns+` FROM workspaces w WHERE w.id = $1
+	`, workspaceID), &workspace)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workspace: %w", err)
+	}
+	return &workspace, nil
+}
+
+// requireRole loads the principal's role in a workspace and checks that it
+// grants perm. Non-members get ErrWorkspaceNotFound.
+func (s *WorkspaceService) requireRole(ctx context.Context, principal *models.Principal, workspaceID string, perm models.Permission) (models.Role, error) {
+	role, err := s.memberRole(ctx, workspaceID, principal.UserID)
+	if err != nil {
+		return "", err
+	}
+	if !role.Can(perm) {
+		return "", ErrForbidden
+	}
+	return role, nil
+}
+
+func (s *WorkspaceService) memberRole(ctx context.Context, workspaceID, userID string) (models.Role, error) {
+	role, err := memberRoleTx(ctx, s.db, workspaceID, userID)
+	if errors.Is(err, ErrMemberNotFound) {
+		return "", ErrWorkspaceNotFound
+	}
+	return role, err
+}
+
+func memberRoleTx(ctx context.Context, q queryer, workspaceID, userID string) (models.Role, error) {
+	if _, err := uuid.Parse(workspaceID); err != nil {
+		return "", ErrMemberNotFound
+	}
+	if _, err := uuid.Parse(userID); err != nil {
+		return "", ErrMemberNotFound
+	}
+
+	var role models.Role
+	err := q.QueryRowContext(ctx, `
+		SELECT role FROM workspace_members WHERE workspace_id = $1 AND user_id = $2
+	`, workspaceID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrMemberNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load membership: %w", err)
+	}
+	return role, nil
+}
+
+// ensureAnotherOwner fails with ErrLastOwner unless the workspace has at
+// least two owners
+func ensureAnotherOwner(ctx context.Context, q queryer, workspaceID string) error {
+	var owners int
+	err := q.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM workspace_members WHERE workspace_id = $1 AND role = $2
+	`, workspaceID, string(models.RoleOwner)).Scan(&owners)
+	if err != nil {
+		return fmt.Errorf("failed to count owners: %w", err)
+	}
+	if owners < 2 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// defaultWorkspaceID returns the user's oldest workspace, creating a personal
+// workspace for users that have none. Links and API keys created before
+// workspaces existed are moved into the personal workspace.
+func (s *WorkspaceService) defaultWorkspaceID(ctx context.Context, userID string) (string, error) {
+	workspaceID, err := s.oldestMembership(ctx, userID)
+	if err == nil {
+		return workspaceID, nil
+	}
+	if !errors.Is(err, ErrWorkspaceNotFound) {
+		return "", err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The slug is derived from the user ID so concurrent first requests
+	// cannot create two personal workspaces
+	workspace, err := insertWorkspace(ctx, tx, "Personal", "personal-"+strings.ReplaceAll(userID, "-", ""), "", userID)
+	if errors.Is(err, ErrInvalidWorkspace) {
+		// Another request created it first
+		tx.Rollback()
+		return s.oldestMembership(ctx, userID)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	backfills := []string{
+		`UPDATE urls SET workspace_id = $1 WHERE created_by = $2 AND workspace_id IS NULL`,
+		`UPDATE api_keys SET workspace_id = $1 WHERE user_id = $2 AND workspace_id IS NULL`,
+	}
+	for _, backfill := range backfills {
+		if _, err := tx.ExecContext(ctx, backfill, workspace.ID, userID); err != nil {
+			return "", fmt.Errorf("failed to move legacy rows into workspace: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit workspace: %w", err)
+	}
+	return workspace.ID, nil
+}
+
+func (s *WorkspaceService) oldestMembership(ctx context.Context, userID string) (string, error) {
+	var workspaceID string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT workspace_id FROM workspace_members WHERE user_id = $1
+		ORDER BY created_at LIMIT 1
+	`, userID).Scan(&workspaceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load default workspace: %w", err)
+	}
+	return workspaceID, nil
+}
+
+// insertWorkspace creates a workspace and makes ownerID its owner
+func insertWorkspace(ctx context.Context, tx *sql.Tx, name, slug, domain, ownerID string) (*models.Workspace, error) {
+	workspace := &models.Workspace{Name: name, Slug: slug, Domain: domain, Plan: models.PlanFree, CreatedBy: ownerID}
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO workspaces (name, slug, domain, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`, name, slug, nullString(domain), ownerID).Scan(&workspace.ID, &workspace.CreatedAt, &workspace.UpdatedAt)
+	if database.IsUniqueViolation(err) {
+		if domain != "" {
+			return nil, ErrDomainTaken
+		}
+		return nil, fmt.Errorf("%w: slug %q is taken", ErrInvalidWorkspace, slug)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, $3)
+	`, workspace.ID, ownerID, string(models.RoleOwner))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add workspace owner: %w", err)
+	}
+	return workspace, nil
+}
+
+// newSlug derives a URL-safe slug from a name with a random suffix
+func newSlug(name string) (string, error) {
+	base := strings.Trim(slugUnsafeChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(base) > 48 {
+		base = strings.TrimRight(base[:48], "-")
+	}
+	if base == "" {
+		base = "workspace"
+	}
+
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return base + "-" + hex.EncodeToString(suffix), nil
+}
+
+// normalizeDomain validates a custom short link domain; empty means none
+func normalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" {
+		return "", nil
+	}
+	if len(domain) > 253 || !domainPattern.MatchString(domain) {
+		return "", fmt.Errorf("%w: %q is not a valid domain", ErrInvalidWorkspace, domain)
+	}
+	return domain, nil
+}
+
+// nullString maps empty strings to SQL NULL, for nullable unique columns
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"linksprint/internal/cache"
+	"linksprint/internal/redis"
+)
+
+const (
+	// bloomFalsePositiveRate is the share of unknown short codes the filter
+	// lets through to the cache and database
+	bloomFalsePositiveRate = 0.01
+	// rebuildRetryDelay is how long to wait before rebuilding the filter
+	// again after a failure
+	rebuildRetryDelay = 10 * time.Second
+)
+
+// Filter rules out keys of links that do not exist, so lookups of unknown
+// short codes can be answered without querying the URLStore
+type Filter interface {
+	// MayExist reports false only for keys that are certainly not links
+	MayExist(ctx context.Context, key string) bool
+	// Add records a link key; it must succeed before the link is stored,
+	// or the link would be filtered out
+	Add(ctx context.Context, key string) error
+}
+
+// BloomFilter is a Filter of every link key, shared by all instances as a
+// Redis bitmap and mirrored in process. Members are never removed: deleted
+// links keep passing the filter, like the few unknown keys it lets through.
+//
+// Each instance rebuilds the filter from the URLStore on startup, and again
+// whenever the Redis bitmap was lost, merging it into Redis. Until then, and
+// whenever Redis fails, every key may exist.
+type BloomFilter struct {
+	urls  URLStore
+	redis *redis.Client
+	key   string
+
+	capacity   int
+	local      atomic.Pointer[cache.Bloom]
+	ready      atomic.Bool
+	rebuilding atomic.Bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewBloomFilter creates a filter sized for capacity links and starts
+// building it from urls in the background. Close stops building.
+func NewBloomFilter(urls URLStore, redis *redis.Client, capacity int) *BloomFilter {
+	local := cache.NewBloom(capacity, bloomFalsePositiveRate)
+	f := &BloomFilter{
+		urls:     urls,
+		redis:    redis,
+		capacity: capacity,
+		// The size is part of the key, so resized filters start afresh
+		key: fmt.Sprintf("bloom:{links}:%d:%d", local.Size(), local.Hashes()),
+	}
+	f.local.Store(local)
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+	f.startRebuild()
+	return f
+}
+
+// MayExist implements Filter. Keys missing from the local filter are looked
+// up in Redis, where other instances add the links they create.
+func (f *BloomFilter) MayExist(ctx context.Context, key string) bool {
+	if !f.ready.Load() {
+		return true
+	}
+	local := f.local.Load()
+	if local.Test(key) {
+		return true
+	}
+
+	positions := local.Positions(key)
+	found, err := f.redis.BloomTest(ctx, f.key, positions)
+	if errors.Is(err, redis.ErrBloomNotReady) {
+		f.ready.Store(false)
+		f.startRebuild()
+		return true
+	}
+	if err != nil {
+		return true
+	}
+	if found {
+		local.Set(positions)
+	}
+	return found
+}
+
+// Add implements Filter
+func (f *BloomFilter) Add(ctx context.Context, key string) error {
+	local := f.local.Load()
+	local.Add(key)
+	if err := f.redis.BloomAdd(ctx, f.key, local.Positions(key)); err != nil {
+		return fmt.Errorf("failed to add link to filter: %w", err)
+	}
+	return nil
+}
+
+// Ready reports whether the filter was built and rules out keys
+func (f *BloomFilter) Ready() bool {
+	return f.ready.Load()
+}
+
+// Close stops building the filter
+func (f *BloomFilter) Close() {
+	f.cancel()
+	f.wg.Wait()
+}
+
+// startRebuild rebuilds the filter in the background unless it already is
+// being rebuilt, retrying until it succeeds or the filter is closed
+func (f *BloomFilter) startRebuild() {
+	if !f.rebuilding.CompareAndSwap(false, true) {
+		return
+	}
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		defer f.rebuilding.Store(false)
+		for {
+			err := f.rebuild(f.ctx)
+			if err == nil {
+				return
+			}
+			logger.Warn("failed to build link filter", slog.Any("error", err))
+			select {
+			case <-f.ctx.Done():
+				return
+			case <-time.After(rebuildRetryDelay):
+			}
+		}
+	}()
+}
+
+// rebuild adds every active link to a fresh filter and merges it into the
+// Redis bitmap. Links added meanwhile are kept: they are set in Redis and
+// carried over from the previous local filter.
+func (f *BloomFilter) rebuild(ctx context.Context) error {
+	start := time.Now()
+	fresh := cache.NewBloom(f.capacity, bloomFalsePositiveRate)
+	links := 0
+	err := f.urls.ForEachShortCode(ctx, func(domain, shortCode string) error {
+		fresh.Add(LinkKey(domain, shortCode))
+		links++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fresh.Merge(f.local.Load())
+	f.local.Store(fresh)
+	if err := f.redis.BloomMerge(ctx, f.key, fresh.Bytes()); err != nil {
+		return fmt.Errorf("failed to store link filter: %w", err)
+	}
+	f.ready.Store(true)
+
+	logger.Info("link filter built", slog.Int("links", links), slog.Duration("duration", time.Since(start)))
+	return nil
+}
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"linksprint/internal/metrics"
+	"linksprint/internal/redis"
+)
+
+var (
+	// ErrCacheMiss is returned by Cache.GetURL for links that are not cached
+	ErrCacheMiss = errors.New("cache miss")
+	// ErrCachedNotFound is returned by Cache.GetURL for keys cached as
+	// resolving to no link
+	ErrCachedNotFound = errors.New("cached as not found")
+)
+
+// CachedURL is a link record held by a Cache
+type CachedURL struct {
+	LinkRecord
+	// FreshFor is how long the entry stays fresh, or 0 if it does not
+	// expire
+	FreshFor time.Duration
+	// Stale is set on entries past their TTL, which are kept for a while to
+	// be served while the link is looked up again
+	Stale bool
+}
+
+// ClickFlush holds the clicks a Cache took for a flush
+type ClickFlush = redis.ClickFlush
+
+// Cache holds link records in front of the URLStore, counts clicks until
+// they are flushed to the ClickStore, and keeps the visitors of links per
+// day. Keys identify a link by domain and short code; click counts and
+// visitors are kept by link ID.
+type Cache interface {
+	// GetURL returns the cached record of a link, or ErrCacheMiss, or
+	// ErrCachedNotFound
+	GetURL(ctx context.Context, key string) (CachedURL, error)
+	// SetURL caches the record of a link, never past the link's expiry
+	SetURL(ctx context.Context, key string, record LinkRecord) error
+	// SetNotFound caches for ttl that a key resolves to no link, sparing
+	// the URLStore repeated lookups of unknown short codes
+	SetNotFound(ctx context.Context, key string, ttl time.Duration) error
+	// DeleteURL evicts a link so the next lookup goes to the URLStore
+	DeleteURL(ctx context.Context, key string) error
+
+	// IncrementClicks counts a click on a link, stored at recordedAt, until
+	// it is flushed
+	IncrementClicks(ctx context.Context, urlID string, recordedAt time.Time) error
+	// PendingClicks returns the clicks counted on a link and not flushed
+	// yet, or 0
+	PendingClicks(ctx context.Context, urlID string) (int64, error)
+	// TakePendingClicks moves the pending clicks of every link stored
+	// before before to flush flushID and returns them, by link ID, dropping
+	// those stored before drop. Times are truncated to the minute. The
+	// clicks of a flush are kept until DropFlushedClicks.
+	TakePendingClicks(ctx context.Context, flushID string, before, drop time.Time) (map[string]int64, error)
+	// UnflushedClicks returns the flushes taken and not dropped yet, by
+	// flush ID
+	UnflushedClicks(ctx context.Context) (map[string]ClickFlush, error)
+	// DropFlushedClicks drops the clicks of flush flushID once they are
+	// stored
+	DropFlushedClicks(ctx context.Context, flushID string) error
+
+	// AddVisitors adds visitors to the visitors of a link on the UTC day
+	// of t
+	AddVisitors(ctx context.Context, urlID string, t time.Time, visitorIDs ...string) error
+	// CountVisitors counts the distinct visitors of a link over the UTC
+	// days from from to to, both included
+	CountVisitors(ctx context.Context, urlID string, from, to time.Time) (int64, error)
+}
+
+// LinkKey identifies a link in cache keys; links on the default domain keep
+// the bare short code
+func LinkKey(domain, shortCode string) string {
+	if domain == "" {
+		return shortCode
+	}
+	return domain + "/" + shortCode
+}
+
+// RedisCache is the Cache shared by all instances, kept in Redis
+type RedisCache struct {
+	redis *redis.Client
+}
+
+// NewRedisCache creates a cache on a Redis client
+func NewRedisCache(redis *redis.Client) *RedisCache {
+	return &RedisCache{redis: redis}
+}
+
+// GetURL implements Cache
+func (c *RedisCache) GetURL(ctx context.Context, key string) (CachedURL, error) {
+	entry, _, err := c.getURL(ctx, key)
+	if err != nil {
+		return CachedURL{}, err
+	}
+	return entry.cached(), nil
+}
+
+// getURL looks a link up in Redis and also returns how long its key is kept
+func (c *RedisCache) getURL(ctx context.Context, key string) (cacheEntry, time.Duration, error) {
+	var entry cacheEntry
+	value, remaining, err := c.redis.GetURLWithTTL(ctx, key)
+	switch {
+	case redis.IsNil(err):
+		err = ErrCacheMiss
+	case err != nil:
+	case value == "":
+		err = ErrCachedNotFound
+	case json.Unmarshal([]byte(value), &entry) != nil:
+		// Entries written in another format are replaced on the next lookup
+		err = ErrCacheMiss
+	case remaining > 0:
+		// Freshness follows the TTL of the key, so every instance agrees
+		// on it whatever its clock
+		entry.freshUntil = time.Now().Add(remaining - entry.StaleFor)
+	}
+	countLookup(metrics.CacheTierRedis, err)
+	return entry, remaining, err
+}
+
+// SetURL implements Cache
+func (c *RedisCache) SetURL(ctx context.Context, key string, record LinkRecord) error {
+	_, _, err := c.setURL(ctx, key, record)
+	return err
+}
+
+// setURL caches a link record in Redis and returns the entry with how long
+// it is kept, 0 for links that already expired and are not cached
+func (c *RedisCache) setURL(ctx context.Context, key string, record LinkRecord) (cacheEntry, time.Duration, error) {
+	entry, keep := c.newEntry(record, time.Now())
+	if keep <= 0 {
+		return entry, 0, nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return entry, 0, err
+	}
+	return entry, keep, c.redis.SetURL(ctx, key, string(data), keep)
+}
+
+// newEntry returns the cache entry of a link record with how long it is
+// kept: fresh for the URL TTL, then stale for the stale TTL, but neither
+// past the link's expiry
+func (c *RedisCache) newEntry(record LinkRecord, now time.Time) (cacheEntry, time.Duration) {
+	ttl, staleTTL := c.redis.URLCacheTTLs()
+	keep := ttl + staleTTL
+	if record.ExpiresAt != nil {
+		keep = min(keep, record.ExpiresAt.Sub(now))
+	}
+	entry := cacheEntry{LinkRecord: record, StaleFor: keep - min(ttl, keep)}
+	entry.freshUntil = now.Add(keep - entry.StaleFor)
+	return entry, keep
+}
+
+// cacheEntry is a link record as cached
+type cacheEntry struct {
+	LinkRecord
+	// StaleFor is how long the entry is kept once it is no longer fresh
+	StaleFor time.Duration `json:"stale_for"`
+	// freshUntil is when the entry stops being fresh, zero for entries
+	// that do not expire
+	freshUntil time.Time
+}
+
+// cached returns the entry as found in the cache
+func (e *cacheEntry) cached() CachedURL {
+	entry := CachedURL{LinkRecord: e.LinkRecord}
+	if e.freshUntil.IsZero() {
+		return entry
+	}
+	entry.FreshFor = time.Until(e.freshUntil)
+	if entry.FreshFor <= 0 {
+		entry.FreshFor, entry.Stale = 0, true
+	}
+	return entry
+}
+
+// SetNotFound implements Cache
+func (c *RedisCache) SetNotFound(ctx context.Context, key string, ttl time.Duration) error {
+	return c.redis.SetURLNotFound(ctx, key, ttl)
+}
+
+// DeleteURL implements Cache
+func (c *RedisCache) DeleteURL(ctx context.Context, key string) error {
+	return c.redis.Delete(ctx, "url:"+key)
+}
+
+// IncrementClicks implements Cache
+func (c *RedisCache) IncrementClicks(ctx context.Context, urlID string, recordedAt time.Time) error {
+	return c.redis.IncrementPendingClicks(ctx, urlID, recordedAt)
+}
+
+// PendingClicks implements Cache
+func (c *RedisCache) PendingClicks(ctx context.Context, urlID string) (int64, error) {
+	return c.redis.GetPendingClicks(ctx, urlID)
+}
+
+// TakePendingClicks implements Cache
+func (c *RedisCache) TakePendingClicks(ctx context.Context, flushID string, before, drop time.Time) (map[string]int64, error) {
+	return c.redis.TakePendingClicks(ctx, flushID, before, drop)
+}
+
+// UnflushedClicks implements Cache
+func (c *RedisCache) UnflushedClicks(ctx context.Context) (map[string]ClickFlush, error) {
+	return c.redis.UnflushedClicks(ctx)
+}
+
+// DropFlushedClicks implements Cache
+func (c *RedisCache) DropFlushedClicks(ctx context.Context, flushID string) error {
+	return c.redis.DropFlushedClicks(ctx, flushID)
+}
+
+// AddVisitors implements Cache
+func (c *RedisCache) AddVisitors(ctx context.Context, urlID string, t time.Time, visitorIDs ...string) error {
+	return c.redis.AddVisitors(ctx, urlID, t, visitorIDs...)
+}
+
+// CountVisitors implements Cache; visitors are counted with HyperLogLogs,
+// within about 1%, and kept for 400 days
+func (c *RedisCache) CountVisitors(ctx context.Context, urlID string, from, to time.Time) (int64, error) {
+	return c.redis.CountVisitors(ctx, urlID, from, to)
+}
+
+// countLookup records the result of a lookup in a cache tier
+func countLookup(tier string, err error) {
+	result := metrics.CacheHit
+	switch {
+	case errors.Is(err, ErrCacheMiss):
+		result = metrics.CacheMiss
+	case errors.Is(err, ErrCachedNotFound):
+		result = metrics.CacheNegative
+	case err != nil:
+		result = metrics.CacheError
+	}
+	metrics.CacheLookups.WithLabelValues(tier, result).Inc()
+}
@@ -0,0 +1,677 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"linksprint/internal/models"
+	"linksprint/internal/pagination"
+
+	"github.com/google/uuid"
+)
+
+// Memory stores links and clicks in process, for tests and tools that run
+// without a database. It is safe for concurrent use. Workspaces have no
+// custom domain and are metered on the free plan, and no audit events are
+// recorded.
+type Memory struct {
+	mu sync.RWMutex
+	// urls holds every link ever created, deleted ones included, in
+	// creation order
+	urls   []*models.URL
+	clicks []models.Analytics
+	// clickCounters holds the flushed click totals by link ID
+	clickCounters map[string]int64
+	// flushes holds the IDs of the click counter flushes added
+	flushes map[string]struct{}
+	// countedUntil is the time before which the click counters count every
+	// click stored
+	countedUntil time.Time
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{clickCounters: make(map[string]int64), flushes: make(map[string]struct{})}
+}
+
+// CreateURL implements URLStore
+func (m *Memory) CreateURL(ctx context.Context, principal *models.Principal, url *models.URL) (*models.URL, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.urls {
+		if existing.Domain == url.Domain && existing.ShortCode == url.ShortCode {
+			return nil, ErrConflict
+		}
+	}
+
+	now := time.Now().UTC()
+	created := *url
+	created.ID = uuid.NewString()
+	created.ExpiresAt = utc(url.ExpiresAt)
+	created.CreatedAt = now
+	created.UpdatedAt = now
+	created.IsActive = true
+	created.RedirectType = redirectType(url)
+	m.urls = append(m.urls, &created)
+
+	copied := created
+	return &copied, nil
+}
+
+// GetURL implements URLStore
+func (m *Memory) GetURL(ctx context.Context, workspaceID, shortCode string) (*models.URL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	url := m.workspaceURL(workspaceID, shortCode)
+	if url == nil {
+		return nil, ErrNotFound
+	}
+	copied := *url
+	return &copied, nil
+}
+
+// workspaceURL returns the newest active link shortCode of a workspace, or
+// nil. The caller holds the lock.
+func (m *Memory) workspaceURL(workspaceID, shortCode string) *models.URL {
+	for i := len(m.urls) - 1; i >= 0; i-- {
+		url := m.urls[i]
+		if url.WorkspaceID == workspaceID && url.ShortCode == shortCode && url.IsActive {
+			return url
+		}
+	}
+	return nil
+}
+
+// UpdateURL implements URLStore
+func (m *Memory) UpdateURL(ctx context.Context, principal *models.Principal, shortCode string, update func(url *models.URL)) (*models.URL, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	url := m.workspaceURL(principal.WorkspaceID, shortCode)
+	if url == nil {
+		return nil, ErrNotFound
+	}
+	updated := *url
+	update(&updated)
+	updated.ExpiresAt = utc(updated.ExpiresAt)
+	updated.UpdatedAt = time.Now().UTC()
+	*url = updated
+
+	return &updated, nil
+}
+
+// DeleteURL implements URLStore
+func (m *Memory) DeleteURL(ctx context.Context, principal *models.Principal, shortCode string) (*models.URL, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	url := m.workspaceURL(principal.WorkspaceID, shortCode)
+	if url == nil {
+		return nil, ErrNotFound
+	}
+	deleted := *url
+	url.IsActive = false
+	url.UpdatedAt = time.Now().UTC()
+
+	return &deleted, nil
+}
+
+// ResolveURL implements URLStore
+func (m *Memory) ResolveURL(ctx context.Context, domain, shortCode string) (*LinkRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, url := range m.urls {
+		if url.Domain == domain && url.ShortCode == shortCode {
+			record := NewLinkRecord(url)
+			return &record, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ShortCodeExists implements URLStore
+func (m *Memory) ShortCodeExists(ctx context.Context, domain, shortCode string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, url := range m.urls {
+		if url.Domain == domain && url.ShortCode == shortCode {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ForEachShortCode implements URLStore
+func (m *Memory) ForEachShortCode(ctx context.Context, fn func(domain, shortCode string) error) error {
+	m.mu.RLock()
+	var links []models.URL
+	for _, url := range m.urls {
+		if url.IsActive {
+			links = append(links, *url)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, url := range links {
+		if err := fn(url.Domain, url.ShortCode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WorkspaceDomain implements URLStore
+func (m *Memory) WorkspaceDomain(ctx context.Context, workspaceID string) (string, error) {
+	return "", nil
+}
+
+// CountURLs implements URLStore
+func (m *Memory) CountURLs(ctx context.Context, workspaceID string, createdSince time.Time) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var total int64
+	for _, url := range m.urls {
+		if url.WorkspaceID == workspaceID && url.IsActive && !url.CreatedAt.Before(createdSince) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+// ListURLs implements URLStore
+func (m *Memory) ListURLs(ctx context.Context, workspaceID string, offset, limit int) ([]models.URL, error) {
+	urls, err := m.ListURLsAfter(ctx, workspaceID, nil, offset+limit)
+	if err != nil || offset >= len(urls) {
+		return []models.URL{}, err
+	}
+	return urls[offset:], nil
+}
+
+// ListURLsAfter implements URLStore
+func (m *Memory) ListURLsAfter(ctx context.Context, workspaceID string, after *pagination.Cursor, limit int) ([]models.URL, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	urls := []models.URL{}
+	for _, url := range m.urls {
+		if url.WorkspaceID == workspaceID && url.IsActive && before(url.CreatedAt, url.ID, after) {
+			urls = append(urls, *url)
+		}
+	}
+	sort.Slice(urls, func(i, j int) bool {
+		return newer(urls[i].CreatedAt, urls[i].ID, urls[j].CreatedAt, urls[j].ID)
+	})
+	if len(urls) > limit {
+		urls = urls[:limit]
+	}
+	return urls, nil
+}
+
+// ClickTarget implements ClickStore
+func (m *Memory) ClickTarget(ctx context.Context, domain, shortCode string) (*ClickTarget, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, url := range m.urls {
+		if url.Domain == domain && url.ShortCode == shortCode && url.IsActive {
+			return &ClickTarget{URLID: url.ID, WorkspaceID: url.WorkspaceID, Plan: models.PlanFree}, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// InsertClick implements ClickStore
+func (m *Memory) InsertClick(ctx context.Context, click *models.Analytics) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	click.RecordedAt = time.Now().UTC()
+	stored := *click
+	stored.ID = uuid.NewString()
+	stored.ClickedAt = click.ClickedAt.UTC()
+	m.clicks = append(m.clicks, stored)
+	return nil
+}
+
+// eachClick passes the clicks of a link to fn. The caller holds the lock.
+func (m *Memory) eachClick(urlID string, fn func(click *models.Analytics)) {
+	for i := range m.clicks {
+		if m.clicks[i].URLID == urlID {
+			fn(&m.clicks[i])
+		}
+	}
+}
+
+// CountClicks implements ClickStore
+func (m *Memory) CountClicks(ctx context.Context, urlID string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var total int64
+	m.eachClick(urlID, func(*models.Analytics) { total++ })
+	return total, nil
+}
+
+// LastClickedAt implements ClickStore
+func (m *Memory) LastClickedAt(ctx context.Context, urlID string) (*time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var last *time.Time
+	m.eachClick(urlID, func(click *models.Analytics) {
+		if last == nil || click.ClickedAt.After(*last) {
+			clickedAt := click.ClickedAt
+			last = &clickedAt
+		}
+	})
+	return last, nil
+}
+
+// TopValues implements ClickStore
+func (m *Memory) TopValues(ctx context.Context, urlID, dimension string, limit int) ([]ValueCount, error) {
+	field, ok := memoryDimensions[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown click dimension %q", dimension)
+	}
+	var values []ValueCount
+	m.topValues(urlID, limit, field, func(value string, count int64) {
+		values = append(values, ValueCount{Value: value, Count: count})
+	})
+	return values, nil
+}
+
+// memoryDimensions returns the value of each dimension for a click
+var memoryDimensions = map[string]func(click *models.Analytics) string{
+	DimensionTotal:   func(*models.Analytics) string { return "" },
+	DimensionCountry: func(click *models.Analytics) string { return click.Country },
+	DimensionCity:    func(click *models.Analytics) string { return click.City },
+	DimensionReferer: func(click *models.Analytics) string { return click.RefererDomain },
+	DimensionDevice:  func(click *models.Analytics) string { return click.Device },
+	DimensionBrowser: func(click *models.Analytics) string { return click.Browser },
+}
+
+// topValues passes the most frequent non-empty values of a click field for
+// a link to add, most frequent first
+func (m *Memory) topValues(urlID string, limit int, field func(click *models.Analytics) string, add func(value string, count int64)) {
+	m.mu.RLock()
+	counts := make(map[string]int64)
+	m.eachClick(urlID, func(click *models.Analytics) {
+		if value := field(click); value != "" {
+			counts[value]++
+		}
+	})
+	m.mu.RUnlock()
+
+	values := make([]string, 0, len(counts))
+	for value := range counts {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if counts[values[i]] != counts[values[j]] {
+			return counts[values[i]] > counts[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	if len(values) > limit {
+		values = values[:limit]
+	}
+	for _, value := range values {
+		add(value, counts[value])
+	}
+}
+
+// ClickCounts implements ClickStore
+func (m *Memory) ClickCounts(ctx context.Context, urlID string, from, to time.Time, step time.Duration) ([]TimeCount, error) {
+	if step != time.Minute && step != time.Hour {
+		return nil, fmt.Errorf("unsupported click count step %s", step)
+	}
+	m.mu.RLock()
+	counts := make(map[time.Time]int64)
+	m.eachClick(urlID, func(click *models.Analytics) {
+		if !click.ClickedAt.Before(from) && click.ClickedAt.Before(to) {
+			counts[click.ClickedAt.UTC().Truncate(step)]++
+		}
+	})
+	m.mu.RUnlock()
+
+	var result []TimeCount
+	for t, count := range counts {
+		result = append(result, TimeCount{Time: t, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	return result, nil
+}
+
+// DailyVisitors implements ClickStore
+func (m *Memory) DailyVisitors(ctx context.Context, fn func(urlID string, day time.Time, visitorIDs []string) error) error {
+	type linkDay struct {
+		urlID string
+		day   time.Time
+	}
+	m.mu.RLock()
+	visitors := make(map[linkDay]map[string]struct{})
+	for i := range m.clicks {
+		click := &m.clicks[i]
+		if click.VisitorID == "" {
+			continue
+		}
+		key := linkDay{click.URLID, click.ClickedAt.UTC().Truncate(24 * time.Hour)}
+		if visitors[key] == nil {
+			visitors[key] = make(map[string]struct{})
+		}
+		visitors[key][click.VisitorID] = struct{}{}
+	}
+	m.mu.RUnlock()
+
+	for key, ids := range visitors {
+		visitorIDs := make([]string, 0, len(ids))
+		for id := range ids {
+			visitorIDs = append(visitorIDs, id)
+		}
+		if err := fn(key.urlID, key.day, visitorIDs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollUpNextHour implements ClickStore; Memory aggregates the clicks
+// themselves on every read, so there is nothing to roll up
+func (m *Memory) RollUpNextHour(ctx context.Context, delay time.Duration) (bool, error) {
+	return false, nil
+}
+
+// ListClicks implements ClickStore
+func (m *Memory) ListClicks(ctx context.Context, urlID string, after *pagination.Cursor, limit int) ([]models.Analytics, error) {
+	m.mu.RLock()
+	clicks := []models.Analytics{}
+	m.eachClick(urlID, func(click *models.Analytics) {
+		if before(click.ClickedAt, click.ID, after) {
+			clicks = append(clicks, *click)
+		}
+	})
+	m.mu.RUnlock()
+
+	sort.Slice(clicks, func(i, j int) bool {
+		return newer(clicks[i].ClickedAt, clicks[i].ID, clicks[j].ClickedAt, clicks[j].ID)
+	})
+	if len(clicks) > limit {
+		clicks = clicks[:limit]
+	}
+	return clicks, nil
+}
+
+// CountWorkspaceClicks implements ClickStore
+func (m *Memory) CountWorkspaceClicks(ctx context.Context, workspaceID string, since time.Time) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	urlIDs := make(map[string]bool)
+	for _, url := range m.urls {
+		if url.WorkspaceID == workspaceID {
+			urlIDs[url.ID] = true
+		}
+	}
+
+	var total int64
+	for _, click := range m.clicks {
+		if urlIDs[click.URLID] && !click.ClickedAt.Before(since.UTC().Truncate(24*time.Hour)) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+// newer orders rows by (timestamp, id) descending, as the SQL listings do
+func newer(t1 time.Time, id1 string, t2 time.Time, id2 string) bool {
+	if !t1.Equal(t2) {
+		return t1.After(t2)
+	}
+	return id1 > id2
+}
+
+// before reports whether a row comes after the cursor in a listing newest
+// first, which every row does without a cursor
+func before(t time.Time, id string, after *pagination.Cursor) bool {
+	return after == nil || newer(after.Time, after.ID, t, id)
+}
+
+// FlushClickCounters implements ClickStore; flush IDs are kept forever
+func (m *Memory) FlushClickCounters(ctx context.Context, delay time.Duration, take func(before, countedUntil time.Time) (map[string]map[string]int64, error)) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	flushes, err := take(time.Now().UTC().Add(-delay).Truncate(time.Minute), m.countedUntil)
+	if err != nil {
+		return 0, err
+	}
+	var added int64
+	for flushID, counts := range flushes {
+		if _, ok := m.flushes[flushID]; ok {
+			continue
+		}
+		m.flushes[flushID] = struct{}{}
+		for _, url := range m.urls {
+			m.clickCounters[url.ID] += counts[url.ID]
+			added += counts[url.ID]
+		}
+	}
+	return added, nil
+}
+
+// ClickCounter implements ClickStore
+func (m *Memory) ClickCounter(ctx context.Context, urlID string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.clickCounters[urlID], nil
+}
+
+// RebuildClickCounters implements ClickStore
+func (m *Memory) RebuildClickCounters(ctx context.Context, delay time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if before := time.Now().UTC().Add(-delay).Truncate(time.Minute); before.After(m.countedUntil) {
+		m.countedUntil = before
+	}
+	m.clickCounters = make(map[string]int64)
+	for _, click := range m.clicks {
+		if click.RecordedAt.Before(m.countedUntil) {
+			m.clickCounters[click.URLID]++
+		}
+	}
+	return int64(len(m.clickCounters)), nil
+}
+
+// MemoryCache is a Cache kept in process. Entries do not expire; records
+// are still checked on every redirect, so expired links stop redirecting.
+// Keys and values are copied, since handlers pass strings backed by request
+// buffers that fiber reuses.
+type MemoryCache struct {
+	mu sync.Mutex
+	// urls holds nil for keys cached as not found
+	urls map[string]*LinkRecord
+	// clicks holds the pending clicks by minute they were stored in and
+	// link ID
+	clicks map[time.Time]map[string]int64
+	// flushes holds the clicks taken for flushes by flush ID
+	flushes map[string]ClickFlush
+	// visitors holds the visitors of links by link ID and UTC day
+	visitors map[string]map[time.Time]map[string]struct{}
+}
+
+// NewMemoryCache creates an empty in-memory cache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		urls:     make(map[string]*LinkRecord),
+		clicks:   make(map[time.Time]map[string]int64),
+		flushes:  make(map[string]ClickFlush),
+		visitors: make(map[string]map[time.Time]map[string]struct{}),
+	}
+}
+
+// GetURL implements Cache
+func (c *MemoryCache) GetURL(ctx context.Context, key string) (CachedURL, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	record, ok := c.urls[key]
+	if !ok {
+		return CachedURL{}, ErrCacheMiss
+	}
+	if record == nil {
+		return CachedURL{}, ErrCachedNotFound
+	}
+	return CachedURL{LinkRecord: *record}, nil
+}
+
+// SetURL implements Cache
+func (c *MemoryCache) SetURL(ctx context.Context, key string, record LinkRecord) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	record.OriginalURL = strings.Clone(record.OriginalURL)
+	c.urls[strings.Clone(key)] = &record
+	return nil
+}
+
+// SetNotFound implements Cache; the entry does not expire either
+func (c *MemoryCache) SetNotFound(ctx context.Context, key string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.urls[strings.Clone(key)] = nil
+	return nil
+}
+
+// DeleteURL implements Cache
+func (c *MemoryCache) DeleteURL(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.urls, key)
+	return nil
+}
+
+// IncrementClicks implements Cache
+func (c *MemoryCache) IncrementClicks(ctx context.Context, urlID string, recordedAt time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	minute := recordedAt.UTC().Truncate(time.Minute)
+	if c.clicks[minute] == nil {
+		c.clicks[minute] = make(map[string]int64)
+	}
+	if _, ok := c.clicks[minute][urlID]; !ok {
+		urlID = strings.Clone(urlID)
+	}
+	c.clicks[minute][urlID]++
+	return nil
+}
+
+// PendingClicks implements Cache
+func (c *MemoryCache) PendingClicks(ctx context.Context, urlID string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var pending int64
+	for _, counts := range c.clicks {
+		pending += counts[urlID]
+	}
+	return pending, nil
+}
+
+// TakePendingClicks implements Cache
+func (c *MemoryCache) TakePendingClicks(ctx context.Context, flushID string, before, drop time.Time) (map[string]int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	before, drop = before.UTC().Truncate(time.Minute), drop.UTC().Truncate(time.Minute)
+	taken := make(map[string]int64)
+	for minute, counts := range c.clicks {
+		if !minute.Before(before) {
+			continue
+		}
+		delete(c.clicks, minute)
+		if minute.Before(drop) {
+			continue
+		}
+		for urlID, count := range counts {
+			taken[urlID] += count
+		}
+	}
+	if len(taken) > 0 {
+		c.flushes[strings.Clone(flushID)] = ClickFlush{Before: before, Counts: taken}
+	}
+	return maps.Clone(taken), nil
+}
+
+// UnflushedClicks implements Cache
+func (c *MemoryCache) UnflushedClicks(ctx context.Context) (map[string]ClickFlush, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flushes := make(map[string]ClickFlush, len(c.flushes))
+	for flushID, flush := range c.flushes {
+		flushes[flushID] = ClickFlush{Before: flush.Before, Counts: maps.Clone(flush.Counts)}
+	}
+	return flushes, nil
+}
+
+// DropFlushedClicks implements Cache
+func (c *MemoryCache) DropFlushedClicks(ctx context.Context, flushID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.flushes, flushID)
+	return nil
+}
+
+// AddVisitors implements Cache
+func (c *MemoryCache) AddVisitors(ctx context.Context, urlID string, t time.Time, visitorIDs ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	days, ok := c.visitors[urlID]
+	if !ok {
+		days = make(map[time.Time]map[string]struct{})
+		c.visitors[strings.Clone(urlID)] = days
+	}
+	day := t.UTC().Truncate(24 * time.Hour)
+	if days[day] == nil {
+		days[day] = make(map[string]struct{})
+	}
+	for _, id := range visitorIDs {
+		days[day][strings.Clone(id)] = struct{}{}
+	}
+	return nil
+}
+
+// CountVisitors implements Cache; visitors are counted exactly
+func (c *MemoryCache) CountVisitors(ctx context.Context, urlID string, from, to time.Time) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	from, to = from.UTC().Truncate(24*time.Hour), to.UTC().Truncate(24*time.Hour)
+	distinct := make(map[string]struct{})
+	for day, visitors := range c.visitors[urlID] {
+		if day.Before(from) || day.After(to) {
+			continue
+		}
+		for id := range visitors {
+			distinct[id] = struct{}{}
+		}
+	}
+	return int64(len(distinct)), nil
+}
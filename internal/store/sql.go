@@ -0,0 +1,919 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"linksprint/internal/audit"
+	"linksprint/internal/database"
+	"linksprint/internal/models"
+	"linksprint/internal/pagination"
+)
+
+// SQL stores links and clicks in the database. Queries are written in the
+// SQL CockroachDB, PostgreSQL and SQLite share; timestamps are bound in UTC
+// so they compare correctly on SQLite, where they are text.
+type SQL struct {
+	db *database.DB
+}
+
+// NewSQL creates a store on db
+func NewSQL(db *database.DB) *SQL {
+	return &SQL{db: db}
+}
+
+// urlColumns lists the urls columns read by scanURL, in scan order
+const urlColumns = `id, short_code, original_url, COALESCE(title, ''), COALESCE(description, ''),
+	created_at, updated_at, COALESCE(created_by, ''), COALESCE(CAST(workspace_id AS TEXT), ''), domain,
+	is_active, expires_at, redirect_type`
+
+// clickColumns lists the analytics columns read by scanClick, in scan order
+const clickColumns = `id, url_id, short_code, COALESCE(host(ip_address), ''), COALESCE(user_agent, ''),
+	COALESCE(referer, ''), COALESCE(country, ''), COALESCE(city, ''), COALESCE(referer_domain, ''),
+	COALESCE(device, ''), COALESCE(browser, ''), COALESCE(visitor_id, ''), clicked_at`
+
+// RowScanner is satisfied by both *sql.Row and *sql.Rows
+type RowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryer is satisfied by both *database.DB and *sql.Tx
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func scanURL(row RowScanner, url *models.URL) error {
+	return row.Scan(
+		&url.ID,
+		&url.ShortCode,
+		&url.OriginalURL,
+		&url.Title,
+		&url.Description,
+		&url.CreatedAt,
+		&url.UpdatedAt,
+		&url.CreatedBy,
+		&url.WorkspaceID,
+		&url.Domain,
+		&url.IsActive,
+		&url.ExpiresAt,
+		&url.RedirectType,
+	)
+}
+
+func scanClick(row RowScanner, click *models.Analytics) error {
+	return row.Scan(
+		&click.ID,
+		&click.URLID,
+		&click.ShortCode,
+		&click.IPAddress,
+		&click.UserAgent,
+		&click.Referer,
+		&click.Country,
+		&click.City,
+		&click.RefererDomain,
+		&click.Device,
+		&click.Browser,
+		&click.VisitorID,
+		&click.ClickedAt,
+	)
+}
+
+// CreateURL implements URLStore
+func (s *SQL) CreateURL(ctx context.Context, principal *models.Principal, url *models.URL) (*models.URL, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var created models.URL
+	err = scanURL(tx.QueryRowContext(ctx, `
+		INSERT INTO urls (short_code, original_url, title, description, expires_at, created_by, workspace_id, domain, redirect_type)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+urlColumns+`
+	`, url.ShortCode, url.OriginalURL, url.Title, url.Description, utc(url.ExpiresAt), url.CreatedBy, url.WorkspaceID, url.Domain, redirectType(url)), &created)
+	if database.IsUniqueViolation(err) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create URL in database: %w", err)
+	}
+
+	err = audit.Record(ctx, tx, principal, audit.Event{
+		Action:     models.AuditLinkCreate,
+		TargetType: "link",
+		TargetID:   created.ID,
+		After:      &created,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit URL: %w", err)
+	}
+	return &created, nil
+}
+
+// GetURL implements URLStore
+func (s *SQL) GetURL(ctx context.Context, workspaceID, shortCode string) (*models.URL, error) {
+	return getURL(ctx, s.db, workspaceID, shortCode)
+}
+
+func getURL(ctx context.Context, db queryer, workspaceID, shortCode string) (*models.URL, error) {
+	var url models.URL
+	err := scanURL(db.QueryRowContext(ctx, `
+		SELECT `+urlColumns+`
+		FROM urls WHERE workspace_id = $1 AND short_code = $2 AND is_active = true
+		ORDER BY created_at DESC LIMIT 1
+	`, workspaceID, shortCode), &url)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load URL: %w", err)
+	}
+	return &url, nil
+}
+
+// UpdateURL implements URLStore
+func (s *SQL) UpdateURL(ctx context.Context, principal *models.Principal, shortCode string, update func(url *models.URL)) (*models.URL, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, err := getURL(ctx, tx, principal.WorkspaceID, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	url := *before
+	update(&url)
+	url.UpdatedAt = time.Now().UTC()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE urls SET original_url = $1, title = $2, description = $3, expires_at = $4, redirect_type = $5, updated_at = $6
+		WHERE id = $7
+	`, url.OriginalURL, url.Title, url.Description, utc(url.ExpiresAt), url.RedirectType, url.UpdatedAt, url.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update URL: %w", err)
+	}
+
+	err = audit.Record(ctx, tx, principal, audit.Event{
+		Action:     models.AuditLinkUpdate,
+		TargetType: "link",
+		TargetID:   url.ID,
+		Before:     before,
+		After:      &url,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit URL: %w", err)
+	}
+	return &url, nil
+}
+
+// DeleteURL implements URLStore
+func (s *SQL) DeleteURL(ctx context.Context, principal *models.Principal, shortCode string) (*models.URL, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	url, err := getURL(ctx, tx, principal.WorkspaceID, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE urls SET is_active = false, updated_at = $1 WHERE id = $2
+	`, time.Now().UTC(), url.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete URL: %w", err)
+	}
+
+	err = audit.Record(ctx, tx, principal, audit.Event{
+		Action:     models.AuditLinkDelete,
+		TargetType: "link",
+		TargetID:   url.ID,
+		Before:     url,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit URL: %w", err)
+	}
+	return url, nil
+}
+
+// ResolveURL implements URLStore
+func (s *SQL) ResolveURL(ctx context.Context, domain, shortCode string) (*LinkRecord, error) {
+	var record LinkRecord
+	err := s.db.QueryRowContext(ctx, `
+		SELECT original_url, expires_at, is_active, redirect_type FROM urls
+		WHERE domain = $1 AND short_code = $2
+		ORDER BY is_active DESC, created_at DESC LIMIT 1
+	`, domain, shortCode).Scan(&record.OriginalURL, &record.ExpiresAt, &record.Active, &record.RedirectType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve URL: %w", err)
+	}
+	return &record, nil
+}
+
+// ShortCodeExists implements URLStore
+func (s *SQL) ShortCodeExists(ctx context.Context, domain, shortCode string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM urls WHERE domain = $1 AND short_code = $2)", domain, shortCode).Scan(&exists)
+	return exists, err
+}
+
+// ForEachShortCode implements URLStore
+func (s *SQL) ForEachShortCode(ctx context.Context, fn func(domain, shortCode string) error) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT domain, short_code FROM urls WHERE is_active = true")
+	if err != nil {
+		return fmt.Errorf("failed to query short codes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var domain, shortCode string
+		if err := rows.Scan(&domain, &shortCode); err != nil {
+			return fmt.Errorf("failed to scan short code: %w", err)
+		}
+		if err := fn(domain, shortCode); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// WorkspaceDomain implements URLStore
+func (s *SQL) WorkspaceDomain(ctx context.Context, workspaceID string) (string, error) {
+	var domain string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(domain, '') FROM workspaces WHERE id = $1
+	`, workspaceID).Scan(&domain)
+	if err != nil {
+		return "", fmt.Errorf("failed to load workspace domain: %w", err)
+	}
+	return domain, nil
+}
+
+// CountURLs implements URLStore
+func (s *SQL) CountURLs(ctx context.Context, workspaceID string, createdSince time.Time) (int64, error) {
+	query, args := "SELECT COUNT(*) FROM urls WHERE workspace_id = $1 AND is_active = true", []interface{}{workspaceID}
+	if !createdSince.IsZero() {
+		query, args = query+" AND created_at >= $2", append(args, createdSince.UTC())
+	}
+
+	var total int64
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&total)
+	return total, err
+}
+
+// ListURLs implements URLStore
+func (s *SQL) ListURLs(ctx context.Context, workspaceID string, offset, limit int) ([]models.URL, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+urlColumns+`
+		FROM urls
+		WHERE workspace_id = $1 AND is_active = true
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`, workspaceID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query URLs: %w", err)
+	}
+	return scanURLs(rows)
+}
+
+// ListURLsAfter implements URLStore
+func (s *SQL) ListURLsAfter(ctx context.Context, workspaceID string, after *pagination.Cursor, limit int) ([]models.URL, error) {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if after == nil {
+		rows, err = s.db.QueryContext(ctx, `
+			SELECT `+urlColumns+`
+			FROM urls
+			WHERE workspace_id = $1 AND is_active = true
+			ORDER BY created_at DESC, id DESC
+			LIMIT $2
+		`, workspaceID, limit)
+	} else {
+		rows, err = s.db.QueryContext(ctx, `
+			SELECT `+urlColumns+`
+			FROM urls
+			WHERE workspace_id = $1 AND is_active = true AND (created_at, id) < ($2, $3)
+			ORDER BY created_at DESC, id DESC
+			LIMIT $4
+		`, workspaceID, after.Time.UTC(), after.ID, limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query URLs: %w", err)
+	}
+	return scanURLs(rows)
+}
+
+func scanURLs(rows *sql.Rows) ([]models.URL, error) {
+	defer rows.Close()
+
+	urls := []models.URL{}
+	for rows.Next() {
+		var url models.URL
+		if err := scanURL(rows, &url); err != nil {
+			return nil, fmt.Errorf("failed to scan URL: %w", err)
+		}
+		urls = append(urls, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read URLs: %w", err)
+	}
+	return urls, nil
+}
+
+// ClickTarget implements ClickStore
+func (s *SQL) ClickTarget(ctx context.Context, domain, shortCode string) (*ClickTarget, error) {
+	var target ClickTarget
+	err := s.db.QueryRowContext(ctx, `
+		SELECT u.id, COALESCE(CAST(u.workspace_id AS TEXT), ''), COALESCE(w.plan, '')
+		FROM urls u LEFT JOIN workspaces w ON w.id = u.workspace_id
+		WHERE u.domain = $1 AND u.short_code = $2 AND u.is_active = true
+	`, domain, shortCode).Scan(&target.URLID, &target.WorkspaceID, &target.Plan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load URL: %w", err)
+	}
+	return &target, nil
+}
+
+// InsertClick implements ClickStore
+func (s *SQL) InsertClick(ctx context.Context, click *models.Analytics) error {
+	var recordedAt database.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO analytics (url_id, short_code, ip_address, user_agent, referer, country, city,
+			referer_domain, device, browser, visitor_id, clicked_at, recorded_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, timezone('UTC', now()))
+		RETURNING recorded_at
+	`, click.URLID, click.ShortCode, sql.NullString{String: click.IPAddress, Valid: click.IPAddress != ""},
+		click.UserAgent, click.Referer, click.Country, click.City,
+		click.RefererDomain, click.Device, click.Browser,
+		sql.NullString{String: click.VisitorID, Valid: click.VisitorID != ""}, click.ClickedAt.UTC()).Scan(&recordedAt)
+	if err != nil {
+		return fmt.Errorf("failed to track click: %w", err)
+	}
+	click.RecordedAt = recordedAt.Time.UTC()
+	return nil
+}
+
+// CountClicks implements ClickStore
+func (s *SQL) CountClicks(ctx context.Context, urlID string) (int64, error) {
+	query, args, err := s.rolledUpClicks(ctx, urlID, DimensionTotal)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	err = s.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(clicks), 0) FROM (`+query+`) c`, args...).Scan(&total)
+	return total, err
+}
+
+// LastClickedAt implements ClickStore
+func (s *SQL) LastClickedAt(ctx context.Context, urlID string) (*time.Time, error) {
+	var last database.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT MAX(clicked_at) FROM analytics WHERE url_id = $1
+	`, urlID).Scan(&last)
+	if err != nil {
+		return nil, err
+	}
+	return last.Ptr(), nil
+}
+
+// TopValues implements ClickStore
+func (s *SQL) TopValues(ctx context.Context, urlID, dimension string, limit int) ([]ValueCount, error) {
+	query, args, err := s.rolledUpClicks(ctx, urlID, dimension)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT value, SUM(clicks) AS count FROM (`+query+`) c
+		WHERE value != ''
+		GROUP BY value
+		ORDER BY count DESC, value
+		LIMIT `+strconv.Itoa(limit), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []ValueCount
+	for rows.Next() {
+		var value ValueCount
+		if err := rows.Scan(&value.Value, &value.Count); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// ClickCounts implements ClickStore. Hours are read from the hourly
+// rollups and the clicks stored since; minutes are always counted from the
+// clicks.
+func (s *SQL) ClickCounts(ctx context.Context, urlID string, from, to time.Time, step time.Duration) ([]TimeCount, error) {
+	var (
+		query string
+		args  []interface{}
+	)
+	switch step {
+	case time.Minute:
+		query = `
+			SELECT date_trunc('minute', clicked_at) AS bucket, COUNT(*) AS count FROM analytics
+			WHERE url_id = $1 AND clicked_at >= $2 AND clicked_at < $3
+			GROUP BY bucket
+			ORDER BY bucket
+		`
+		args = []interface{}{urlID, from.UTC(), to.UTC()}
+	case time.Hour:
+		rolledUntil, err := s.rolledUntil(ctx, s.db)
+		if err != nil {
+			return nil, err
+		}
+		query = `
+			SELECT bucket, SUM(clicks) AS count FROM (
+				SELECT bucket, clicks FROM click_rollups_hourly
+				WHERE url_id = $1 AND dimension = $2 AND bucket >= $3 AND bucket < $4
+				UNION ALL
+				SELECT date_trunc('hour', clicked_at), 1 FROM analytics
+				WHERE url_id = $1 AND recorded_at >= $5 AND clicked_at >= $3 AND clicked_at < $4
+			) c
+			GROUP BY bucket
+			ORDER BY bucket
+		`
+		args = []interface{}{urlID, DimensionTotal, from.UTC(), to.UTC(), rolledUntil}
+	default:
+		return nil, fmt.Errorf("unsupported click count step %s", step)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []TimeCount
+	for rows.Next() {
+		var (
+			bucket database.NullTime
+			count  TimeCount
+		)
+		if err := rows.Scan(&bucket, &count.Count); err != nil {
+			return nil, err
+		}
+		count.Time = bucket.Time.UTC()
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// rollupDimensions are the dimensions clicks are rolled up by, with the
+// expression of their value over the analytics table; the total has none
+var rollupDimensions = []struct {
+	name, column string
+}{
+	{DimensionTotal, ""},
+	{DimensionCountry, "COALESCE(country, '')"},
+	{DimensionCity, "COALESCE(city, '')"},
+	{DimensionReferer, "COALESCE(referer_domain, '')"},
+	{DimensionDevice, "COALESCE(device, '')"},
+	{DimensionBrowser, "COALESCE(browser, '')"},
+}
+
+// rolledUpClicks returns a query of the (value, clicks) rows of a dimension
+// of a link, with its arguments: its daily rollups, and the clicks stored
+// since they were rolled up
+func (s *SQL) rolledUpClicks(ctx context.Context, urlID, dimension string) (string, []interface{}, error) {
+	column, found := "", false
+	for _, d := range rollupDimensions {
+		if d.name == dimension {
+			column, found = d.column, true
+		}
+	}
+	if !found {
+		return "", nil, fmt.Errorf("unknown click dimension %q", dimension)
+	}
+	if column == "" {
+		column = "''"
+	}
+	rolledUntil, err := s.rolledUntil(ctx, s.db)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return `
+		SELECT value, clicks FROM click_rollups_daily
+		WHERE url_id = $1 AND dimension = $2
+		UNION ALL
+		SELECT ` + column + `, 1 FROM analytics
+		WHERE url_id = $1 AND recorded_at >= $3
+	`, []interface{}{urlID, dimension, rolledUntil}, nil
+}
+
+// rollupState names the row of click_rollup_state of the click rollups
+const rollupState = "clicks"
+
+// rolledUntil returns the time before which the clicks stored are rolled up,
+// or the zero time if none are
+func (s *SQL) rolledUntil(ctx context.Context, q queryer) (time.Time, error) {
+	var rolledUntil time.Time
+	err := q.QueryRowContext(ctx, `
+		SELECT rolled_until FROM click_rollup_state WHERE name = $1
+	`, rollupState).Scan(&rolledUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read rollup state: %w", err)
+	}
+	return rolledUntil.UTC(), nil
+}
+
+// RollUpNextHour implements ClickStore. Hours are rolled up one per
+// transaction, holding the rollup state row so instances take turns. The
+// clicks stored in an hour are added to the rollups of the hour and day they
+// happened in, so clicks stored late are added to hours and days rolled up
+// before.
+func (s *SQL) RollUpNextHour(ctx context.Context, delay time.Duration) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var rolledUntil time.Time
+	err = tx.QueryRowContext(ctx, `
+		SELECT rolled_until FROM click_rollup_state WHERE name = $1 `+s.db.Dialect.ForUpdate()+`
+	`, rollupState).Scan(&rolledUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO click_rollup_state (name, rolled_until) VALUES ($1, $2)
+		`, rollupState, rolledUntil)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock rollup state: %w", err)
+	}
+	rolledUntil = rolledUntil.UTC()
+
+	// Hours end by the database's clock, which stamps the clicks; skip the
+	// hours without clicks
+	var now, next database.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT now(), MIN(recorded_at) FROM analytics WHERE recorded_at >= $1
+	`, rolledUntil).Scan(&now, &next)
+	if err != nil {
+		return false, fmt.Errorf("failed to find clicks to roll up: %w", err)
+	}
+	before := now.Time.UTC().Add(-delay).Truncate(time.Hour)
+	hour := before
+	if next.Valid && next.Time.UTC().Truncate(time.Hour).Before(before) {
+		hour = next.Time.UTC().Truncate(time.Hour)
+	}
+	rolled := hour.Before(before)
+
+	until := hour
+	if rolled {
+		until = hour.Add(time.Hour)
+		for _, table := range []string{"click_rollups_hourly", "click_rollups_daily"} {
+			if err := s.rollUp(ctx, tx, table, hour, until); err != nil {
+				return false, err
+			}
+		}
+	}
+	if !until.After(rolledUntil) {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE click_rollup_state SET rolled_until = $1 WHERE name = $2
+	`, until, rollupState)
+	if err != nil {
+		return false, fmt.Errorf("failed to update rollup state: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return rolled, nil
+}
+
+// rollUp adds the clicks stored from start to end to the rollups of table,
+// per hour or UTC day they happened in
+func (s *SQL) rollUp(ctx context.Context, tx *sql.Tx, table string, start, end time.Time) error {
+	bucket := "date_trunc('hour', clicked_at)"
+	if table == "click_rollups_daily" {
+		bucket = "date_trunc('day', clicked_at)"
+	}
+	for _, d := range rollupDimensions {
+		value, groupBy := "''", "url_id, "+bucket
+		if d.column != "" {
+			value, groupBy = d.column, groupBy+", "+d.column
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO `+table+` (url_id, bucket, dimension, value, clicks)
+			SELECT url_id, `+bucket+`, '`+d.name+`', `+value+`, COUNT(*) FROM analytics
+			WHERE recorded_at >= $1 AND recorded_at < $2
+			GROUP BY `+groupBy+`
+			ON CONFLICT (url_id, dimension, bucket, value)
+			DO UPDATE SET clicks = `+table+`.clicks + excluded.clicks
+		`, start, end)
+		if err != nil {
+			return fmt.Errorf("failed to roll up %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// ListClicks implements ClickStore
+func (s *SQL) ListClicks(ctx context.Context, urlID string, after *pagination.Cursor, limit int) ([]models.Analytics, error) {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if after == nil {
+		rows, err = s.db.QueryContext(ctx, `
+			SELECT `+clickColumns+`
+			FROM analytics
+			WHERE url_id = $1
+			ORDER BY clicked_at DESC, id DESC
+			LIMIT $2
+		`, urlID, limit)
+	} else {
+		rows, err = s.db.QueryContext(ctx, `
+			SELECT `+clickColumns+`
+			FROM analytics
+			WHERE url_id = $1 AND (clicked_at, id) < ($2, $3)
+			ORDER BY clicked_at DESC, id DESC
+			LIMIT $4
+		`, urlID, after.Time.UTC(), after.ID, limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query clicks: %w", err)
+	}
+	defer rows.Close()
+
+	clicks := []models.Analytics{}
+	for rows.Next() {
+		var click models.Analytics
+		if err := scanClick(rows, &click); err != nil {
+			return nil, fmt.Errorf("failed to scan click: %w", err)
+		}
+		clicks = append(clicks, click)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read clicks: %w", err)
+	}
+	return clicks, nil
+}
+
+// CountWorkspaceClicks implements ClickStore
+func (s *SQL) CountWorkspaceClicks(ctx context.Context, workspaceID string, since time.Time) (int64, error) {
+	rolledUntil, err := s.rolledUntil(ctx, s.db)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(clicks), 0) FROM (
+			SELECT r.clicks FROM click_rollups_daily r JOIN urls u ON u.id = r.url_id
+			WHERE u.workspace_id = $1 AND r.dimension = $2 AND r.bucket >= $3
+			UNION ALL
+			SELECT 1 FROM analytics a JOIN urls u ON u.id = a.url_id
+			WHERE u.workspace_id = $1 AND a.recorded_at >= $4 AND a.clicked_at >= $3
+		) c
+	`, workspaceID, DimensionTotal, startOfDay(since), rolledUntil).Scan(&total)
+	return total, err
+}
+
+// startOfDay returns the start of the UTC day of t
+func startOfDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// clickCounterState names the row of click_rollup_state of the click
+// counters, which count every click stored before its rolled_until
+const clickCounterState = "click_counters"
+
+// flushRetention is how long the IDs of added click counter flushes are
+// kept to tell a flush applied again; flushes cut short are applied again
+// at the next flush
+const flushRetention = 7 * 24 * time.Hour
+
+// lockClickCounters holds the state row of the click counters until tx ends
+// and returns the minute delay before the database's clock and the minute
+// before which the counters count every click stored
+func (s *SQL) lockClickCounters(ctx context.Context, tx *sql.Tx, delay time.Duration) (before, countedUntil time.Time, err error) {
+	err = tx.QueryRowContext(ctx, `
+		SELECT rolled_until FROM click_rollup_state WHERE name = $1 `+s.db.Dialect.ForUpdate()+`
+	`, clickCounterState).Scan(&countedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO click_rollup_state (name, rolled_until) VALUES ($1, $2)
+		`, clickCounterState, countedUntil)
+	}
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to lock click counters: %w", err)
+	}
+
+	// Clicks are stamped by the database's clock
+	var now database.NullTime
+	if err := tx.QueryRowContext(ctx, `SELECT now()`).Scan(&now); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to read the database's clock: %w", err)
+	}
+	return now.Time.UTC().Add(-delay).Truncate(time.Minute), countedUntil.UTC(), nil
+}
+
+// FlushClickCounters implements ClickStore. The ID of each flush is
+// recorded in the transaction adding its counts, which holds the state row
+// of the click counters.
+func (s *SQL) FlushClickCounters(ctx context.Context, delay time.Duration, take func(before, countedUntil time.Time) (map[string]map[string]int64, error)) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, countedUntil, err := s.lockClickCounters(ctx, tx, delay)
+	if err != nil {
+		return 0, err
+	}
+	flushes, err := take(before, countedUntil)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	var added int64
+	for flushID, counts := range flushes {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO click_counter_flushes (id, flushed_at) VALUES ($1, $2)
+			ON CONFLICT (id) DO NOTHING
+		`, flushID, now)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record click counter flush: %w", err)
+		}
+		if recorded, err := result.RowsAffected(); err != nil {
+			return 0, err
+		} else if recorded == 0 {
+			continue
+		}
+		for urlID, count := range counts {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO url_click_counters (url_id, total_clicks, updated_at)
+				SELECT id, $2, $3 FROM urls WHERE id = $1
+				ON CONFLICT (url_id)
+				DO UPDATE SET total_clicks = url_click_counters.total_clicks + excluded.total_clicks, updated_at = excluded.updated_at
+			`, urlID, count, now)
+			if err != nil {
+				return 0, fmt.Errorf("failed to add click counts: %w", err)
+			}
+			added += count
+		}
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM click_counter_flushes WHERE flushed_at < $1`, now.Add(-flushRetention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune click counter flushes: %w", err)
+	}
+	return added, tx.Commit()
+}
+
+// ClickCounter implements ClickStore
+func (s *SQL) ClickCounter(ctx context.Context, urlID string) (int64, error) {
+	var total int64
+	err := s.db.QueryRowContext(ctx, `SELECT total_clicks FROM url_click_counters WHERE url_id = $1`, urlID).Scan(&total)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return total, err
+}
+
+// RebuildClickCounters implements ClickStore, holding the state row of the
+// click counters
+func (s *SQL) RebuildClickCounters(ctx context.Context, delay time.Duration) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The cache may have dropped the clicks stored before the counters'
+	// state already, so those are counted whatever the clock says
+	before, countedUntil, err := s.lockClickCounters(ctx, tx, delay)
+	if err != nil {
+		return 0, err
+	}
+	if before.Before(countedUntil) {
+		before = countedUntil
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM url_click_counters`); err != nil {
+		return 0, fmt.Errorf("failed to clear click counters: %w", err)
+	}
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO url_click_counters (url_id, total_clicks, updated_at)
+		SELECT url_id, COUNT(*), $1 FROM analytics WHERE recorded_at < $2 GROUP BY url_id
+	`, time.Now().UTC(), before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to rebuild click counters: %w", err)
+	}
+	links, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE click_rollup_state SET rolled_until = $1 WHERE name = $2
+	`, before, clickCounterState)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update click counter state: %w", err)
+	}
+	return links, tx.Commit()
+}
+
+// dailyVisitorsBatch bounds the visitors DailyVisitors passes at once
+const dailyVisitorsBatch = 1000
+
+// DailyVisitors implements ClickStore
+func (s *SQL) DailyVisitors(ctx context.Context, fn func(urlID string, day time.Time, visitorIDs []string) error) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT url_id, DATE(clicked_at) AS day, visitor_id FROM analytics
+		WHERE visitor_id IS NOT NULL
+		ORDER BY url_id, day
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query visitors: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		urlID      string
+		day        time.Time
+		visitorIDs []string
+	)
+	for rows.Next() {
+		var (
+			rowURLID, visitorID string
+			rowDay              database.NullTime
+		)
+		if err := rows.Scan(&rowURLID, &rowDay, &visitorID); err != nil {
+			return err
+		}
+		if len(visitorIDs) > 0 && (rowURLID != urlID || !rowDay.Time.Equal(day) || len(visitorIDs) == dailyVisitorsBatch) {
+			if err := fn(urlID, day, visitorIDs); err != nil {
+				return err
+			}
+			visitorIDs = visitorIDs[:0]
+		}
+		urlID, day = rowURLID, rowDay.Time
+		visitorIDs = append(visitorIDs, visitorID)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(visitorIDs) > 0 {
+		return fn(urlID, day, visitorIDs)
+	}
+	return nil
+}
+
+// redirectType returns the redirect type of a new link, the default if it
+// has none
+func redirectType(url *models.URL) int {
+	if url.RedirectType == 0 {
+		return models.DefaultRedirectType
+	}
+	return url.RedirectType
+}
+
+// utc returns t in UTC, keeping nil
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
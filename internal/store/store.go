@@ -0,0 +1,181 @@
+// Package store persists links and their clicks. The URL and analytics
+// services depend on the URLStore, ClickStore and Cache interfaces. SQL
+// implements the stores on CockroachDB, PostgreSQL and SQLite and
+// RedisCache the cache; Memory and MemoryCache keep everything in process.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"linksprint/internal/logging"
+	"linksprint/internal/models"
+	"linksprint/internal/pagination"
+)
+
+// logger is the logger of the store package
+var logger = logging.For("store")
+
+var (
+	// ErrNotFound is returned when the requested link does not exist, is
+	// deleted or belongs to another workspace
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a link's short code is already taken on
+	// its domain
+	ErrConflict = errors.New("already exists")
+)
+
+// URLStore persists links. Links are scoped to a workspace; only ResolveURL
+// and ShortCodeExists look across workspaces, by domain. Changes are
+// recorded in the audit log in the same transaction, with the principal as
+// actor.
+type URLStore interface {
+	// CreateURL stores a new link in the principal's workspace and returns
+	// it with its ID and timestamps
+	CreateURL(ctx context.Context, principal *models.Principal, url *models.URL) (*models.URL, error)
+	// GetURL returns the active link shortCode of a workspace
+	GetURL(ctx context.Context, workspaceID, shortCode string) (*models.URL, error)
+	// UpdateURL applies update to the active link shortCode of the
+	// principal's workspace and returns it as stored
+	UpdateURL(ctx context.Context, principal *models.Principal, shortCode string, update func(url *models.URL)) (*models.URL, error)
+	// DeleteURL soft-deletes the active link shortCode of the principal's
+	// workspace and returns it as it was
+	DeleteURL(ctx context.Context, principal *models.Principal, shortCode string) (*models.URL, error)
+
+	// ResolveURL returns the record of link shortCode on domain, active or
+	// not and expired or not
+	ResolveURL(ctx context.Context, domain, shortCode string) (*LinkRecord, error)
+	// ShortCodeExists reports whether shortCode is taken on domain, by any
+	// link ever created
+	ShortCodeExists(ctx context.Context, domain, shortCode string) (bool, error)
+	// WorkspaceDomain returns the custom domain of a workspace, or ""
+	WorkspaceDomain(ctx context.Context, workspaceID string) (string, error)
+	// ForEachShortCode calls fn with the domain and short code of every
+	// active link, stopping at the first error
+	ForEachShortCode(ctx context.Context, fn func(domain, shortCode string) error) error
+
+	// CountURLs counts the active links of a workspace created since the
+	// given time, or all of them for the zero time
+	CountURLs(ctx context.Context, workspaceID string, createdSince time.Time) (int64, error)
+	// ListURLs returns a page of the active links of a workspace, newest
+	// first
+	ListURLs(ctx context.Context, workspaceID string, offset, limit int) ([]models.URL, error)
+	// ListURLsAfter returns up to limit active links of a workspace newest
+	// first, ordered by (created_at, id) and starting after the cursor if
+	// there is one
+	ListURLsAfter(ctx context.Context, workspaceID string, after *pagination.Cursor, limit int) ([]models.URL, error)
+}
+
+// LinkRecord is what redirects need to know about a link: where it points,
+// until when, whether it is active and the status code it redirects with.
+// Caches keep it as is, and it is checked on every redirect, so a cached
+// link stops redirecting exactly when it would if looked up afresh.
+type LinkRecord struct {
+	OriginalURL  string     `json:"url"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Active       bool       `json:"active"`
+	RedirectType int        `json:"redirect_type"`
+}
+
+// NewLinkRecord returns the record of a link
+func NewLinkRecord(url *models.URL) LinkRecord {
+	return LinkRecord{
+		OriginalURL:  url.OriginalURL,
+		ExpiresAt:    url.ExpiresAt,
+		Active:       url.IsActive,
+		RedirectType: url.RedirectType,
+	}
+}
+
+// Redirects reports whether the link redirects at the given time
+func (r *LinkRecord) Redirects(now time.Time) bool {
+	return r.Active && (r.ExpiresAt == nil || r.ExpiresAt.After(now))
+}
+
+// ClickTarget is the link a click is recorded against, with the workspace
+// and plan it is metered to
+type ClickTarget struct {
+	URLID       string
+	WorkspaceID string
+	Plan        string
+}
+
+// Dimensions clicks are rolled up by. Clicks in total are the total
+// dimension, with the value "".
+const (
+	DimensionTotal   = "total"
+	DimensionCountry = "country"
+	DimensionCity    = "city"
+	DimensionReferer = "referer"
+	DimensionDevice  = "device"
+	DimensionBrowser = "browser"
+)
+
+// ValueCount is the clicks counted for a value of a dimension
+type ValueCount struct {
+	Value string
+	Count int64
+}
+
+// TimeCount is the clicks counted in the interval starting at Time
+type TimeCount struct {
+	Time  time.Time
+	Count int64
+}
+
+// ClickStore persists click events and aggregates them. SQL rolls clicks up
+// per hour and day and reads the rollups, adding the click events stored
+// since.
+type ClickStore interface {
+	// ClickTarget returns the active link shortCode on domain that clicks
+	// are recorded against
+	ClickTarget(ctx context.Context, domain, shortCode string) (*ClickTarget, error)
+	// InsertClick stores a click event and sets when it was stored
+	InsertClick(ctx context.Context, click *models.Analytics) error
+
+	// CountClicks counts the clicks of a link
+	CountClicks(ctx context.Context, urlID string) (int64, error)
+	// LastClickedAt returns when a link was last clicked, or nil
+	LastClickedAt(ctx context.Context, urlID string) (*time.Time, error)
+	// TopValues returns the non-empty values of a dimension with the most
+	// clicks on a link, most clicks first
+	TopValues(ctx context.Context, urlID, dimension string, limit int) ([]ValueCount, error)
+	// ClickCounts returns the clicks of a link in [from, to) per UTC minute
+	// or hour, as step is time.Minute or time.Hour, oldest first and leaving
+	// out intervals without clicks
+	ClickCounts(ctx context.Context, urlID string, from, to time.Time, step time.Duration) ([]TimeCount, error)
+	// ListClicks returns up to limit clicks of a link newest first, ordered
+	// by (clicked_at, id) and starting after the cursor if there is one
+	ListClicks(ctx context.Context, urlID string, after *pagination.Cursor, limit int) ([]models.Analytics, error)
+
+	// DailyVisitors calls fn with the visitors recorded with the clicks of
+	// each link per UTC day, in batches
+	DailyVisitors(ctx context.Context, fn func(urlID string, day time.Time, visitorIDs []string) error) error
+
+	// RollUpNextHour rolls up the clicks stored in the next hour not rolled
+	// up yet that has clicks, provided it ended at least delay ago, and
+	// reports whether there may be more hours to roll up
+	RollUpNextHour(ctx context.Context, delay time.Duration) (bool, error)
+
+	// CountWorkspaceClicks counts the clicks on the links of a workspace
+	// since the start of the UTC day of since, or all of them for the zero
+	// time
+	CountWorkspaceClicks(ctx context.Context, workspaceID string, since time.Time) (int64, error)
+
+	// FlushClickCounters holds the click counters while take takes the
+	// clicks to add to them, and adds them; flushes and rebuilds take
+	// turns. take is passed the minute before which to take clicks, delay
+	// before the database's clock, and the minute before which the counters
+	// count every click stored; it returns the counts of each flush by
+	// flush ID and link ID. Each flush is added once, and counts of links
+	// that no longer exist are dropped. It returns the clicks added.
+	FlushClickCounters(ctx context.Context, delay time.Duration, take func(before, countedUntil time.Time) (map[string]map[string]int64, error)) (int64, error)
+	// ClickCounter returns the click counter of a link, or 0
+	ClickCounter(ctx context.Context, urlID string) (int64, error)
+	// RebuildClickCounters sets the click counter of every link to the
+	// clicks stored before the minute delay before the database's clock,
+	// which the counters count from then on, and returns how many links
+	// have clicks
+	RebuildClickCounters(ctx context.Context, delay time.Duration) (int64, error)
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"linksprint/internal/cache"
+	"linksprint/internal/metrics"
+	"linksprint/internal/redis"
+)
+
+// TieredCache keeps the most requested links in process in front of the
+// RedisCache, sparing redirects the Redis round trip. Local entries live
+// for the configured TTL at most and never outlive their Redis key, so
+// expirations in Redis apply everywhere. Edits and deletes are broadcast
+// over Redis pub/sub, and every instance drops its local copy within
+// milliseconds.
+type TieredCache struct {
+	*RedisCache
+	// local holds the entries found in Redis, nil for lookups that found
+	// nothing
+	local *cache.LRU[*cacheEntry]
+	ttl   time.Duration
+	// stop ends the invalidation subscription
+	stop func()
+}
+
+// NewTieredCache creates a cache keeping up to size links in process for
+// ttl, and starts listening for invalidations. Close stops listening.
+func NewTieredCache(redis *redis.Client, size int, ttl time.Duration) *TieredCache {
+	c := &TieredCache{
+		RedisCache: NewRedisCache(redis),
+		local:      cache.NewLRU[*cacheEntry](size),
+		ttl:        ttl,
+	}
+	c.stop = redis.SubscribeURLInvalidations(c.local.Delete, c.local.Purge)
+	return c
+}
+
+// GetURL implements Cache
+func (c *TieredCache) GetURL(ctx context.Context, key string) (CachedURL, error) {
+	if entry, ok := c.local.Get(key); ok {
+		if entry == nil {
+			countLookup(metrics.CacheTierLocal, ErrCachedNotFound)
+			return CachedURL{}, ErrCachedNotFound
+		}
+		countLookup(metrics.CacheTierLocal, nil)
+		return entry.cached(), nil
+	}
+	countLookup(metrics.CacheTierLocal, ErrCacheMiss)
+
+	entry, remaining, err := c.RedisCache.getURL(ctx, key)
+	switch {
+	case errors.Is(err, ErrCachedNotFound):
+		c.local.Set(key, nil, c.localTTL(remaining))
+		return CachedURL{}, err
+	case err != nil:
+		return CachedURL{}, err
+	}
+	c.local.Set(key, &entry, c.localTTL(remaining))
+	return entry.cached(), nil
+}
+
+// SetURL implements Cache
+func (c *TieredCache) SetURL(ctx context.Context, key string, record LinkRecord) error {
+	entry, keep, err := c.RedisCache.setURL(ctx, key, record)
+	if err != nil || keep <= 0 {
+		return err
+	}
+	c.local.Set(key, &entry, c.localTTL(keep))
+	return nil
+}
+
+// SetNotFound implements Cache
+func (c *TieredCache) SetNotFound(ctx context.Context, key string, ttl time.Duration) error {
+	if err := c.RedisCache.SetNotFound(ctx, key, ttl); err != nil {
+		return err
+	}
+	c.local.Set(key, nil, c.localTTL(ttl))
+	return nil
+}
+
+// DeleteURL implements Cache, evicting the link on every instance
+func (c *TieredCache) DeleteURL(ctx context.Context, key string) error {
+	c.local.Delete(key)
+	if err := c.RedisCache.DeleteURL(ctx, key); err != nil {
+		return err
+	}
+	return c.redis.PublishURLInvalidation(ctx, key)
+}
+
+// localTTL returns how long an entry with remaining time in Redis is kept
+// in process
+func (c *TieredCache) localTTL(remaining time.Duration) time.Duration {
+	if remaining > 0 && remaining < c.ttl {
+		return remaining
+	}
+	return c.ttl
+}
+
+// Close stops listening for invalidations
+func (c *TieredCache) Close() {
+	c.stop()
+}
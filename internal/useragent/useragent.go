@@ -0,0 +1,83 @@
+// Package useragent classifies clients by their User-Agent header, for
+// click analytics.
+package useragent
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Devices a click can come from
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// botPattern matches the user agents of crawlers and link previewers
+var botPattern = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|facebookexternalhit|embedly|preview`)
+
+// browsers maps user agent tokens to browser names, in the order they are
+// tried: Chromium-based browsers also claim to be Chrome and Safari
+var browsers = []struct {
+	token, name string
+}{
+	{"Edg", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"MSIE ", "Internet Explorer"},
+	{"Trident/", "Internet Explorer"},
+}
+
+// IsBot reports whether a user agent is a crawler or link previewer
+func IsBot(userAgent string) bool {
+	return botPattern.MatchString(userAgent)
+}
+
+// Device returns the kind of device of a user agent, or "" if it is empty
+func Device(userAgent string) string {
+	switch {
+	case userAgent == "":
+		return ""
+	case IsBot(userAgent):
+		return DeviceBot
+	case strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "Tablet") ||
+		(strings.Contains(userAgent, "Android") && !strings.Contains(userAgent, "Mobile")):
+		return DeviceTablet
+	case strings.Contains(userAgent, "Mobi") || strings.Contains(userAgent, "iPhone"):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
+
+// Browser returns the browser of a user agent, "Other" if it is not
+// recognized, or "" if it is empty
+func Browser(userAgent string) string {
+	if userAgent == "" {
+		return ""
+	}
+	for _, browser := range browsers {
+		if strings.Contains(userAgent, browser.token) {
+			return browser.name
+		}
+	}
+	return "Other"
+}
+
+// RefererDomain returns the host of a referer URL without a leading www.,
+// or "" if it has none
+func RefererDomain(referer string) string {
+	u, err := url.Parse(referer)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
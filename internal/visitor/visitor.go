@@ -0,0 +1,38 @@
+// Package visitor identifies the visitors of links, so unique visitors can
+// be counted without storing who they are. A visitor is known by the
+// first-party cookie set on their first redirect; clients that do not keep
+// cookies are known by a keyed hash of their IP address and user agent.
+package visitor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// CookieName names the cookie holding the visitor ID
+const CookieName = "lsvid"
+
+// idLength is the length of a visitor ID, in hex digits
+const idLength = 32
+
+// ID returns the visitor ID of a client without a visitor cookie: the
+// HMAC-SHA256 of its IP address and user agent under key, so the same
+// client always gets the same ID and IDs cannot be traced back to
+// addresses without the key
+func ID(key []byte, ip, userAgent string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(ip))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userAgent))
+	return hex.EncodeToString(mac.Sum(nil))[:idLength]
+}
+
+// Valid reports whether a cookie value has the form of a visitor ID
+func Valid(id string) bool {
+	if len(id) != idLength {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"linksprint/internal/audit"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type linkSnapshot struct {
+	OriginalURL string `json:"original_url"`
+	Title       string `json:"title"`
+}
+
+// TestAuditDiffKeepsChangedFields tests that only changed fields are stored
+func TestAuditDiffKeepsChangedFields(t *testing.T) {
+	before, after, err := audit.Diff(
+		linkSnapshot{OriginalURL: "https://old.example.com", Title: "Docs"},
+		linkSnapshot{OriginalURL: "https://new.example.com", Title: "Docs"},
+	)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"original_url":"https://old.example.com"}`, before.String)
+	assert.JSONEq(t, `{"original_url":"https://new.example.com"}`, after.String)
+}
+
+// TestAuditDiffCreateAndDelete tests that a missing snapshot is stored as NULL
+func TestAuditDiffCreateAndDelete(t *testing.T) {
+	var none *linkSnapshot
+	before, after, err := audit.Diff(none, &linkSnapshot{OriginalURL: "https://example.com"})
+	assert.NoError(t, err)
+	assert.False(t, before.Valid)
+	assert.JSONEq(t, `{"original_url":"https://example.com","title":""}`, after.String)
+
+	before, after, err = audit.Diff(linkSnapshot{Title: "Gone"}, nil)
+	assert.NoError(t, err)
+	assert.True(t, before.Valid)
+	assert.False(t, after.Valid)
+}
+
+// TestAuditRequestContext tests that request metadata travels in the context
+func TestAuditRequestContext(t *testing.T) {
+	ctx := audit.WithRequest(context.Background(), audit.Request{IPAddress: "203.0.113.7", RequestID: "req-1"})
+	assert.Equal(t, "203.0.113.7", audit.RequestFrom(ctx).IPAddress)
+	assert.Equal(t, "req-1", audit.RequestFrom(ctx).RequestID)
+	assert.Empty(t, audit.RequestFrom(context.Background()).RequestID)
+}
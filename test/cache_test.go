@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"linksprint/internal/cache"
+	"linksprint/internal/config"
+	"linksprint/internal/models"
+	"linksprint/internal/redis"
+	"linksprint/internal/services"
+	"linksprint/internal/store"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLRU tests eviction order and per-entry TTLs of the local cache
+func TestLRU(t *testing.T) {
+	lru := cache.NewLRU[string](2)
+	lru.Set("a", "1", time.Minute)
+	lru.Set("b", "2", time.Minute)
+
+	// Reading a makes b the least recently used
+	_, ok := lru.Get("a")
+	assert.True(t, ok)
+	lru.Set("c", "3", time.Minute)
+
+	_, ok = lru.Get("b")
+	assert.False(t, ok, "least recently used entry evicted")
+	value, ok := lru.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", value)
+	assert.Equal(t, 2, lru.Len())
+
+	lru.Set("short", "4", 20*time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+	_, ok = lru.Get("short")
+	assert.False(t, ok, "expired entry")
+
+	lru.Purge()
+	assert.Equal(t, 0, lru.Len())
+}
+
+// TestTieredCache tests that each instance serves links from its local
+// tier, and that evictions and Redis expirations reach every instance
+func TestTieredCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+
+	replica := func() *store.TieredCache {
+		client, err := redis.NewClient("redis://" + mr.Addr())
+		require.NoError(t, err)
+		c := store.NewTieredCache(client, 100, time.Minute)
+		t.Cleanup(func() {
+			c.Close()
+			client.Close()
+		})
+		return c
+	}
+	a, b := replica(), replica()
+
+	require.NoError(t, a.SetURL(ctx, "docs", store.LinkRecord{OriginalURL: "https://example.com/one", Active: true}))
+	entry, err := b.GetURL(ctx, "docs")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/one", entry.OriginalURL)
+
+	// b now answers from its local tier without asking Redis
+	mr.Del("url:docs")
+	entry, err = b.GetURL(ctx, "docs")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/one", entry.OriginalURL)
+
+	// An eviction on a is broadcast to b
+	require.NoError(t, a.DeleteURL(ctx, "docs"))
+	assert.Eventually(t, func() bool {
+		_, err := b.GetURL(ctx, "docs")
+		return err == store.ErrCacheMiss
+	}, time.Second, 5*time.Millisecond)
+
+	// Local copies never outlive the Redis key
+	require.NoError(t, a.SetURL(ctx, "soon", store.LinkRecord{OriginalURL: "https://example.com/soon", Active: true}))
+	mr.SetTTL("url:soon", 50*time.Millisecond)
+	_, err = b.GetURL(ctx, "soon")
+	require.NoError(t, err)
+	mr.FastForward(time.Second)
+	time.Sleep(60 * time.Millisecond)
+	_, err = b.GetURL(ctx, "soon")
+	assert.ErrorIs(t, err, store.ErrCacheMiss)
+}
+
+// TestBloom tests that the filter has no false negatives and about the
+// false positive rate it was sized for
+func TestBloom(t *testing.T) {
+	bloom := cache.NewBloom(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		bloom.Add(fmt.Sprintf("link%d", i))
+	}
+
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		assert.True(t, bloom.Test(fmt.Sprintf("link%d", i)))
+		if bloom.Test(fmt.Sprintf("unknown%d", i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 30)
+}
+
+// TestBloomFilter tests that the link filter is built from the store, sees
+// links added by other instances and is rebuilt when Redis loses it
+func TestBloomFilter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	links := store.NewMemory()
+	_, err := links.CreateURL(ctx, &models.Principal{}, &models.URL{ShortCode: "docs", OriginalURL: "https://example.com"})
+	require.NoError(t, err)
+
+	replica := func() *store.BloomFilter {
+		client, err := redis.NewClient("redis://" + mr.Addr())
+		require.NoError(t, err)
+		f := store.NewBloomFilter(links, client, 1000)
+		t.Cleanup(func() {
+			f.Close()
+			client.Close()
+		})
+		require.Eventually(t, f.Ready, time.Second, 5*time.Millisecond)
+		return f
+	}
+	a, b := replica(), replica()
+
+	assert.True(t, b.MayExist(ctx, "docs"))
+	assert.False(t, b.MayExist(ctx, "fresh"))
+	require.NoError(t, a.Add(ctx, "fresh"))
+	assert.True(t, b.MayExist(ctx, "fresh"), "added by another instance")
+
+	// Until rebuilt, a lost filter rules nothing out
+	mr.FlushAll()
+	assert.True(t, b.MayExist(ctx, "unknown"))
+	require.Eventually(t, b.Ready, time.Second, 5*time.Millisecond)
+	assert.False(t, b.MayExist(ctx, "unknown"))
+}
+
+// slowURLs is a URLStore whose lookups are slow, counted and can fail
+type slowURLs struct {
+	*store.Memory
+	lookups atomic.Int64
+	down    atomic.Bool
+}
+
+func (s *slowURLs) ResolveURL(ctx context.Context, domain, shortCode string) (*store.LinkRecord, error) {
+	s.lookups.Add(1)
+	time.Sleep(20 * time.Millisecond)
+	if s.down.Load() {
+		return nil, errors.New("database unavailable")
+	}
+	return s.Memory.ResolveURL(ctx, domain, shortCode)
+}
+
+// TestRedirectStampede tests that concurrent lookups of an uncached link
+// share one database query, and that expired links are served stale while
+// they are refreshed, even with the database down
+func TestRedirectStampede(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	client, err := redis.NewClientWithOptions("redis://"+mr.Addr(), redis.Options{
+		URLTTL: time.Minute, URLStaleTTL: time.Hour,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	urls := &slowURLs{Memory: store.NewMemory()}
+	_, err = urls.CreateURL(ctx, &models.Principal{}, &models.URL{ShortCode: "viral", OriginalURL: "https://example.com/viral"})
+	require.NoError(t, err)
+	service := services.NewURLService(services.Stores{
+		URLs: urls, Clicks: urls.Memory, Cache: store.NewRedisCache(client),
+	}, nil, config.NewLive(config.Default()))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			redirect, err := service.GetOriginalURL(ctx, "", "viral")
+			if assert.NoError(t, err) {
+				assert.Equal(t, "https://example.com/viral", redirect.OriginalURL)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), urls.lookups.Load())
+
+	// Past its TTL the link is still served while the database is down
+	urls.down.Store(true)
+	mr.FastForward(2 * time.Minute)
+	redirect, err := service.GetOriginalURL(ctx, "", "viral")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/viral", redirect.OriginalURL)
+	assert.Eventually(t, func() bool { return urls.lookups.Load() == 2 }, time.Second, 5*time.Millisecond)
+
+	// Once the database is back, a refresh makes it fresh again
+	urls.down.Store(false)
+	assert.Eventually(t, func() bool {
+		_, err := service.GetOriginalURL(ctx, "", "viral")
+		return err == nil && mr.TTL("url:viral") > time.Hour
+	}, time.Second, 5*time.Millisecond)
+}
+
+// TestExpiringLink tests that a cached link is not kept in the cache past
+// its expiry and stops redirecting when it expires, as uncached links do
+func TestExpiringLink(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	client, err := redis.NewClient("redis://" + mr.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	urls := store.NewMemory()
+	expiresAt := time.Now().Add(200 * time.Millisecond)
+	_, err = urls.CreateURL(ctx, &models.Principal{}, &models.URL{
+		ShortCode: "sale", OriginalURL: "https://example.com/sale", ExpiresAt: &expiresAt,
+		RedirectType: http.StatusTemporaryRedirect,
+	})
+	require.NoError(t, err)
+	service := services.NewURLService(services.Stores{
+		URLs: urls, Clicks: urls, Cache: store.NewRedisCache(client),
+	}, nil, config.NewLive(config.Default()))
+
+	redirect, err := service.GetOriginalURL(ctx, "", "sale")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTemporaryRedirect, redirect.StatusCode)
+	assert.True(t, mr.Exists("url:sale"))
+	assert.LessOrEqual(t, mr.TTL("url:sale"), 200*time.Millisecond)
+
+	// The cached record is checked, whatever is left of its TTL
+	time.Sleep(time.Until(expiresAt))
+	_, err = service.GetOriginalURL(ctx, "", "sale")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
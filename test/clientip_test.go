@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"linksprint/internal/clientip"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClientIPResolve tests that forwarding headers are only believed from
+// trusted proxies and cannot be spoofed by clients
+func TestClientIPResolve(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		remote string
+		value  string
+		want   string
+	}{
+		{"untrusted peer ignores header", "X-Forwarded-For", "203.0.113.9", "198.51.100.1", "203.0.113.9"},
+		{"trusted proxy without header", "X-Forwarded-For", "10.0.0.2", "", "10.0.0.2"},
+		{"single hop", "X-Forwarded-For", "10.0.0.2", "198.51.100.1", "198.51.100.1"},
+		{"spoofed leftmost entry", "X-Forwarded-For", "10.0.0.2", "1.2.3.4, 198.51.100.1, 10.0.0.7", "198.51.100.1"},
+		{"all hops trusted", "X-Forwarded-For", "10.0.0.2", "10.0.0.5, 10.0.0.7", "10.0.0.5"},
+		{"real ip", "X-Real-IP", "10.0.0.2", "198.51.100.1", "198.51.100.1"},
+		{"forwarded with port and quotes", "Forwarded", "10.0.0.2", `for=1.2.3.4, for="[2001:db8::1]:4711";proto=https`, "2001:db8::1"},
+		{"forwarded obfuscated", "Forwarded", "10.0.0.2", "for=_hidden", "10.0.0.2"},
+		{"headers disabled", "none", "10.0.0.2", "198.51.100.1", "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := clientip.New([]string{"10.0.0.0/8", "192.168.1.1"}, tt.header)
+			require.NoError(t, err)
+
+			got := resolver.Resolve(net.ParseIP(tt.remote), func(header string) string {
+				if header == resolver.Header() {
+					return tt.value
+				}
+				return ""
+			})
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestClientIPInvalidConfig tests that bad proxy settings are rejected
+func TestClientIPInvalidConfig(t *testing.T) {
+	_, err := clientip.New([]string{"not-an-ip"}, "X-Forwarded-For")
+	assert.Error(t, err)
+
+	_, err = clientip.New(nil, "X-Client-IP")
+	assert.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"linksprint/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// TestConfigLayers tests that the file overrides defaults, the environment
+// overrides the file and flags override the environment
+func TestConfigLayers(t *testing.T) {
+	path := writeConfigFile(t, "linksprint.yaml", `
+server:
+  port: "9000"
+  read_timeout: 5s
+redis:
+  url_cache_ttl: 1h
+rate_limits:
+  create: 30/1m
+blocklist:
+  domains: [malware.example]
+`)
+	t.Setenv("PORT", "9001")
+	t.Setenv("RATE_LIMIT_AUTH", "0")
+
+	cfg, err := config.Load([]string{"--config", path, "--base-url", "https://sho.rt"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "9001", cfg.Server.Port)
+	assert.Equal(t, 5*time.Second, cfg.Server.ReadTimeout)
+	assert.Equal(t, 30*time.Second, cfg.Server.WriteTimeout, "unset settings keep their defaults")
+	assert.Equal(t, time.Hour, cfg.Redis.URLCacheTTL)
+	assert.Equal(t, "https://sho.rt", cfg.Server.BaseURL)
+	assert.Equal(t, config.RateLimit{Limit: 30, Period: time.Minute}, cfg.RateLimits["create"])
+	assert.Equal(t, config.RateLimit{}, cfg.RateLimits["auth"])
+	assert.Equal(t, config.RateLimitPolicies["api"], cfg.RateLimits["api"])
+	assert.True(t, cfg.Blocklist.BlocksDomain("cdn.malware.example"))
+	assert.False(t, cfg.Blocklist.BlocksDomain("example"))
+}
+
+// TestConfigStorage tests that SQLite storage defaults Redis to the
+// in-process server while an explicit Redis URL still wins
+func TestConfigStorage(t *testing.T) {
+	cfg, err := config.Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, config.Default().Redis.URL, cfg.Redis.URL)
+
+	cfg, err = config.Load([]string{"--storage", "sqlite:./data.db"})
+	require.NoError(t, err)
+	assert.Equal(t, "sqlite:./data.db", cfg.Database.URL)
+	assert.True(t, cfg.Database.IsSQLite())
+	assert.Equal(t, config.InProcessRedis, cfg.Redis.URL)
+
+	t.Setenv("REDIS_URL", "redis://cache:6379")
+	cfg, err = config.Load([]string{"--storage", "sqlite:./data.db"})
+	require.NoError(t, err)
+	assert.Equal(t, "redis://cache:6379", cfg.Redis.URL)
+
+	_, err = config.Load([]string{"--storage", "sqlite:"})
+	assert.Error(t, err)
+}
+
+// TestConfigTOML tests that TOML files are read too
+func TestConfigTOML(t *testing.T) {
+	path := writeConfigFile(t, "linksprint.toml", `
+[database]
+max_open_conns = 50
+
+[blocklist]
+ips = ["192.0.2.0/24"]
+`)
+	cfg, err := config.Load([]string{"--config", path})
+	require.NoError(t, err)
+
+	assert.Equal(t, 50, cfg.Database.MaxOpenConns)
+	assert.True(t, cfg.Blocklist.BlocksIP("192.0.2.10"))
+	assert.False(t, cfg.Blocklist.BlocksIP("198.51.100.1"))
+}
+
+// TestConfigRejectsUnsafeProduction tests that production refuses the
+// development defaults
+func TestConfigRejectsUnsafeProduction(t *testing.T) {
+	t.Setenv("ENV", "production")
+
+	_, err := config.Load(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "JWT_SECRET")
+	assert.Contains(t, err.Error(), "BASE_URL")
+	assert.Contains(t, err.Error(), "sslmode=disable")
+
+	t.Setenv("JWT_SECRET", "0123456789abcdef0123456789abcdef")
+	t.Setenv("BASE_URL", "https://sho.rt")
+	t.Setenv("COCKROACHDB_URL", "postgresql://app@db:26257/linksprint?sslmode=verify-full")
+	_, err = config.Load(nil)
+	assert.NoError(t, err)
+}
+
+// TestConfigRejectsInvalidValues tests that bad values fail instead of
+// silently falling back to defaults
+func TestConfigRejectsInvalidValues(t *testing.T) {
+	t.Setenv("ACCESS_TOKEN_TTL", "soon")
+	_, err := config.Load(nil)
+	assert.ErrorContains(t, err, "ACCESS_TOKEN_TTL")
+}
+
+// TestLiveReload tests that only rate limits and blocklists are hot-reloaded
+func TestLiveReload(t *testing.T) {
+	cfg, err := config.Load(nil)
+	require.NoError(t, err)
+	live := config.NewLive(cfg)
+
+	next, err := config.Load([]string{"--port", "9999"})
+	require.NoError(t, err)
+	next.RateLimits["create"] = config.RateLimit{Limit: 1, Period: time.Second}
+	next.Blocklist.Domains = []string{"spam.example"}
+
+	ignored := live.Reload(next)
+	assert.Equal(t, []string{"server"}, ignored)
+	assert.Equal(t, 1, live.RateLimit("create").Limit)
+	assert.True(t, live.Blocklist().BlocksDomain("spam.example"))
+	assert.Equal(t, cfg.Server.Port, live.Config().Server.Port)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"linksprint/internal/config"
+	"linksprint/internal/database"
+	"linksprint/internal/models"
+	"linksprint/internal/redis"
+	"linksprint/internal/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDatabaseURLs names the environment variables holding the URLs of
+// throwaway databases to run the integration tests against, by dialect.
+// SQLite needs no server, so it always runs on a temporary file.
+var testDatabaseURLs = map[database.Dialect]string{
+	database.CockroachDB: "TEST_COCKROACHDB_URL",
+	database.PostgreSQL:  "TEST_POSTGRES_URL",
+	database.SQLite:      "",
+}
+
+// createdIndex matches the index name of a CREATE INDEX statement
+var createdIndex = regexp.MustCompile(`INDEX IF NOT EXISTS (\w+) ON`)
+
+// TestMigrationsRender tests that every migration renders for each dialect,
+// without CockroachDB-only syntax on PostgreSQL and SQLite and with index
+// names unique across the schema on PostgreSQL
+func TestMigrationsRender(t *testing.T) {
+	migrations, err := database.Migrations()
+	require.NoError(t, err)
+
+	for _, dialect := range database.Dialects {
+		indexes := make(map[string]bool)
+		for _, migration := range migrations {
+			for _, sql := range []string{migration.Up, migration.Down} {
+				rendered, err := dialect.Render(sql)
+				require.NoError(t, err, "%s %s", dialect, migration.Name)
+				assert.NotContains(t, rendered, "{{")
+				if dialect == database.SQLite {
+					assert.NotContains(t, rendered, "ADD COLUMN IF NOT EXISTS", migration.Name)
+					assert.NotContains(t, rendered, "DEFAULT CURRENT_TIMESTAMP", migration.Name)
+				}
+				if dialect == database.CockroachDB {
+					continue
+				}
+
+				assert.NotContains(t, rendered, "@", migration.Name)
+				for _, statement := range database.SplitStatements(rendered) {
+					assert.False(t, strings.HasPrefix(statement, "CREATE TABLE") && strings.Contains(statement, "\tINDEX "),
+						"inline index in %s", statement)
+					if match := createdIndex.FindStringSubmatch(statement); dialect == database.PostgreSQL && match != nil && sql == migration.Up {
+						assert.False(t, indexes[match[1]], "index %s created twice", match[1])
+						indexes[match[1]] = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestDialectDDL tests the statements generated for each dialect
+func TestDialectDDL(t *testing.T) {
+	assert.Equal(t, "CREATE INDEX IF NOT EXISTS idx_short_code ON urls (short_code)",
+		database.CockroachDB.CreateIndex("urls", "idx_short_code", "short_code"))
+	assert.Equal(t, "CREATE INDEX IF NOT EXISTS urls_idx_short_code ON urls (short_code)",
+		database.PostgreSQL.CreateIndex("urls", "idx_short_code", "short_code"))
+	assert.Equal(t, "DROP INDEX IF EXISTS urls@idx_short_code", database.CockroachDB.DropIndex("urls", "idx_short_code"))
+	assert.Equal(t, "DROP INDEX IF EXISTS urls_idx_short_code", database.PostgreSQL.DropIndex("urls", "idx_short_code"))
+	assert.Equal(t, "ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_short_code_key",
+		database.PostgreSQL.DropUniqueConstraint("urls", "urls_short_code_key"))
+	assert.True(t, database.PostgreSQL.TransactionalDDL())
+	assert.False(t, database.CockroachDB.TransactionalDDL())
+
+	assert.Equal(t, "ALTER TABLE urls ADD COLUMN IF NOT EXISTS domain TEXT", database.PostgreSQL.AddColumn("urls", "domain TEXT"))
+	assert.Equal(t, "ALTER TABLE urls ADD COLUMN domain TEXT", database.SQLite.AddColumn("urls", "domain TEXT"))
+	assert.Equal(t, "(gen_random_uuid())", database.SQLite.DefaultUUID())
+	assert.Equal(t, "FOR UPDATE", database.CockroachDB.ForUpdate())
+	assert.Empty(t, database.SQLite.ForUpdate())
+}
+
+// TestDatabaseDialects migrates a real database of each dialect down and up
+// and registers a user. It runs on SQLite and for the dialects whose URL is
+// set in TEST_COCKROACHDB_URL or TEST_POSTGRES_URL; see `make
+// test-databases`.
+func TestDatabaseDialects(t *testing.T) {
+	for dialect, env := range testDatabaseURLs {
+		dialect, env := dialect, env
+		t.Run(string(dialect), func(t *testing.T) {
+			url := "sqlite:" + filepath.Join(t.TempDir(), "linksprint.db")
+			if env != "" {
+				url = os.Getenv(env)
+				if url == "" {
+					t.Skipf("%s is not set", env)
+				}
+			}
+
+			db, err := database.NewConnection(url)
+			require.NoError(t, err)
+			t.Cleanup(func() { db.Close() })
+			assert.Equal(t, dialect, db.Dialect)
+
+			ctx := context.Background()
+			migrator, err := database.NewMigrator(db)
+			require.NoError(t, err)
+			_, err = migrator.Up(ctx)
+			require.NoError(t, err)
+			_, err = migrator.Down(ctx, 1000)
+			require.NoError(t, err)
+			assert.ErrorIs(t, migrator.Check(ctx), database.ErrSchemaBehind)
+			_, err = migrator.Up(ctx)
+			require.NoError(t, err)
+			require.NoError(t, migrator.Check(ctx))
+
+			mr := miniredis.RunT(t)
+			client, err := redis.NewClient("redis://" + mr.Addr())
+			require.NoError(t, err)
+			t.Cleanup(func() { client.Close() })
+
+			auth := services.NewAuthService(db, client, config.Default())
+			req := &models.RegisterRequest{Email: "dialect@example.com", Password: "correct horse battery"}
+			registered, err := auth.Register(ctx, req)
+			require.NoError(t, err)
+			_, err = auth.Register(ctx, req)
+			assert.ErrorIs(t, err, services.ErrEmailTaken)
+
+			principal, err := auth.VerifyAccessToken(ctx, registered.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, "dialect@example.com", principal.Email)
+		})
+	}
+}
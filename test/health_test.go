@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"linksprint/internal/handlers"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func probe(t *testing.T, health *handlers.HealthHandler, path string) (int, string) {
+	app := fiber.New()
+	app.Get("/livez", health.Livez)
+	app.Get("/readyz", health.Readyz)
+
+	resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+	require.NoError(t, err)
+	var body struct {
+		Status string `json:"status"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body.Status
+}
+
+func check(name string, critical bool, err error) handlers.HealthCheck {
+	return handlers.HealthCheck{Name: name, Critical: critical, Check: func(context.Context) error { return err }}
+}
+
+// TestReadiness tests how dependency outages and draining affect /readyz
+func TestReadiness(t *testing.T) {
+	down := errors.New("connection refused")
+
+	tests := []struct {
+		name       string
+		checks     []handlers.HealthCheck
+		wantCode   int
+		wantStatus string
+	}{
+		{"all up", []handlers.HealthCheck{check("database", true, nil), check("redis", false, nil)}, fiber.StatusOK, "ready"},
+		{"optional down", []handlers.HealthCheck{check("database", true, nil), check("redis", false, down)}, fiber.StatusOK, "degraded"},
+		{"critical down", []handlers.HealthCheck{check("database", true, down), check("redis", false, nil)}, fiber.StatusServiceUnavailable, "unready"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, status := probe(t, handlers.NewHealthHandler(time.Second, tt.checks...), "/readyz")
+			assert.Equal(t, tt.wantCode, code)
+			assert.Equal(t, tt.wantStatus, status)
+		})
+	}
+}
+
+// TestReadinessTimeout tests that a hanging dependency counts as down
+func TestReadinessTimeout(t *testing.T) {
+	hanging := handlers.HealthCheck{Name: "database", Critical: true, Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	code, status := probe(t, handlers.NewHealthHandler(50*time.Millisecond, hanging), "/readyz")
+	assert.Equal(t, fiber.StatusServiceUnavailable, code)
+	assert.Equal(t, "unready", status)
+}
+
+// TestDraining tests that draining fails readiness but not liveness
+func TestDraining(t *testing.T) {
+	health := handlers.NewHealthHandler(time.Second, check("database", true, nil))
+	health.SetDraining()
+
+	code, status := probe(t, health, "/readyz")
+	assert.Equal(t, fiber.StatusServiceUnavailable, code)
+	assert.Equal(t, "draining", status)
+
+	code, status = probe(t, health, "/livez")
+	assert.Equal(t, fiber.StatusOK, code)
+	assert.Equal(t, "ok", status)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"linksprint/internal/logging"
+	"linksprint/internal/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logLines captures JSON log lines at the given levels for the rest of the
+// test
+func logLines(t *testing.T, level string, levels map[string]string) func() []map[string]interface{} {
+	var buf bytes.Buffer
+	require.NoError(t, logging.Setup(logging.Options{Format: logging.FormatJSON, Level: level, Levels: levels, Output: &buf}))
+	t.Cleanup(func() { logging.Setup(logging.Options{}) })
+
+	return func() []map[string]interface{} {
+		var lines []map[string]interface{}
+		scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+		for scanner.Scan() {
+			var line map[string]interface{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			lines = append(lines, line)
+		}
+		return lines
+	}
+}
+
+// TestAccessLog tests that request lines carry the request ID and a
+// truncated client IP, and that sampled routes are only logged when they fail
+func TestAccessLog(t *testing.T) {
+	lines := logLines(t, "info", nil)
+
+	app := fiber.New()
+	app.Use(middleware.RequestID())
+	app.Use(middleware.RequestContext())
+	app.Use(middleware.AccessLog(func() map[string]float64 {
+		return map[string]float64{"redirect": 0}
+	}))
+	app.Get("/things/:id", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	app.Get("/:shortCode", func(c *fiber.Ctx) error {
+		if c.Params("shortCode") == "missing" {
+			return fiber.ErrNotFound
+		}
+		return c.Redirect("https://example.com")
+	}).Name("redirect")
+
+	for _, path := range []string{"/things/1", "/abc123", "/missing"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(fiber.HeaderXRequestID, "req-"+strings.ReplaceAll(path[1:], "/", "."))
+		_, err := app.Test(req)
+		require.NoError(t, err)
+	}
+
+	logged := lines()
+	require.Len(t, logged, 2)
+	assert.Equal(t, "access", logged[0]["package"])
+	assert.Equal(t, "/things/:id", logged[0]["route"])
+	assert.Equal(t, "req-things.1", logged[0]["request_id"])
+	assert.Equal(t, "0.0.0.0", logged[0]["client_ip"])
+	assert.Equal(t, "/missing", logged[1]["path"])
+	assert.Equal(t, "missing", logged[1]["short_code"])
+	assert.EqualValues(t, 404, logged[1]["status"])
+}
+
+// TestRequestIDValidation tests that callers' request IDs are only kept when
+// they are short and plain
+func TestRequestIDValidation(t *testing.T) {
+	app := fiber.New()
+	app.Use(middleware.RequestID())
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	for header, kept := range map[string]bool{
+		"abc-123_x.y":             true,
+		strings.Repeat("a", 64):   true,
+		strings.Repeat("a", 65):   false,
+		"evil\r\nSet-Cookie: x=1": false,
+		"with space":              false,
+		"<script>":                false,
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(fiber.HeaderXRequestID, header)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		id := resp.Header.Get(fiber.HeaderXRequestID)
+		if kept {
+			assert.Equal(t, header, id)
+		} else {
+			assert.NotEqual(t, header, id)
+			assert.NotEmpty(t, id)
+		}
+	}
+}
+
+// TestLoggingLevelsAndRedaction tests per-package levels and the redaction
+// of secrets and IPs
+func TestLoggingLevelsAndRedaction(t *testing.T) {
+	lines := logLines(t, "warn", map[string]string{"services": "debug"})
+
+	logging.For("services").Debug("shown", "password", "hunter2", "client_ip", "203.0.113.77")
+	logging.For("redis").Info("hidden")
+	logging.For("redis").Warn("shown", "ip", "2001:db8:1234:5678::1")
+
+	logged := lines()
+	require.Len(t, logged, 2)
+	assert.Equal(t, "[REDACTED]", logged[0]["password"])
+	assert.Equal(t, "203.0.113.0", logged[0]["client_ip"])
+	assert.Equal(t, "2001:db8:1234::", logged[1]["ip"])
+}
@@ -2,54 +2,513 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"regexp"
 	"testing"
+	"time"
 
+	"linksprint/internal/app"
+	"linksprint/internal/config"
+	"linksprint/internal/database"
+	"linksprint/internal/models"
+	"linksprint/internal/redis"
+	"linksprint/internal/services"
+
+	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// newTestRedis starts a Redis test double for the duration of the test and
+// connects a client to it
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client, err := redis.NewClient("redis://" + mr.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// newTestApp builds the application on a fresh SQLite database and a Redis
+// test double. Links, clicks and the link cache live in stores, or in
+// the database and Redis for the zero value.
+func newTestApp(t *testing.T, stores services.Stores) *app.App {
+	t.Helper()
+	return newConfiguredTestApp(t, config.Default(), newTestDB(t), newTestRedis(t), stores)
+}
+
+// newTestDB opens a fresh, migrated SQLite database for the duration of the
+// test
+func newTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := database.NewConnection("sqlite:" + filepath.Join(t.TempDir(), "linksprint.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	migrator, err := database.NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+	return db
+}
+
+// newConfiguredTestApp builds the application like newTestApp, with cfg and
+// on db and client
+func newConfiguredTestApp(t *testing.T, cfg *config.Config, db *database.DB, client *redis.Client, stores services.Stores) *app.App {
+	t.Helper()
+	ctx := context.Background()
+
+	a, err := app.New(app.Deps{
+		Config: config.NewLive(cfg),
+		DB:     db,
+		Redis:  client,
+		Stores: stores,
+	})
+	require.NoError(t, err)
+	t.Cleanup(a.Close)
+	t.Cleanup(func() { a.Clicks.Shutdown(ctx) })
+	return a
+}
+
+// call sends a request to the application and decodes the JSON response
+// into out, if given
+func call(t *testing.T, a *app.App, method, path, token string, body, out interface{}) *http.Response {
+	t.Helper()
+	return callWithHeader(t, a, method, path, token, nil, body, out)
+}
+
+// callWithHeader is call with extra request headers
+func callWithHeader(t *testing.T, a *app.App, method, path, token string, header http.Header, body, out interface{}) *http.Response {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	// No timeout: password hashing is slow under the race detector
+	resp, err := a.Test(req, -1)
+	require.NoError(t, err)
+	if out != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp
+}
+
+// register signs up a user and returns their access token
+func register(t *testing.T, a *app.App, email string) string {
+	t.Helper()
+
+	var auth models.AuthResponse
+	resp := call(t, a, "POST", "/api/v1/auth/register", "", models.RegisterRequest{
+		Email: email, Password: "correct horse battery",
+	}, &auth)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	return auth.AccessToken
+}
+
 // TestHealthEndpoint tests the health check endpoint
 func TestHealthEndpoint(t *testing.T) {
-	// This is a basic test structure
-	// In a real application, you'd want to set up the full application context
+	a := newTestApp(t, services.Stores{})
+
+	var body struct {
+		Status string `json:"status"`
+	}
+	resp := call(t, a, "GET", "/health", "", nil, &body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ready", body.Status)
+}
+
+// TestLinkLifecycle shortens, follows, edits and deletes a link over HTTP,
+// on the production stores and on the in-memory ones
+func TestLinkLifecycle(t *testing.T) {
+	for name, stores := range map[string]func() services.Stores{
+		"database": func() services.Stores { return services.Stores{} },
+		"memory":   services.NewMemoryStores,
+	} {
+		t.Run(name, func(t *testing.T) {
+			a := newTestApp(t, stores())
+			token := register(t, a, "lifecycle@example.com")
+
+			var created models.CreateURLResponse
+			resp := call(t, a, "POST", "/api/v1/urls/shorten", token, models.CreateURLRequest{
+				OriginalURL: "https://example.com/docs", CustomCode: "docs",
+			}, &created)
+			require.Equal(t, http.StatusCreated, resp.StatusCode)
+			assert.Equal(t, "docs", created.ShortCode)
+
+			resp = call(t, a, "POST", "/api/v1/urls/shorten", token, models.CreateURLRequest{
+				OriginalURL: "https://example.com/other", CustomCode: "docs",
+			}, nil)
+			assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+			resp = call(t, a, "GET", "/docs", "", nil, nil)
+			assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+			assert.Equal(t, "https://example.com/docs", resp.Header.Get("Location"))
+			cookies := resp.Cookies()
+			require.Len(t, cookies, 1)
+			assert.Equal(t, "lsvid", cookies[0].Name)
+
+			// Clicks are recorded and counted in the background
+			assert.Eventually(t, func() bool {
+				var summary models.AnalyticsSummary
+				call(t, a, "GET", "/api/v1/analytics/docs", token, nil, &summary)
+				return summary.TotalClicks == 1
+			}, 5*time.Second, 20*time.Millisecond)
+			var stats models.URLStats
+			call(t, a, "GET", "/api/v1/urls/docs/stats", token, nil, &stats)
+			assert.Equal(t, int64(1), stats.TotalClicks)
+			assert.Equal(t, int64(1), stats.UniqueClicks)
+
+			// The visitor cookie keeps a visitor the same across clients
+			req := httptest.NewRequest("GET", "/docs", nil)
+			req.Header.Set("User-Agent", "Other/1.0")
+			req.AddCookie(cookies[0])
+			_, err := a.Test(req, -1)
+			require.NoError(t, err)
+			assert.Eventually(t, func() bool {
+				call(t, a, "GET", "/api/v1/urls/docs/stats", token, nil, &stats)
+				return stats.TotalClicks == 2
+			}, 5*time.Second, 20*time.Millisecond)
+			assert.Equal(t, int64(1), stats.UniqueClicks)
+			var summary models.AnalyticsSummary
+			resp = call(t, a, "GET", "/api/v1/analytics/docs?interval=hour&tz=Europe/Amsterdam", token, nil, &summary)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			require.NotNil(t, summary.Series)
+			assert.Len(t, summary.Series.Points, 25)
+			assert.Equal(t, int64(2), summary.Series.Total)
+			assert.Equal(t, int64(1), summary.Series.Unique)
+			assert.Equal(t, int64(1), summary.UniqueClicks)
+			resp = call(t, a, "GET", "/api/v1/analytics/docs?interval=fortnight", token, nil, nil)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 
-	req, err := http.NewRequest("GET", "/health", nil)
-	assert.NoError(t, err)
+			// Edits evict the cached destination
+			moved := "https://example.com/guide"
+			resp = call(t, a, "PATCH", "/api/v1/urls/docs", token, models.UpdateURLRequest{OriginalURL: &moved}, nil)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			resp = call(t, a, "GET", "/docs", "", nil, nil)
+			assert.Equal(t, moved, resp.Header.Get("Location"))
 
-	rr := httptest.NewRecorder()
-	// handler := http.HandlerFunc(healthHandler) // You'd need to extract the handler
+			temporary, invalid := http.StatusFound, http.StatusSeeOther
+			resp = call(t, a, "PATCH", "/api/v1/urls/docs", token, models.UpdateURLRequest{RedirectType: &invalid}, nil)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			resp = call(t, a, "PATCH", "/api/v1/urls/docs", token, models.UpdateURLRequest{RedirectType: &temporary}, nil)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			resp = call(t, a, "GET", "/docs", "", nil, nil)
+			assert.Equal(t, http.StatusFound, resp.StatusCode)
 
-	// handler.ServeHTTP(rr, req)
+			resp = call(t, a, "DELETE", "/api/v1/urls/docs", token, nil, nil)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			resp = call(t, a, "GET", "/docs", "", nil, nil)
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 
-	// For now, just test that we can create a request
-	assert.Equal(t, http.StatusOK, rr.Code)
+			// Links stay within their workspace
+			other := register(t, a, "other@example.com")
+			resp = call(t, a, "GET", "/api/v1/analytics/docs", other, nil, nil)
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		})
+	}
 }
 
-// TestCreateURLRequest tests the URL creation request structure
-func TestCreateURLRequest(t *testing.T) {
-	requestBody := map[string]interface{}{
-		"original_url": "https://example.com",
-		"title":        "Test URL",
-		"description":  "A test URL",
+// TestAPIKeys tests that API keys act within their scopes, IP allowlist and
+// expiry, and stop working once revoked or once their creator leaves the
+// workspace
+func TestAPIKeys(t *testing.T) {
+	a := newTestApp(t, services.Stores{})
+	owner := register(t, a, "keys@example.com")
+	resp := call(t, a, "POST", "/api/v1/urls/shorten", owner, models.CreateURLRequest{
+		OriginalURL: "https://example.com/keys", CustomCode: "keys",
+	}, nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	createKey := func(token string, header http.Header, req models.CreateAPIKeyRequest) models.CreateAPIKeyResponse {
+		t.Helper()
+		var created models.CreateAPIKeyResponse
+		resp := callWithHeader(t, a, "POST", "/api/v1/api-keys", token, header, req, &created)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		return created
+	}
+	listURLs := func(key string) int {
+		t.Helper()
+		return call(t, a, "GET", "/api/v1/urls", key, nil, nil).StatusCode
 	}
 
-	jsonData, err := json.Marshal(requestBody)
-	assert.NoError(t, err)
+	// Scopes bound what a key may do, and keys cannot manage keys
+	reader := createKey(owner, nil, models.CreateAPIKeyRequest{Name: "reader", Scopes: []string{models.ScopeLinksRead}})
+	assert.Equal(t, http.StatusOK, listURLs(reader.Key))
+	resp = call(t, a, "POST", "/api/v1/urls/shorten", reader.Key, models.CreateURLRequest{OriginalURL: "https://example.com"}, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = call(t, a, "GET", "/api/v1/analytics/keys", reader.Key, nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = call(t, a, "GET", "/api/v1/api-keys", reader.Key, nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = call(t, a, "POST", "/api/v1/api-keys", owner, models.CreateAPIKeyRequest{Name: "admin", Scopes: []string{"members:manage"}}, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 
-	req, err := http.NewRequest("POST", "/api/v1/urls/shorten", bytes.NewBuffer(jsonData))
-	assert.NoError(t, err)
-	req.Header.Set("Content-Type", "application/json")
+	// Keys are refused outside their IP allowlist; app.Test requests come
+	// from 0.0.0.0
+	elsewhere := createKey(owner, nil, models.CreateAPIKeyRequest{
+		Name: "elsewhere", Scopes: []string{models.ScopeLinksRead}, AllowedIPs: []string{"192.0.2.0/24"},
+	})
+	assert.Equal(t, http.StatusForbidden, listURLs(elsewhere.Key))
+	here := createKey(owner, nil, models.CreateAPIKeyRequest{
+		Name: "here", Scopes: []string{models.ScopeLinksRead}, AllowedIPs: []string{"192.0.2.0/24", "0.0.0.0"},
+	})
+	assert.Equal(t, http.StatusOK, listURLs(here.Key))
+
+	// Keys stop working when they expire
+	past := time.Now().Add(-time.Minute)
+	resp = call(t, a, "POST", "/api/v1/api-keys", owner, models.CreateAPIKeyRequest{
+		Name: "expired", Scopes: []string{models.ScopeLinksRead}, ExpiresAt: &past,
+	}, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	soon := time.Now().Add(500 * time.Millisecond)
+	expiring := createKey(owner, nil, models.CreateAPIKeyRequest{Name: "expiring", Scopes: []string{models.ScopeLinksRead}, ExpiresAt: &soon})
+	assert.Equal(t, http.StatusOK, listURLs(expiring.Key))
+	assert.Eventually(t, func() bool {
+		return listURLs(expiring.Key) == http.StatusUnauthorized
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// Revoked keys stop working
+	resp = call(t, a, "DELETE", "/api/v1/api-keys/"+reader.ID, owner, nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, listURLs(reader.Key))
 
-	// This test just verifies we can create the request
-	assert.NotNil(t, req)
-	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	// A member's keys stop working once the member leaves the workspace
+	var workspaces struct {
+		Workspaces []models.Workspace `json:"workspaces"`
+	}
+	call(t, a, "GET", "/api/v1/workspaces", owner, nil, &workspaces)
+	require.Len(t, workspaces.Workspaces, 1)
+	workspaceID := workspaces.Workspaces[0].ID
+	var invitation models.CreateInvitationResponse
+	resp = call(t, a, "POST", "/api/v1/workspaces/"+workspaceID+"/invitations", owner, models.CreateInvitationRequest{
+		Email: "member@example.com", Role: models.RoleAdmin,
+	}, &invitation)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var member models.AuthResponse
+	resp = call(t, a, "POST", "/api/v1/auth/register", "", models.RegisterRequest{
+		Email: "member@example.com", Password: "correct horse battery",
+	}, &member)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = call(t, a, "POST", "/api/v1/invitations/accept", member.AccessToken, models.AcceptInvitationRequest{Token: invitation.Token}, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	memberKey := createKey(member.AccessToken, http.Header{"X-Workspace-Id": {workspaceID}}, models.CreateAPIKeyRequest{
+		Name: "member", Scopes: []string{models.ScopeLinksRead},
+	})
+	var list models.URLListResponse
+	resp = call(t, a, "GET", "/api/v1/urls", memberKey.Key, nil, &list)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, list.URLs, 1)
+	assert.Equal(t, "keys", list.URLs[0].ShortCode)
+	resp = call(t, a, "DELETE", "/api/v1/workspaces/"+workspaceID+"/members/"+member.User.ID, owner, nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, http.StatusNotFound, listURLs(memberKey.Key))
 }
 
-// TestShortCodeGeneration tests the short code generation logic
+// TestShortCodeGeneration tests generated and rejected short codes
 func TestShortCodeGeneration(t *testing.T) {
-	// This would test the short code generation function
-	// For now, just test that we can create a basic test
-	assert.True(t, true)
+	a := newTestApp(t, services.NewMemoryStores())
+	token := register(t, a, "codes@example.com")
+
+	var created models.CreateURLResponse
+	resp := call(t, a, "POST", "/api/v1/urls/shorten", token, models.CreateURLRequest{
+		OriginalURL: "https://example.com",
+	}, &created)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Regexp(t, regexp.MustCompile(`^[a-zA-Z0-9]{6}$`), created.ShortCode)
+
+	resp = call(t, a, "POST", "/api/v1/urls/shorten", token, models.CreateURLRequest{
+		OriginalURL: "https://example.com", CustomCode: "no spaces",
+	}, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = call(t, a, "POST", "/api/v1/urls/shorten", "", models.CreateURLRequest{
+		OriginalURL: "https://example.com",
+	}, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+// TestShortCodeScanning tests that lookups of unknown short codes are cached
+// without hiding links created later, and that they drain the redirect rate
+// limit faster than redirects
+func TestShortCodeScanning(t *testing.T) {
+	a := newTestApp(t, services.Stores{})
+	token := register(t, a, "scanning@example.com")
+
+	resp := call(t, a, "GET", "/later", "", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = call(t, a, "POST", "/api/v1/urls/shorten", token, models.CreateURLRequest{
+		OriginalURL: "https://example.com/later", CustomCode: "later",
+	}, nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = call(t, a, "GET", "/later", "", nil, nil)
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+
+	// Each 404 counts as 10 of the 300 redirects allowed per minute
+	limited := 0
+	for i := 0; i < 40 && limited == 0; i++ {
+		resp = call(t, a, "GET", fmt.Sprintf("/scan%d", i), "", nil, nil)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			limited = i
+		}
+	}
+	assert.InDelta(t, 30, limited, 2)
+}
+
+// TestAuthSessions tests that refresh tokens rotate, that reusing a rotated
+// one ends every session of its user, and that logging out revokes the
+// session's tokens
+func TestAuthSessions(t *testing.T) {
+	a := newTestApp(t, services.Stores{})
+	credentials := models.LoginRequest{Email: "sessions@example.com", Password: "correct horse battery"}
+	resp := call(t, a, "POST", "/api/v1/auth/register", "", models.RegisterRequest{
+		Email: credentials.Email, Password: credentials.Password,
+	}, nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	login := func() models.AuthResponse {
+		t.Helper()
+		var auth models.AuthResponse
+		resp := call(t, a, "POST", "/api/v1/auth/login", "", credentials, &auth)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return auth
+	}
+	refresh := func(token string) (models.AuthResponse, int) {
+		t.Helper()
+		var auth models.AuthResponse
+		resp := call(t, a, "POST", "/api/v1/auth/refresh", "", models.RefreshRequest{RefreshToken: token}, nil)
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&auth))
+		}
+		return auth, resp.StatusCode
+	}
+
+	// Refreshing rotates the refresh token
+	first, other := login(), login()
+	rotated, status := refresh(first.RefreshToken)
+	require.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, first.RefreshToken, rotated.RefreshToken)
+	resp = call(t, a, "GET", "/api/v1/workspaces", rotated.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Presenting the rotated token again revokes every session of the user
+	_, status = refresh(first.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	_, status = refresh(rotated.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	_, status = refresh(other.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// Logging out revokes the access token and the given refresh token only
+	session, kept := login(), login()
+	resp = call(t, a, "POST", "/api/v1/auth/logout", session.AccessToken, models.RefreshRequest{RefreshToken: session.RefreshToken}, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = call(t, a, "GET", "/api/v1/workspaces", session.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	kept, status = refresh(kept.RefreshToken)
+	require.Equal(t, http.StatusOK, status)
+	resp = call(t, a, "GET", "/api/v1/workspaces", kept.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Without a refresh token, every session ends
+	last := login()
+	resp = call(t, a, "POST", "/api/v1/auth/logout", kept.AccessToken, nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, status = refresh(last.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	_, status = refresh(session.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+// TestDeactivatedUser tests that deactivating a user ends their sessions at
+// once, including access tokens that have not expired
+func TestDeactivatedUser(t *testing.T) {
+	db := newTestDB(t)
+	a := newConfiguredTestApp(t, config.Default(), db, newTestRedis(t), services.Stores{})
+	var auth models.AuthResponse
+	resp := call(t, a, "POST", "/api/v1/auth/register", "", models.RegisterRequest{
+		Email: "deactivated@example.com", Password: "correct horse battery",
+	}, &auth)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = call(t, a, "GET", "/api/v1/workspaces", auth.AccessToken, nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err := db.ExecContext(context.Background(), `UPDATE users SET is_active = false WHERE id = $1`, auth.User.ID)
+	require.NoError(t, err)
+	resp = call(t, a, "GET", "/api/v1/workspaces", auth.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = call(t, a, "POST", "/api/v1/auth/refresh", "", models.RefreshRequest{RefreshToken: auth.RefreshToken}, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = call(t, a, "POST", "/api/v1/auth/login", "", models.LoginRequest{
+		Email: "deactivated@example.com", Password: "correct horse battery",
+	}, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+// TestLoginUnknownEmail tests that an unknown email is refused like a wrong
+// password, after as long a password check against a dummy hash
+func TestLoginUnknownEmail(t *testing.T) {
+	a := newTestApp(t, services.Stores{})
+	register(t, a, "known@example.com")
+
+	attempt := func(email string) (int, string, time.Duration) {
+		t.Helper()
+		var body struct {
+			Error string `json:"error"`
+		}
+		start := time.Now()
+		resp := call(t, a, "POST", "/api/v1/auth/login", "", models.LoginRequest{Email: email, Password: "wrong password"}, &body)
+		return resp.StatusCode, body.Error, time.Since(start)
+	}
+	wrongStatus, wrongError, wrongTook := attempt("known@example.com")
+	unknownStatus, unknownError, unknownTook := attempt("unknown@example.com")
+	assert.Equal(t, http.StatusUnauthorized, wrongStatus)
+	assert.Equal(t, wrongStatus, unknownStatus)
+	assert.Equal(t, wrongError, unknownError)
+	assert.Greater(t, unknownTook, wrongTook/4)
+}
+
+// TestRevocationUnavailable tests that access tokens are refused while
+// Redis cannot tell whether they were revoked, unless configured to fail
+// open
+func TestRevocationUnavailable(t *testing.T) {
+	for name, failOpen := range map[string]bool{"closed": false, "open": true} {
+		t.Run(name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			client, err := redis.NewClient("redis://" + mr.Addr())
+			require.NoError(t, err)
+			t.Cleanup(func() { client.Close() })
+			cfg := config.Default()
+			cfg.Auth.RevocationFailOpen = failOpen
+			a := newConfiguredTestApp(t, cfg, newTestDB(t), client, services.Stores{})
+			token := register(t, a, "revocation@example.com")
+
+			mr.Close()
+			var body struct {
+				Error string `json:"error"`
+			}
+			resp := call(t, a, "GET", "/api/v1/workspaces", token, nil, &body)
+			if failOpen {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			} else {
+				assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+				assert.Equal(t, "Authentication is temporarily unavailable", body.Error)
+			}
+		})
+	}
 }
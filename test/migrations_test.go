@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"linksprint/internal/database"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMigrations tests that the embedded migrations load in version order,
+// each with an up and a down
+func TestMigrations(t *testing.T) {
+	migrations, err := database.Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	assert.Equal(t, int64(1), migrations[0].Version)
+	assert.Equal(t, "initial_schema", migrations[0].Name)
+	for i, migration := range migrations {
+		assert.NotEmpty(t, database.SplitStatements(migration.Up), migration.Name)
+		assert.NotEmpty(t, database.SplitStatements(migration.Down), migration.Name)
+		if i > 0 {
+			assert.Greater(t, migration.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+// TestMigrationChecksums tests that applied migrations are checked against
+// the checksums recorded when they were applied, and that versions applied
+// before checksums existed get them
+func TestMigrationChecksums(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.NewConnection("sqlite:" + filepath.Join(t.TempDir(), "linksprint.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	migrator, err := database.NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Check(ctx))
+
+	migrations, err := database.Migrations()
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `UPDATE schema_migrations SET checksum = NULL WHERE version = 1`)
+	require.NoError(t, err)
+	require.NoError(t, migrator.Check(ctx))
+	var checksum string
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT checksum FROM schema_migrations WHERE version = 1`).Scan(&checksum))
+	assert.Equal(t, migrations[0].Checksum(), checksum)
+
+	_, err = db.ExecContext(ctx, `UPDATE schema_migrations SET checksum = 'edited' WHERE version = 1`)
+	require.NoError(t, err)
+	assert.ErrorIs(t, migrator.Check(ctx), database.ErrMigrationChanged)
+	_, err = migrator.Up(ctx)
+	assert.ErrorIs(t, err, database.ErrMigrationChanged)
+}
+
+// TestMigrationRerun tests that a migration seeding a table from existing
+// rows can be run again after it was partly applied, as happens when a
+// non-transactional migration fails midway
+func TestMigrationRerun(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.NewConnection("sqlite:" + filepath.Join(t.TempDir(), "linksprint.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	migrator, err := database.NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+
+	_, err = db.ExecContext(ctx, `INSERT INTO urls (id, short_code, original_url) VALUES ('00000000-0000-0000-0000-000000000001', 'rerun', 'https://example.com')`)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `INSERT INTO analytics (url_id, short_code) VALUES ('00000000-0000-0000-0000-000000000001', 'rerun')`)
+	require.NoError(t, err)
+
+	migrations, err := database.Migrations()
+	require.NoError(t, err)
+	var counters database.Migration
+	for _, migration := range migrations {
+		if migration.Name == "url_click_counters" {
+			counters = migration
+		}
+	}
+	require.NotZero(t, counters.Version)
+	sql, err := db.Dialect.Render(counters.Up)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		for _, statement := range database.SplitStatements(sql) {
+			_, err := db.ExecContext(ctx, statement)
+			require.NoError(t, err, statement)
+		}
+	}
+	var total int64
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT total_clicks FROM url_click_counters`).Scan(&total))
+	assert.Equal(t, int64(1), total)
+}
+
+// TestSplitStatements tests that statements end at a trailing semicolon and
+// comment lines are dropped
+func TestSplitStatements(t *testing.T) {
+	statements := database.SplitStatements(`-- Users
+CREATE TABLE users (
+	id UUID PRIMARY KEY
+);
+
+-- Index
+CREATE INDEX idx ON users (id);
+ALTER TABLE users ADD COLUMN note TEXT DEFAULT 'a;b'`)
+
+	require.Len(t, statements, 3)
+	assert.Equal(t, "CREATE TABLE users (\n\tid UUID PRIMARY KEY\n);", statements[0])
+	assert.Equal(t, "CREATE INDEX idx ON users (id);", statements[1])
+	assert.Equal(t, "ALTER TABLE users ADD COLUMN note TEXT DEFAULT 'a;b'", statements[2])
+}
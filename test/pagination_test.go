@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"linksprint/internal/pagination"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCursorRoundTrip tests that cursors survive encoding and decoding
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := pagination.Cursor{
+		Time: time.Date(2024, 3, 1, 12, 30, 45, 123456000, time.UTC),
+		ID:   "2b1f6a3e-0f0e-4d7a-9f55-8c3b4a1d2e6f",
+	}
+
+	decoded, err := pagination.Decode(cursor.Encode())
+	assert.NoError(t, err)
+	assert.True(t, cursor.Time.Equal(decoded.Time))
+	assert.Equal(t, cursor.ID, decoded.ID)
+}
+
+// TestCursorDecodeEmpty tests that an empty token starts from the first page
+func TestCursorDecodeEmpty(t *testing.T) {
+	decoded, err := pagination.Decode("")
+	assert.NoError(t, err)
+	assert.Nil(t, decoded)
+}
+
+// TestCursorDecodeInvalid tests that garbage tokens are rejected
+func TestCursorDecodeInvalid(t *testing.T) {
+	for _, token := range []string{"not-base64!", "e30", "bm90IGpzb24"} {
+		_, err := pagination.Decode(token)
+		assert.ErrorIs(t, err, pagination.ErrInvalidCursor, token)
+	}
+}
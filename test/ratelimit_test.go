@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"linksprint/internal/config"
+	"linksprint/internal/middleware"
+	"linksprint/internal/redis"
+	"linksprint/internal/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRateLimitedApp(t *testing.T, policy config.RateLimit) *fiber.App {
+	mr := miniredis.RunT(t)
+	client, err := redis.NewClient("redis://" + mr.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	app := fiber.New()
+	app.Get("/", middleware.RateLimit(client, "test", func(string) config.RateLimit { return policy }), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	return app
+}
+
+// TestRateLimitAllowsBurstThenRejects tests the GCRA limiter and its headers
+func TestRateLimitAllowsBurstThenRejects(t *testing.T) {
+	app := newRateLimitedApp(t, config.RateLimit{Limit: 3, Period: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, "3", resp.Header.Get("RateLimit-Limit"))
+		assert.Equal(t, []string{"2", "1", "0"}[i], resp.Header.Get("RateLimit-Remaining"))
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "20", resp.Header.Get("Retry-After"))
+	assert.Equal(t, "3;w=60", resp.Header.Get("RateLimit-Policy"))
+}
+
+// TestRateLimitDisabled tests that a zero limit lets every request through
+func TestRateLimitDisabled(t *testing.T) {
+	app := newRateLimitedApp(t, config.RateLimit{})
+
+	for i := 0; i < 5; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("RateLimit-Limit"))
+	}
+}
+
+// TestParseRateLimit tests the "<limit>/<period>" configuration format
+func TestParseRateLimit(t *testing.T) {
+	limit, err := config.ParseRateLimit("60/1m")
+	assert.NoError(t, err)
+	assert.Equal(t, config.RateLimit{Limit: 60, Period: time.Minute}, limit)
+
+	limit, err = config.ParseRateLimit("0")
+	assert.NoError(t, err)
+	assert.Zero(t, limit.Limit)
+
+	for _, value := range []string{"60", "x/1m", "60/soon", "60/0s"} {
+		_, err := config.ParseRateLimit(value)
+		assert.Error(t, err, value)
+	}
+}
+
+// TestRateLimitPerCaller tests that the api limit counts each signed-in
+// caller separately, even behind one client IP
+func TestRateLimitPerCaller(t *testing.T) {
+	a := newTestApp(t, services.Stores{})
+	alice := register(t, a, "alice@example.com")
+	bob := register(t, a, "bob@example.com")
+
+	remaining := func(token string) string {
+		resp := call(t, a, "GET", "/api/v1/usage", token, nil, nil)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		return resp.Header.Get("RateLimit-Remaining")
+	}
+	assert.Equal(t, "599", remaining(alice))
+	assert.Equal(t, "598", remaining(alice))
+	assert.Equal(t, "599", remaining(bob))
+
+	// Unauthenticated requests are counted per client IP
+	resp := call(t, a, "GET", "/api/v1/usage", "", nil, nil)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "1200", resp.Header.Get("RateLimit-Limit"))
+}
+
+// TestRateLimitPerIPBeforeAuth tests that requests with made-up credentials
+// run into the per-IP limit before they are authenticated
+func TestRateLimitPerIPBeforeAuth(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimits["api_ip"] = config.RateLimit{Limit: 3, Period: time.Minute}
+	a := newConfiguredTestApp(t, cfg, newTestDB(t), newTestRedis(t), services.Stores{})
+
+	for _, token := range []string{"bogus", "lsk_0123_bogus", "bogus"} {
+		resp := call(t, a, "GET", "/api/v1/urls", token, nil, nil)
+		assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	}
+	resp := call(t, a, "GET", "/api/v1/urls", "lsk_0123_bogus", nil, nil)
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get(fiber.HeaderRetryAfter))
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"linksprint/internal/config"
+	"linksprint/internal/database"
+	"linksprint/internal/models"
+	"linksprint/internal/redis"
+	"linksprint/internal/services"
+	"linksprint/internal/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSQLiteStandalone runs links and their analytics on SQLite with Redis
+// in-process, as `--storage=sqlite:<file>` does
+func TestSQLiteStandalone(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.NewConnection("sqlite:" + filepath.Join(t.TempDir(), "data", "linksprint.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	migrator, err := database.NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+
+	client, err := redis.NewInProcess(redis.Options{})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	cfg := config.Default()
+	auth := services.NewAuthService(db, client, cfg)
+	registered, err := auth.Register(ctx, &models.RegisterRequest{
+		Email: "standalone@example.com", Password: "correct horse battery",
+	})
+	require.NoError(t, err)
+	principal, err := auth.VerifyAccessToken(ctx, registered.AccessToken)
+	require.NoError(t, err)
+	require.NoError(t, services.NewWorkspaceService(db).ResolveWorkspace(ctx, principal, ""))
+
+	stores, usage := services.NewStores(db, client), services.NewUsageService(db, client)
+	urls := services.NewURLService(stores, usage, config.NewLive(cfg))
+	analytics := services.NewAnalyticsService(stores, usage, cfg.VisitorKey())
+
+	expiresAt := time.Now().Add(time.Hour).In(time.FixedZone("UTC+2", 2*60*60))
+	for _, code := range []string{"one", "two", "three"} {
+		_, err := urls.CreateShortURL(ctx, principal, &models.CreateURLRequest{
+			OriginalURL: "https://example.com/" + code,
+			CustomCode:  code,
+			ExpiresAt:   &expiresAt,
+		})
+		require.NoError(t, err)
+	}
+	_, err = urls.CreateShortURL(ctx, principal, &models.CreateURLRequest{OriginalURL: "https://example.com", CustomCode: "one"})
+	assert.ErrorIs(t, err, services.ErrShortCodeTaken)
+
+	redirect, err := urls.GetOriginalURL(ctx, "", "two")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/two", redirect.OriginalURL)
+
+	// Keyset pagination walks every link once, newest first
+	page, err := urls.ListURLsByCursor(ctx, principal, "", 2, true)
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 2)
+	assert.Equal(t, int64(3), *page.Total)
+	next, err := urls.ListURLsByCursor(ctx, principal, page.NextCursor, 2, false)
+	require.NoError(t, err)
+	require.Len(t, next.URLs, 1)
+	assert.Equal(t, "one", next.URLs[0].ShortCode)
+	assert.False(t, next.HasMore)
+
+	for _, ip := range []string{"203.0.113.1", "203.0.113.1", "203.0.113.2"} {
+		require.NoError(t, analytics.RecordClick(ctx, &models.AnalyticsRequest{
+			ShortCode: "two", IPAddress: ip, Country: "NL",
+		}))
+	}
+	summary, err := analytics.GetAnalytics(ctx, principal, "two", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), summary.TotalClicks)
+	assert.Equal(t, int64(2), summary.UniqueClicks)
+	assert.Equal(t, []models.Country{{Name: "NL", Count: 3}}, summary.TopCountries)
+	require.Len(t, summary.Series.Points, 8)
+	assert.Equal(t, int64(3), summary.Series.Total)
+	assert.Equal(t, int64(3), summary.Series.Points[7].Count)
+	assert.Equal(t, time.Now().UTC().Format("2006-01-02"), summary.Series.Points[7].Time.Format("2006-01-02"))
+	assert.Nil(t, summary.Series.Change)
+	require.NotNil(t, summary.LastClickedAt)
+	assert.WithinDuration(t, time.Now(), *summary.LastClickedAt, time.Minute)
+
+	global, err := analytics.GetGlobalAnalytics(ctx, principal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), global.TotalURLs)
+	assert.Equal(t, int64(3), global.TodayClicks)
+
+	// Click totals survive flushes, which leave the clicks of the last
+	// minute pending, and are rebuilt from the clicks after Redis loses
+	// pending counts
+	stats, err := urls.GetURLStats(ctx, principal, "two")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.TotalClicks)
+	require.NoError(t, analytics.FlushClickCounters(ctx))
+	stats, err = urls.GetURLStats(ctx, principal, "two")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.TotalClicks)
+
+	// A flush cut short, before or after its clicks are stored, is applied
+	// once by the next flush
+	for _, flushID := range []string{"unstored", "stored"} {
+		require.NoError(t, analytics.RecordClick(ctx, &models.AnalyticsRequest{ShortCode: "two"}))
+		counts, err := client.TakePendingClicks(ctx, flushID, time.Now().Add(time.Minute), time.Time{})
+		require.NoError(t, err)
+		require.NotEmpty(t, counts)
+		if flushID == "stored" {
+			_, err := store.NewSQL(db).FlushClickCounters(ctx, 0, func(before, countedUntil time.Time) (map[string]map[string]int64, error) {
+				return map[string]map[string]int64{flushID: counts}, nil
+			})
+			require.NoError(t, err)
+		}
+		require.NoError(t, analytics.FlushClickCounters(ctx))
+		unflushed, err := client.UnflushedClicks(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, unflushed)
+	}
+	stats, err = urls.GetURLStats(ctx, principal, "two")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), stats.TotalClicks)
+
+	require.NoError(t, analytics.RecordClick(ctx, &models.AnalyticsRequest{ShortCode: "two"}))
+	require.NoError(t, client.FlushAll(ctx).Err())
+	stats, err = urls.GetURLStats(ctx, principal, "two")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), stats.TotalClicks)
+
+	// Reconciling counts the clicks stored up to a minute ago and drops
+	// their pending counts, keeping those of later clicks, so no click is
+	// counted twice; here the clicks so far were stored two minutes ago,
+	// and one of them is still pending
+	var twoID string
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT id FROM urls WHERE short_code = 'two'").Scan(&twoID))
+	twoMinutesAgo := time.Now().UTC().Add(-2 * time.Minute)
+	_, err = db.ExecContext(ctx, "UPDATE analytics SET recorded_at = $1", twoMinutesAgo)
+	require.NoError(t, err)
+	require.NoError(t, client.IncrementPendingClicks(ctx, twoID, twoMinutesAgo))
+	require.NoError(t, analytics.RecordClick(ctx, &models.AnalyticsRequest{ShortCode: "two"}))
+	links, err := analytics.ReconcileClickCounters(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), links)
+	stats, err = urls.GetURLStats(ctx, principal, "two")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), stats.TotalClicks)
+	pending, err := client.GetPendingClicks(ctx, twoID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pending)
+
+	// Visitors lost with Redis are rebuilt too; only the last click's is
+	// left
+	assert.Equal(t, int64(1), stats.UniqueClicks)
+	days, err := analytics.RebuildVisitors(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), days)
+	stats, err = urls.GetURLStats(ctx, principal, "two")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.UniqueClicks)
+
+	// Rolling clicks up leaves the analytics unchanged
+	const iphone = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	const firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0"
+	now := time.Now().UTC()
+	for _, click := range []struct {
+		ago       time.Duration
+		userAgent string
+	}{
+		{3 * 24 * time.Hour, iphone},
+		{2 * time.Hour, firefox},
+		{2 * time.Hour, iphone},
+		{0, firefox},
+	} {
+		require.NoError(t, analytics.RecordClick(ctx, &models.AnalyticsRequest{
+			ShortCode: "three", UserAgent: click.userAgent, Referer: "https://www.News.example/article",
+			Country: "NL", ClickedAt: now.Add(-click.ago),
+		}))
+	}
+	hourly := &models.ClickRange{Interval: models.IntervalHour, From: func() *time.Time { t := now.Add(-4 * 24 * time.Hour); return &t }()}
+	before, err := analytics.GetAnalytics(ctx, principal, "three", hourly)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Referer{{Domain: "news.example", Count: 4}}, before.TopReferers)
+	assert.ElementsMatch(t, []models.Device{{Name: "mobile", Count: 2}, {Name: "desktop", Count: 2}}, before.TopDevices)
+	assert.ElementsMatch(t, []models.Browser{{Name: "Safari", Count: 2}, {Name: "Firefox", Count: 2}}, before.TopBrowsers)
+	// As if each click had been stored when it happened
+	_, err = db.ExecContext(ctx, "UPDATE analytics SET recorded_at = clicked_at")
+	require.NoError(t, err)
+	require.NoError(t, analytics.RollUpClicks(ctx))
+	var rolledUp int64
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT COALESCE(SUM(clicks), 0) FROM click_rollups_hourly WHERE dimension = 'total'").Scan(&rolledUp))
+	assert.Equal(t, int64(3), rolledUp)
+	after, err := analytics.GetAnalytics(ctx, principal, "three", hourly)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), after.TotalClicks)
+	assert.Equal(t, before.TopCountries, after.TopCountries)
+	assert.Equal(t, before.TopReferers, after.TopReferers)
+	assert.ElementsMatch(t, before.TopDevices, after.TopDevices)
+	assert.ElementsMatch(t, before.TopBrowsers, after.TopBrowsers)
+	assert.Equal(t, int64(4), after.Series.Total)
+	assert.Equal(t, before.Series.Points, after.Series.Points)
+
+	// A click stored late, into an hour already rolled up, is counted right
+	// away and added to that hour when the hour it was stored in is rolled
+	// up, here by rolling up the hour under way too
+	require.NoError(t, analytics.RecordClick(ctx, &models.AnalyticsRequest{
+		ShortCode: "three", UserAgent: iphone, Country: "BE", ClickedAt: now.Add(-3 * 24 * time.Hour),
+	}))
+	late, err := analytics.GetAnalytics(ctx, principal, "three", hourly)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), late.TotalClicks)
+	assert.Equal(t, int64(5), late.Series.Total)
+	assert.Equal(t, []models.Country{{Name: "NL", Count: 4}, {Name: "BE", Count: 1}}, late.TopCountries)
+	clicks := store.NewSQL(db)
+	for more := true; more; {
+		more, err = clicks.RollUpNextHour(ctx, -time.Hour)
+		require.NoError(t, err)
+	}
+	var lateHour int64
+	require.NoError(t, db.QueryRowContext(ctx, `
+		SELECT clicks FROM click_rollups_hourly
+		WHERE url_id = (SELECT id FROM urls WHERE short_code = 'three') AND dimension = 'total' AND bucket = $1
+	`, now.Add(-3*24*time.Hour).Truncate(time.Hour)).Scan(&lateHour))
+	assert.Equal(t, int64(2), lateHour)
+	rerolled, err := analytics.GetAnalytics(ctx, principal, "three", hourly)
+	require.NoError(t, err)
+	assert.Equal(t, late.TotalClicks, rerolled.TotalClicks)
+	assert.Equal(t, late.TopCountries, rerolled.TopCountries)
+	assert.Equal(t, late.Series.Points, rerolled.Series.Points)
+
+	// Workspace totals read the same rollups and match the clicks recorded
+	global, err = analytics.GetGlobalAnalytics(ctx, principal)
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), global.TotalClicks)
+	var today int64
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT COUNT(*) FROM analytics WHERE clicked_at >= $1",
+		now.Truncate(24*time.Hour)).Scan(&today))
+	assert.Equal(t, today, global.TodayClicks)
+
+	// Series are gap-filled in their time zone and compared with the
+	// period before; half-hour offsets are counted by the minute
+	from := now.Add(-2 * 24 * time.Hour)
+	series, err := analytics.ClickSeries(ctx, principal, "three", &models.ClickRange{From: &from, Timezone: "Asia/Kolkata"})
+	require.NoError(t, err)
+	require.Len(t, series.Points, 3)
+	assert.Equal(t, "Asia/Kolkata", series.Timezone)
+	assert.Equal(t, 0, series.Points[0].Time.Hour())
+	assert.Equal(t, int64(3), series.Total)
+	assert.Equal(t, int64(2), series.Previous.Total)
+	require.NotNil(t, series.Change)
+	assert.InDelta(t, 50, *series.Change, 0.001)
+	_, err = analytics.ClickSeries(ctx, principal, "three", &models.ClickRange{Interval: models.IntervalMinute, From: &from})
+	assert.ErrorIs(t, err, services.ErrInvalidClickRange)
+
+	require.NoError(t, urls.DeleteURL(ctx, principal, "two"))
+	_, err = urls.GetOriginalURL(ctx, "", "two")
+	assert.Error(t, err)
+	_, err = analytics.GetAnalytics(ctx, principal, "two", nil)
+	assert.ErrorIs(t, err, services.ErrURLNotFound)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"linksprint/internal/config"
+	"linksprint/internal/models"
+	"linksprint/internal/redis"
+	"linksprint/internal/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConsumeUsage tests seeding, quota enforcement and refunds of usage
+// counters
+func TestConsumeUsage(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client, err := redis.NewClient("redis://" + mr.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	ctx := context.Background()
+	keys := redis.UsageKeys{
+		Month:    "usage:workspace:w1:links_created:m:2026-10",
+		Day:      "usage:workspace:w1:links_created:d:2026-10-18",
+		DayIndex: "usage:days:2026-10-18",
+		Member:   "workspace:w1:links_created",
+	}
+
+	_, _, err = client.ConsumeUsage(ctx, keys, 1, 3)
+	assert.ErrorIs(t, err, redis.ErrUsageNotSeeded)
+
+	require.NoError(t, client.SeedUsage(ctx, keys, 2, 1))
+
+	used, ok, err := client.ConsumeUsage(ctx, keys, 1, 3)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), used)
+
+	_, ok, err = client.ConsumeUsage(ctx, keys, 1, 3)
+	require.NoError(t, err)
+	assert.False(t, ok, "the fourth link is over the quota")
+
+	require.NoError(t, client.RefundUsage(ctx, keys, 1))
+	month, err := client.GetUsage(ctx, keys.Month)
+	require.NoError(t, err)
+	require.NotNil(t, month)
+	assert.Equal(t, int64(2), *month)
+
+	members, err := client.UsageDayMembers(ctx, keys.DayIndex)
+	require.NoError(t, err)
+	assert.Equal(t, []string{keys.Member}, members)
+}
+
+// TestPlanLimits tests that zero limits mean unlimited
+func TestPlanLimits(t *testing.T) {
+	assert.Equal(t, int64(1000), models.Plans[models.PlanFree].Limit(models.MetricLinksCreated))
+	assert.Equal(t, int64(0), models.Plans[models.PlanEnterprise].Limit(models.MetricClicks))
+}
+
+// TestWorkspacePlan tests that a workspace moved to another plan gets its
+// quotas, and that the move is audited
+func TestWorkspacePlan(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	a := newConfiguredTestApp(t, config.Default(), db, newTestRedis(t), services.Stores{})
+	owner := register(t, a, "plans@example.com")
+	workspaces := services.NewWorkspaceService(db)
+
+	getUsage := func() models.UsageResponse {
+		t.Helper()
+		var usage models.UsageResponse
+		resp := call(t, a, "GET", "/api/v1/usage", owner, nil, &usage)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return usage
+	}
+	usage := getUsage()
+	assert.Equal(t, models.PlanFree, usage.Workspace.Plan)
+	require.NotNil(t, usage.Workspace.Metrics[models.MetricLinksCreated].Limit)
+	assert.Equal(t, int64(1000), *usage.Workspace.Metrics[models.MetricLinksCreated].Limit)
+
+	workspace, err := workspaces.SetPlan(ctx, nil, usage.WorkspaceID, models.PlanTeam)
+	require.NoError(t, err)
+	assert.Equal(t, models.PlanTeam, workspace.Plan)
+	usage = getUsage()
+	assert.Equal(t, models.PlanTeam, usage.Workspace.Plan)
+	require.NotNil(t, usage.Workspace.Metrics[models.MetricLinksCreated].Limit)
+	assert.Equal(t, int64(20000), *usage.Workspace.Metrics[models.MetricLinksCreated].Limit)
+
+	_, err = workspaces.SetPlan(ctx, nil, usage.WorkspaceID, models.PlanEnterprise)
+	require.NoError(t, err)
+	usage = getUsage()
+	assert.Equal(t, models.PlanEnterprise, usage.Workspace.Plan)
+	assert.Nil(t, usage.Workspace.Metrics[models.MetricLinksCreated].Limit)
+
+	_, err = workspaces.SetPlan(ctx, nil, usage.WorkspaceID, "platinum")
+	assert.ErrorIs(t, err, services.ErrInvalidWorkspace)
+	_, err = workspaces.SetPlan(ctx, nil, "00000000-0000-0000-0000-000000000000", models.PlanTeam)
+	assert.ErrorIs(t, err, services.ErrWorkspaceNotFound)
+
+	var events models.AuditListResponse
+	resp := call(t, a, "GET", "/api/v1/audit?action="+models.AuditWorkspaceUpdate, owner, nil, &events)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, events.Events, 2)
+	var before, after models.Workspace
+	require.NoError(t, json.Unmarshal(events.Events[0].Before, &before))
+	require.NoError(t, json.Unmarshal(events.Events[0].After, &after))
+	assert.Equal(t, models.PlanTeam, before.Plan)
+	assert.Equal(t, models.PlanEnterprise, after.Plan)
+	assert.Empty(t, events.Events[0].ActorUserID)
+}
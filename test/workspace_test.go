@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"linksprint/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRolePermissions tests what each workspace role may do
+func TestRolePermissions(t *testing.T) {
+	assert.True(t, models.RoleViewer.Can(models.PermLinksRead))
+	assert.False(t, models.RoleViewer.Can(models.PermLinksWrite))
+	assert.True(t, models.RoleEditor.Can(models.PermLinksWrite))
+	assert.False(t, models.RoleEditor.Can(models.PermMembersManage))
+	assert.True(t, models.RoleAdmin.Can(models.PermMembersManage))
+	assert.False(t, models.RoleAdmin.Can(models.PermWorkspaceManage))
+	assert.True(t, models.RoleOwner.Can(models.PermWorkspaceManage))
+	assert.False(t, models.Role("superuser").IsValid())
+}
+
+// TestPrincipalCan tests that API keys are limited by both role and scopes
+func TestPrincipalCan(t *testing.T) {
+	user := &models.Principal{UserID: "u1", WorkspaceID: "w1", Role: models.RoleEditor}
+	assert.True(t, user.Can(models.PermLinksWrite))
+
+	key := &models.Principal{
+		UserID:      "u1",
+		APIKeyID:    "k1",
+		Scopes:      []string{models.ScopeLinksRead},
+		WorkspaceID: "w1",
+		Role:        models.RoleEditor,
+	}
+	assert.True(t, key.Can(models.PermLinksRead))
+	assert.False(t, key.Can(models.PermLinksWrite))
+	assert.False(t, key.Can(models.PermAPIKeysManage))
+
+	noWorkspace := &models.Principal{UserID: "u1", Role: models.RoleOwner}
+	assert.False(t, noWorkspace.Can(models.PermLinksRead))
+}